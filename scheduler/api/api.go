@@ -21,21 +21,45 @@ import (
 	sched "hydrogen/scheduler"
 	apiManager "hydrogen/scheduler/api/manager"
 	"hydrogen/scheduler/api/v1"
+	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
+	"hydrogen/task/persistence"
+	"mesos-framework-sdk/scheduler"
+	"sync"
 )
 
 // API server provides an interface for users to interact with the core scheduler.
 type ApiServer struct {
-	cfg     *sched.Configuration
-	manager apiManager.ApiParser
-	logger  logging.Logger
+	cfg       *sched.Configuration
+	manager   apiManager.ApiParser
+	storage   persistence.Storage
+	ha        *ha.HA
+	status    *status.Status
+	scheduler scheduler.Scheduler
+	logger    logging.Logger
+	keys      map[string]*keyLock // Idempotency keys that requests are currently using.
+	keysMutex sync.Mutex
 }
 
 // Returns a new API server injected with the necessary components.
-func NewApiServer(cfg *sched.Configuration, mgr apiManager.ApiParser, lgr logging.Logger) *ApiServer {
+func NewApiServer(
+	cfg *sched.Configuration,
+	mgr apiManager.ApiParser,
+	storage persistence.Storage,
+	ha *ha.HA,
+	st *status.Status,
+	s scheduler.Scheduler,
+	lgr logging.Logger) *ApiServer {
+
 	return &ApiServer{
-		cfg:     cfg,
-		manager: mgr,
-		logger:  lgr,
+		cfg:       cfg,
+		manager:   mgr,
+		storage:   storage,
+		ha:        ha,
+		status:    st,
+		scheduler: s,
+		logger:    lgr,
+		keys:      make(map[string]*keyLock),
 	}
 }
 
@@ -44,21 +68,36 @@ func NewApiServer(cfg *sched.Configuration, mgr apiManager.ApiParser, lgr loggin
 func (a *ApiServer) applyRoute(path string, route v1.Route) {
 	mux := a.cfg.APIServer.Server.Mux()
 
+	handler := route.Handler
+	if route.Idempotent {
+		handler = a.idempotent(handler)
+	}
+
+	// Standbys send requests on to the leader before anything else happens.
+	if route.Leader {
+		handler = a.leaderOnly(handler)
+	}
+
 	// Apply middleware to determine if the HTTP method is allowed or not for each endpoint.
 	mux.HandleFunc(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for _, method := range route.Methods {
 			if method == r.Method {
-				route.Handler(w, r)
+				handler(w, r)
 			}
 		}
 	}))
 }
 
 // Detects the API version to be used and registers the handlers to the server.
+// Health checks and metrics don't depend on the version.
 func (a *ApiServer) applyRoutes(version string) {
+	a.applyRoute("/health", v1.Route{Handler: a.health, Methods: []string{"GET"}})
+	a.applyRoute("/ready", v1.Route{Handler: a.ready, Methods: []string{"GET"}})
+	a.applyRoute("/metrics", v1.Route{Handler: a.metrics, Methods: []string{"GET"}})
+
 	switch version {
 	case "v1":
-		routes := v1.MapRoutes(v1.NewHandlers(a.manager))
+		routes := v1.MapRoutes(v1.NewHandlers(a.manager, a.ha, a.status, a.cfg, a.scheduler))
 		for path, route := range routes {
 			a.applyRoute(path, route)
 		}
@@ -17,9 +17,21 @@ package api
 import (
 	"errors"
 	mockLogger "mesos-framework-sdk/logging/test"
+	sched "mesos-framework-sdk/scheduler/test"
 	"hydrogen/scheduler"
 	mockApiManager "hydrogen/scheduler/api/manager/test"
+	"hydrogen/scheduler/api/v1"
+	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
+	mockStorage "hydrogen/task/persistence/test"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type brokenReader struct{}
@@ -32,12 +44,262 @@ var (
 	c      = new(scheduler.Configuration)
 	l      = new(mockLogger.MockLogger)
 	apiMgr = new(mockApiManager.MockApiManager)
+	s      = new(mockStorage.MockStorage)
+	h      = ha.NewHA(s, l, &scheduler.LeaderConfiguration{})
+	st     = status.New()
 )
 
+// Keeps whatever is written to it so results can be read back.
+type memoryStorage struct {
+	mockStorage.MockStorage
+	sync.Mutex
+	data map[string]string
+}
+
+func (m *memoryStorage) CreateWithLease(key, value string, ttl int64) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.data[key] = value
+
+	return 0, nil
+}
+
+func (m *memoryStorage) Read(key string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.data[key], nil
+}
+
+// Fails every read, as storage does while it's unreachable.
+type unreadableStorage struct {
+	memoryStorage
+}
+
+func (u *unreadableStorage) Read(key string) (string, error) {
+	return "", errors.New("Storage is unreachable")
+}
+
 // Ensures all components are set correctly when creating the API server.
 func TestNewApiServer(t *testing.T) {
-	srv := NewApiServer(c, apiMgr, l)
-	if srv.cfg != c || srv.manager != apiMgr || srv.logger != l {
+	srv := NewApiServer(c, apiMgr, s, h, st, sched.MockScheduler{}, l)
+	if srv.cfg != c || srv.manager != apiMgr || srv.storage != s || srv.ha != h || srv.status != st || srv.logger != l {
 		t.Fatal("API does not contain the correct components")
 	}
 }
+
+// Ensures requests with an idempotency key are only executed once and replayed afterwards.
+func TestApiServer_Idempotent(t *testing.T) {
+	cfg := &scheduler.Configuration{APIServer: &scheduler.ApiConfiguration{IdempotencyTTL: time.Hour}}
+	srv := NewApiServer(cfg, apiMgr, &memoryStorage{data: make(map[string]string)}, h, st, sched.MockScheduler{}, l)
+
+	calls := 0
+	handler := srv.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		v1.Success(w, v1.Response{Message: "Deployed"})
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/api/app", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotencyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		return rec
+	}
+
+	first := send("abc", `[{"name":"test"}]`)
+	second := send("abc", `[{"name":"test"}]`)
+	if calls != 1 {
+		t.Fatalf("Handler should only run once, ran %d times", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Fatal("Retried request should replay the original response")
+	}
+	if second.Header().Get(replayedHeader) != "true" {
+		t.Fatal("Replayed response should be marked as such")
+	}
+
+	if rec := send("abc", `[{"name":"other"}]`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Reusing a key for a different request should be rejected, got %d", rec.Code)
+	}
+
+	send("", `[{"name":"test"}]`)
+	send("", `[{"name":"test"}]`)
+	if calls != 3 {
+		t.Fatalf("Requests without a key should always run, ran %d times", calls)
+	}
+}
+
+// Ensures server errors aren't persisted so that retries are executed again.
+func TestApiServer_IdempotentServerError(t *testing.T) {
+	cfg := &scheduler.Configuration{APIServer: &scheduler.ApiConfiguration{IdempotencyTTL: time.Hour}}
+	srv := NewApiServer(cfg, apiMgr, &memoryStorage{data: make(map[string]string)}, h, st, sched.MockScheduler{}, l)
+
+	calls := 0
+	handler := srv.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		v1.InternalServerError(w, v1.Response{Message: "Failed"})
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodDelete, "/v1/api/app", strings.NewReader(`{"name":"test"}`))
+		req.Header.Set(idempotencyHeader, "abc")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	if calls != 2 {
+		t.Fatalf("Server errors should not be replayed, handler ran %d times", calls)
+	}
+}
+
+// Ensures requests aren't executed when we can't tell whether they already were.
+func TestApiServer_IdempotentStorageFailure(t *testing.T) {
+	cfg := &scheduler.Configuration{APIServer: &scheduler.ApiConfiguration{IdempotencyTTL: time.Hour}}
+	srv := NewApiServer(cfg, apiMgr, &unreadableStorage{memoryStorage{data: make(map[string]string)}}, h, st, sched.MockScheduler{}, l)
+
+	calls := 0
+	handler := srv.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		v1.Success(w, v1.Response{Message: "Deployed"})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/api/app", strings.NewReader(`[{"name":"test"}]`))
+	req.Header.Set(idempotencyHeader, "abc")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if calls != 0 {
+		t.Fatal("The request shouldn't run when its key can't be looked up")
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a retryable %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+// Ensures standbys redirect requests that change state to the leader.
+func TestApiServer_LeaderOnlyRedirect(t *testing.T) {
+	cfg := &scheduler.Configuration{
+		Leader:    &scheduler.LeaderConfiguration{IP: "2"},
+		APIServer: &scheduler.ApiConfiguration{Port: 8080, StandbyMode: standbyRedirect},
+	}
+	standby := ha.NewHA(s, l, cfg.Leader) // Mock storage always reports "1" as the leader.
+	srv := NewApiServer(cfg, apiMgr, s, standby, st, sched.MockScheduler{}, l)
+
+	calls := 0
+	handler := srv.leaderOnly(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v1/api/app?dry_run=true", strings.NewReader("[]")))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusTemporaryRedirect, rec.Code)
+	}
+	if location := rec.Header().Get("Location"); location != "http://1:8080/v1/api/app?dry_run=true" {
+		t.Fatalf("Redirected to the wrong location: %s", location)
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/api/app?name=test", nil))
+	if calls != 1 {
+		t.Fatal("Standbys should serve reads themselves")
+	}
+}
+
+// Ensures standbys can proxy requests that change state to the leader.
+func TestApiServer_LeaderOnlyProxy(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v1.Success(w, v1.Response{Message: "Served by the leader"})
+	}))
+	defer leader.Close()
+
+	u, err := url.Parse(leader.URL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	storage := &memoryStorage{data: map[string]string{"/leader": u.Hostname()}}
+	cfg := &scheduler.Configuration{
+		Leader:    &scheduler.LeaderConfiguration{IP: "2"},
+		APIServer: &scheduler.ApiConfiguration{Port: port, StandbyMode: standbyProxy},
+	}
+	srv := NewApiServer(cfg, apiMgr, storage, ha.NewHA(storage, l, cfg.Leader), st, sched.MockScheduler{}, l)
+
+	handler := srv.leaderOnly(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Standbys should not serve requests that change state")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/v1/api/app", strings.NewReader(`{"name":"test"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Served by the leader") {
+		t.Fatalf("Request wasn't proxied to the leader: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// Ensures the leader serves every request itself.
+func TestApiServer_LeaderOnlyLeading(t *testing.T) {
+	cfg := &scheduler.Configuration{
+		Leader:    &scheduler.LeaderConfiguration{IP: "1"},
+		APIServer: &scheduler.ApiConfiguration{},
+	}
+	leader := ha.NewHA(s, l, cfg.Leader)
+	leader.Election()
+	leader.StartLeading()
+	srv := NewApiServer(cfg, apiMgr, s, leader, st, sched.MockScheduler{}, l)
+
+	calls := 0
+	handler := srv.leaderOnly(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/api/app", strings.NewReader("[]")))
+
+	if calls != 1 {
+		t.Fatal("The leader should serve requests that change state")
+	}
+}
+
+// Ensures the liveness check always passes.
+func TestApiServer_Health(t *testing.T) {
+	srv := NewApiServer(c, apiMgr, s, h, st, sched.MockScheduler{}, l)
+
+	rec := httptest.NewRecorder()
+	srv.health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rec.Code)
+	}
+}
+
+// Ensures only a subscribed leader is ready.
+func TestApiServer_Ready(t *testing.T) {
+	cfg := &scheduler.Configuration{Leader: &scheduler.LeaderConfiguration{IP: "1"}}
+	leader := ha.NewHA(s, l, cfg.Leader)
+	st := status.New()
+	srv := NewApiServer(cfg, apiMgr, s, leader, st, sched.MockScheduler{}, l)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		srv.ready(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("A standby shouldn't be ready, got %d", code)
+	}
+
+	leader.Election()
+	leader.StartLeading()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("A leader that isn't subscribed shouldn't be ready, got %d", code)
+	}
+
+	st.SetSubscribed(true)
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("A subscribed leader should be ready, got %d", code)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"hydrogen/scheduler/api/v1"
+	"net/http"
+	"strings"
+)
+
+// Liveness check, answering at all means the process is alive.
+func (a *ApiServer) health(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		v1.Success(w, v1.Response{Message: "Alive."})
+	default:
+		v1.MethodNotAllowed(w, v1.Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// Readiness check, only the leader that's subscribed to Mesos and can reach persistent storage is ready.
+// Every reason for not being ready is reported.
+func (a *ApiServer) ready(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		problems := []string{}
+		if !a.ha.IsLeader() {
+			problems = append(problems, "This scheduler is not the leader.")
+		}
+		if !a.status.Subscribed() {
+			problems = append(problems, "This scheduler is not subscribed to Mesos.")
+		}
+		if _, err := a.ha.GetLeader(); err != nil {
+			problems = append(problems, "Persistent storage is unreachable: "+err.Error())
+		}
+
+		if len(problems) > 0 {
+			v1.ServiceUnavailable(w, v1.Response{Message: strings.Join(problems, " ")})
+			return
+		}
+
+		v1.Success(w, v1.Response{Message: "Ready."})
+	default:
+		v1.MethodNotAllowed(w, v1.Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
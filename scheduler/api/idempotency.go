@@ -0,0 +1,209 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hydrogen/scheduler/api/v1"
+	"io/ioutil"
+	"mesos-framework-sdk/logging"
+	"net/http"
+	"sync"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	replayedHeader       = "Idempotent-Replayed"
+	idempotencyDirectory = "/idempotency/"
+)
+
+type (
+	// The outcome of a request made with an idempotency key.
+	// Stored so that retries of the same request get the same answer instead of being executed again.
+	idempotentResult struct {
+		Fingerprint string `json:"fingerprint"`
+		Status      int    `json:"status"`
+		Body        []byte `json:"body"`
+	}
+
+	// Serializes requests that share an idempotency key.
+	keyLock struct {
+		sync.Mutex
+		refs int
+	}
+
+	// Captures a response so it can be persisted before being sent to the client.
+	responseRecorder struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// Wraps a handler so that mutating requests carrying an idempotency key are only executed once.
+// Retries with the same key replay the original response for as long as it's persisted.
+func (a *ApiServer) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" || r.Method == http.MethodGet {
+			handler(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			v1.BadRequest(w, v1.Response{Message: err.Error()})
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		unlock := a.lockKey(key)
+		defer unlock()
+
+		storageKey := idempotencyDirectory + digest([]byte(key))
+		fingerprint := digest([]byte(r.Method + " " + r.URL.String() + "\n" + string(body)))
+
+		// Without knowing whether the request already ran, running it again could repeat it.
+		result, err := a.readResult(storageKey)
+		if err != nil {
+			a.logger.Emit(logging.ERROR, "Failed to look up idempotent result %s: %s", storageKey, err.Error())
+			v1.ServiceUnavailable(w, v1.Response{
+				Message: "Can't tell if the request with " + idempotencyHeader + " " + key + " already ran, retry it later.",
+			})
+			return
+		}
+		if result != nil {
+			if result.Fingerprint != fingerprint {
+				v1.UnprocessableEntity(w, v1.Response{
+					Message: idempotencyHeader + " " + key + " was already used for a different request.",
+				})
+				return
+			}
+
+			w.Header().Set(replayedHeader, "true")
+			w.WriteHeader(result.Status)
+			w.Write(result.Body)
+			return
+		}
+
+		rec := &responseRecorder{header: w.Header(), status: http.StatusOK}
+		handler(rec, r)
+
+		// Server errors are worth retrying for real, so they're never replayed.
+		if rec.status < http.StatusInternalServerError {
+			a.writeResult(storageKey, &idempotentResult{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Body:        rec.body.Bytes(),
+			})
+		}
+
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	}
+}
+
+// Gets a previously persisted result, nil if there isn't one.
+// Failing to read it is an error, rather than being taken for a result that was never persisted.
+func (a *ApiServer) readResult(key string) (*idempotentResult, error) {
+	var data string
+	err := a.storage.RunPolicy(a.storage.CheckPolicy(nil), func() error {
+		var err error
+		data, err = a.storage.Read(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	result := new(idempotentResult)
+	if err := json.Unmarshal([]byte(data), result); err != nil {
+		// A result we can't make sense of is no use to replay, so the request runs again.
+		a.logger.Emit(logging.ERROR, "Failed to decode idempotent result %s: %s", key, err.Error())
+		return nil, nil
+	}
+
+	return result, nil
+}
+
+// Persists a result so that it expires on its own once the configured TTL has passed.
+func (a *ApiServer) writeResult(key string, result *idempotentResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		a.logger.Emit(logging.ERROR, "Failed to encode idempotent result %s: %s", key, err.Error())
+		return
+	}
+
+	ttl := int64(a.cfg.APIServer.IdempotencyTTL.Seconds())
+	policy := a.storage.CheckPolicy(nil)
+	err = a.storage.RunPolicy(policy, func() error {
+		_, err := a.storage.CreateWithLease(key, string(data), ttl)
+		return err
+	})
+	if err != nil {
+		a.logger.Emit(logging.ERROR, "Failed to persist idempotent result %s: %s", key, err.Error())
+	}
+}
+
+// Blocks until no other request holds the given key.
+// The returned function releases the key.
+func (a *ApiServer) lockKey(key string) func() {
+	a.keysMutex.Lock()
+	l, ok := a.keys[key]
+	if !ok {
+		l = new(keyLock)
+		a.keys[key] = l
+	}
+	l.refs++
+	a.keysMutex.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		a.keysMutex.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(a.keys, key)
+		}
+		a.keysMutex.Unlock()
+	}
+}
+
+// Hex encoded SHA-256 of the data.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
@@ -15,15 +15,25 @@
 package manager
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	sched "hydrogen/scheduler"
 	r "mesos-framework-sdk/resources/manager"
 	"mesos-framework-sdk/scheduler"
 	"mesos-framework-sdk/task"
 	t "mesos-framework-sdk/task/manager"
 	"hydrogen/task/builder"
+	tm "hydrogen/task/manager"
+	"hydrogen/task/placement"
+	"hydrogen/task/volumes"
+	"strconv"
+	"strings"
 )
 
+var NoInstancesError = errors.New("At least one instance is required.")
+var SpreadKeyError = errors.New("No agent we're offered has a fault domain to spread across. Please set a strategy key.")
+
 type (
 	ApiParser interface {
 		Deploy([]byte) ([]*t.Task, error)
@@ -31,29 +41,34 @@ type (
 		Update([]byte) ([]*t.Task, error)
 		Status(string) (*t.Task, error)
 		AllTasks() ([]*t.Task, error)
+		Validate([]byte, bool) *Validation
 	}
 
 	Parser struct {
 		//		ctrlPlane       control.ControlPlane
 		resourceManager r.ResourceManager
-		taskManager     t.TaskManager
+		taskManager     tm.TaskManager
+		reservations    *volumes.Reservations
 		scheduler       scheduler.Scheduler
+		config          *sched.ApiConfiguration
 	}
 )
 
 // NewApiParser returns an object that marshalls JSON and handles the input from the API endpoints.
-func NewApiParser(r r.ResourceManager, t t.TaskManager, s scheduler.Scheduler) *Parser {
+func NewApiParser(r r.ResourceManager, t tm.TaskManager, v *volumes.Reservations, s scheduler.Scheduler, c *sched.ApiConfiguration) *Parser {
 	return &Parser{
 		resourceManager: r,
 		taskManager:     t,
+		reservations:    v,
 		scheduler:       s,
+		config:          c,
 	}
 }
 
 // Deploy takes a slice of bytes and marshals them into a Application json struct.
 func (m *Parser) Deploy(decoded []byte) ([]*t.Task, error) {
-	var appJSON []*task.ApplicationJSON
-	err := json.Unmarshal(decoded, &appJSON)
+	var appJSON []*builder.ApplicationJSON
+	err := decodeStrict(decoded, &appJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -67,19 +82,41 @@ func (m *Parser) Deploy(decoded []byte) ([]*t.Task, error) {
 		return nil, err
 	}
 
+	instances := 0
+	for _, app := range appJSON {
+		if app.Instances < 1 {
+			return nil, NoInstancesError
+		}
+		if err := m.checkSpread(app); err != nil {
+			return nil, err
+		}
+		instances += app.Instances
+	}
+
+	err = m.checkQuota(instances)
+	if err != nil {
+		return nil, err
+	}
+
 	err = m.taskManager.Add(mesosTasks...)
 	if err != nil {
 		return nil, err
 	}
 
+	// Only report the deployment once it would survive a failover.
+	err = m.taskManager.Flush()
+	if err != nil {
+		return nil, err
+	}
+
 	m.scheduler.Revive()
 	return mesosTasks, nil
 }
 
 // Update takes a slice of bytes and marshalls them into an ApplicationJSON struct.
 func (m *Parser) Update(decoded []byte) ([]*t.Task, error) {
-	var appJSON task.ApplicationJSON
-	err := json.Unmarshal(decoded, &appJSON)
+	var appJSON builder.ApplicationJSON
+	err := decodeStrict(decoded, &appJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -89,13 +126,30 @@ func (m *Parser) Update(decoded []byte) ([]*t.Task, error) {
 		return nil, err
 	}
 
+	if appJSON.Instances < 1 {
+		return nil, NoInstancesError
+	}
+	if err := m.checkSpread(&appJSON); err != nil {
+		return nil, err
+	}
+
 	mesosTask, err := builder.Application(&appJSON)
 	if err != nil {
 		return nil, err
 	}
 
+	// The application's current instances are replaced, so only the ones it gains count against the quota.
+	err = m.checkQuota(appJSON.Instances - taskToKill.Instances)
+	if err != nil {
+		return nil, err
+	}
+
 	m.scheduler.Kill(taskToKill.Info.GetTaskId(), taskToKill.Info.GetAgentId())
 	m.taskManager.Add(mesosTask...)
+	err = m.taskManager.Flush()
+	if err != nil {
+		return nil, err
+	}
 	m.scheduler.Revive()
 
 	return mesosTask, nil
@@ -104,7 +158,7 @@ func (m *Parser) Update(decoded []byte) ([]*t.Task, error) {
 // Kill takes a slice of bytes and marshalls them into a kill json struct.
 func (m *Parser) Kill(decoded []byte) (string, error) {
 	var appJSON task.KillJson
-	err := json.Unmarshal(decoded, &appJSON)
+	err := decodeStrict(decoded, &appJSON)
 	if err != nil {
 		return "", err
 	}
@@ -120,11 +174,26 @@ func (m *Parser) Kill(decoded []byte) (string, error) {
 		return "", err
 	}
 
+	// Deleting a task is the only way its volume is destroyed, which happens once we're offered the agent holding it.
+	if placement.Of(tsk).Volume != nil {
+		err = m.reservations.Release(*appJSON.Name)
+		if err != nil {
+			return "", err
+		}
+		m.scheduler.Revive()
+	}
+
 	err = m.taskManager.Delete(tsk)
 	if err != nil {
 		return "", err
 	}
 
+	// The task is only killed once it's gone from storage, so that a new leader won't launch it again.
+	err = m.taskManager.Flush()
+	if err != nil {
+		return "", err
+	}
+
 	// If we are "unknown" that means the master doesn't know about the task, no need to make an HTTP call.
 	if tsk.State != t.UNKNOWN {
 		_, err := m.scheduler.Kill(tsk.Info.GetTaskId(), tsk.Info.GetAgentId())
@@ -153,3 +222,43 @@ func (m *Parser) AllTasks() ([]*t.Task, error) {
 
 	return tasks, nil
 }
+
+// Decodes JSON into v and rejects any field that v doesn't declare, so typos don't silently fall back to defaults.
+// The schema served by the API is generated from these same types and forbids additional properties as well.
+func decodeStrict(decoded []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(decoded))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
+
+// Makes sure that adding the given number of tasks won't push us past the configured quota.
+func (m *Parser) checkQuota(instances int) error {
+	if m.config.MaxTasks <= 0 {
+		return nil
+	}
+
+	total := m.taskManager.TotalTasks() + instances
+	if total > m.config.MaxTasks {
+		return errors.New("Deploying " + strconv.Itoa(instances) + " more tasks would exceed the quota of " +
+			strconv.Itoa(m.config.MaxTasks) + " tasks")
+	}
+
+	return nil
+}
+
+// Makes sure a spread strategy has something to spread across.
+// Fault domain zones are spread across unless a key is given, which agents without one are never used for.
+func (m *Parser) checkSpread(app *builder.ApplicationJSON) error {
+	if strings.ToLower(app.Strategy.Type) != placement.SPREAD || app.Strategy.Key != "" {
+		return nil
+	}
+
+	for _, offer := range m.resourceManager.Offers() {
+		if offer.GetDomain().GetFaultDomain().GetZone().GetName() != "" {
+			return nil
+		}
+	}
+
+	return SpreadKeyError
+}
@@ -15,17 +15,26 @@
 package manager
 
 import (
+	"errors"
+	sched "hydrogen/scheduler"
 	"mesos-framework-sdk/include/mesos_v1"
 	k "mesos-framework-sdk/resources/manager/test"
 	s "mesos-framework-sdk/scheduler/test"
+	taskManager "hydrogen/task/manager"
 	"hydrogen/task/manager/test"
+	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/utils"
 	"testing"
 )
 
+var cfg = &sched.ApiConfiguration{}
+var reservations = volumes.NewReservations(&mockStorage.MockStorage{})
+
 // Generate valid and invalid JSON
 
 func TestNewApiParser(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	if api.resourceManager == nil || api.scheduler == nil || api.taskManager == nil {
 		t.Logf("Expected instances to be set %v\n", api)
 		t.Fail()
@@ -33,7 +42,7 @@ func TestNewApiParser(t *testing.T) {
 }
 
 func TestParser_DeployNoHealthCheck(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `[{"name": "test",
 	"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -53,7 +62,7 @@ func TestParser_DeployNoHealthCheck(t *testing.T) {
 }
 
 func TestParser_DeployWithTCPHealthCheck(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `[{"name": "test",
 	"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -88,7 +97,7 @@ func TestParser_DeployWithTCPHealthCheck(t *testing.T) {
 }
 
 func TestParser_DeployWithNoName(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	invalidJSON := `{"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
 	"command": {"cmd": "echo hello"}`
@@ -100,7 +109,7 @@ func TestParser_DeployWithNoName(t *testing.T) {
 }
 
 func TestParser_DeployWithNoResources(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	invalidJSON := `{"name": "no-resources",
 	"instances": 1,
 	"command": {"cmd": "echo hello"}`
@@ -112,7 +121,7 @@ func TestParser_DeployWithNoResources(t *testing.T) {
 }
 
 func TestParser_DeployWithCNINetwork(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `[{"name": "tester",
 	"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -131,7 +140,7 @@ func TestParser_DeployWithCNINetwork(t *testing.T) {
 }
 
 func TestParser_DeployWithIPNetwork(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `[{"name": "tester",
 	"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -180,7 +189,7 @@ func TestParser_DeployWithIPNetwork(t *testing.T) {
 }
 
 func TestParser_Kill(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `{"name": "test"}`
 	status, err := api.Kill([]byte(validJSON))
 	if err != nil {
@@ -197,8 +206,36 @@ func TestParser_Kill(t *testing.T) {
 	}
 }
 
+// Holds tasks, but fails to persist any change to them.
+type unflushableTaskManager struct {
+	test.MockTaskManager
+}
+
+func (u unflushableTaskManager) Flush() error {
+	return errors.New("Not persisted")
+}
+
+// Changes aren't reported as made until they're persisted.
+func TestParser_Unpersisted(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, unflushableTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	if _, err := api.Kill([]byte(`{"name": "test"}`)); err == nil {
+		t.Fatal("Kill should fail when the delete isn't persisted")
+	}
+
+	app := `{"name": "test",
+	"instances": 1,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}`
+	if _, err := api.Update([]byte(app)); err == nil {
+		t.Fatal("Update should fail when the new task isn't persisted")
+	}
+	if _, err := api.Deploy([]byte("[" + app + "]")); err == nil {
+		t.Fatal("Deploy should fail when the new task isn't persisted")
+	}
+}
+
 func TestParser_KillFail(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `{"junk":"value"}`
 	status, err := api.Kill([]byte(validJSON))
 	if err == nil {
@@ -211,7 +248,7 @@ func TestParser_KillFail(t *testing.T) {
 }
 
 func TestParser_AllTasks(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	tasks, err := api.AllTasks()
 	if err != nil {
 		t.Logf("Failed %v\n", err)
@@ -224,7 +261,7 @@ func TestParser_AllTasks(t *testing.T) {
 }
 
 func TestParser_Update(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	validJSON := `{"name": "test",
 	"instances": 1,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -240,7 +277,7 @@ func TestParser_Update(t *testing.T) {
 }
 
 func TestParser_Status(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	task, err := api.Status("test")
 	if err != nil {
 		t.Logf("Failed on status update %v\n", task.State.String())
@@ -253,7 +290,7 @@ func TestParser_Status(t *testing.T) {
 }
 
 func TestParser_DeployMultiInstance(t *testing.T) {
-	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, s.MockScheduler{})
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
 	multiInstance := `[{"name": "test",
 	"instances": 5,
 	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
@@ -265,3 +302,167 @@ func TestParser_DeployMultiInstance(t *testing.T) {
 	}
 
 }
+
+func TestParser_Validate(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockBrokenTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	validJSON := `[{"name": "test",
+	"instances": 1,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}]`
+	v := api.Validate([]byte(validJSON), false)
+	if !v.Valid {
+		t.Logf("Expected the application to be valid, got errors %v", v.Errors)
+		t.Fail()
+	}
+}
+
+func TestParser_ValidateInvalid(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockBrokenTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	invalidJSON := `[{"name": "test",
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}},
+	{"name": "test", "instances": 1, "command": {"cmd": "echo hello"}}]`
+	v := api.Validate([]byte(invalidJSON), false)
+	if v.Valid {
+		t.Log("Expected the applications to be invalid")
+		t.FailNow()
+	}
+
+	paths := map[string]bool{}
+	for _, e := range v.Errors {
+		paths[e.Path] = true
+	}
+	for _, path := range []string{"$[0].instances", "$[1].name", "$[1].resources"} {
+		if !paths[path] {
+			t.Logf("Expected an error for %s, got %v", path, v.Errors)
+			t.Fail()
+		}
+	}
+
+	v = api.Validate([]byte(`not even json`), false)
+	if v.Valid || len(v.Errors) != 1 {
+		t.Logf("Expected a single error for junk input, got %v", v.Errors)
+		t.Fail()
+	}
+}
+
+func TestParser_ValidateDuplicate(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	validJSON := `[{"name": "test",
+	"instances": 2,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}]`
+	v := api.Validate([]byte(validJSON), false)
+	if v.Valid {
+		t.Log("Expected existing tasks to be reported as duplicates")
+		t.Fail()
+	}
+
+	// Updates need the application to already exist.
+	validJSON = `{"name": "test",
+	"instances": 1,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}`
+	v = api.Validate([]byte(validJSON), true)
+	if !v.Valid {
+		t.Logf("Expected the update to be valid, got errors %v", v.Errors)
+		t.Fail()
+	}
+}
+
+func TestParser_ValidateQuota(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockBrokenTaskManager{}, reservations, s.MockScheduler{},
+		&sched.ApiConfiguration{MaxTasks: 2})
+	validJSON := `[{"name": "test",
+	"instances": 3,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}]`
+	v := api.Validate([]byte(validJSON), false)
+	if v.Valid {
+		t.Log("Expected the quota to be exceeded")
+		t.Fail()
+	}
+
+	if _, err := api.Deploy([]byte(validJSON)); err == nil {
+		t.Log("Expected deploying past the quota to fail")
+		t.Fail()
+	}
+
+	// Updates count the instances they add too.
+	api = NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{},
+		&sched.ApiConfiguration{MaxTasks: 2})
+	updateJSON := validJSON[1 : len(validJSON)-1]
+	if v := api.Validate([]byte(updateJSON), true); v.Valid {
+		t.Log("Expected the quota to be exceeded by the update")
+		t.Fail()
+	}
+	if _, err := api.Update([]byte(updateJSON)); err == nil {
+		t.Log("Expected updating past the quota to fail")
+		t.Fail()
+	}
+}
+
+// Deploying what the dry run rejects fails too.
+func TestParser_DeployNoInstances(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	app := `{"name": "test",
+	"instances": 0,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}`
+	if v := api.Validate([]byte("["+app+"]"), false); v.Valid {
+		t.Fatal("Expected the dry run to require an instance")
+	}
+	if _, err := api.Deploy([]byte("[" + app + "]")); err != NoInstancesError {
+		t.Fatalf("Expected deploying without instances to fail, got %v", err)
+	}
+	if _, err := api.Update([]byte(app)); err != NoInstancesError {
+		t.Fatalf("Expected updating to no instances to fail, got %v", err)
+	}
+}
+
+func TestParser_DeployWithUnknownField(t *testing.T) {
+	api := NewApiParser(k.MockResourceManager{}, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	typoJSON := `[{"name": "test",
+	"instance": 3,
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}]`
+	if _, err := api.Deploy([]byte(typoJSON)); err == nil {
+		t.Log("Expected an unknown field to be rejected")
+		t.Fail()
+	}
+
+	v := api.Validate([]byte(typoJSON), false)
+	if v.Valid {
+		t.Log("Expected validation to reject an unknown field")
+		t.Fail()
+	}
+}
+
+// Spreading across zones needs agents that are in one.
+func TestParser_DeploySpread(t *testing.T) {
+	resources := taskManager.NewResourceManager(nil)
+	api := NewApiParser(resources, test.MockTaskManager{}, reservations, s.MockScheduler{}, cfg)
+	app := `[{"name": "test",
+	"instances": 2,
+	"strategy": {"type": "spread"},
+	"resources": {"cpu": 0.5, "mem": 128.0, "disk": {"size": 1024.0}},
+	"command": {"cmd": "echo hello"}}]`
+	if v := api.Validate([]byte(app), false); v.Valid || v.Errors[0].Path != "$[0].strategy.key" {
+		t.Fatalf("Expected the dry run to require a key, got %v", v.Errors)
+	}
+	if _, err := api.Deploy([]byte(app)); err != SpreadKeyError {
+		t.Fatalf("Expected spreading without a key or fault domains to fail, got %v", err)
+	}
+
+	resources.AddOffers([]*mesos_v1.Offer{{
+		Id:      &mesos_v1.OfferID{Value: utils.ProtoString("1")},
+		AgentId: &mesos_v1.AgentID{Value: utils.ProtoString("a")},
+		Domain: &mesos_v1.DomainInfo{FaultDomain: &mesos_v1.DomainInfo_FaultDomain{
+			Region: &mesos_v1.DomainInfo_FaultDomain_RegionInfo{Name: utils.ProtoString("east")},
+			Zone:   &mesos_v1.DomainInfo_FaultDomain_ZoneInfo{Name: utils.ProtoString("a")},
+		}},
+	}})
+	if _, err := api.Deploy([]byte(app)); err != nil {
+		t.Fatalf("Expected zones to be spread across once agents are in one, got %v", err)
+	}
+}
@@ -16,6 +16,8 @@ package test
 
 import (
 	"errors"
+	apiManager "hydrogen/scheduler/api/manager"
+	"hydrogen/task/builder"
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/task"
 	"mesos-framework-sdk/task/manager"
@@ -50,6 +52,10 @@ func (m MockApiManager) AllTasks() ([]*manager.Task, error) {
 		manager.GroupInfo{})}, nil
 }
 
+func (m MockApiManager) Validate([]byte, bool) *apiManager.Validation {
+	return &apiManager.Validation{Valid: true}
+}
+
 func (m MockBrokenApiManager) Deploy([]byte) ([]*manager.Task, error) {
 	return nil, errors.New("Broken")
 }
@@ -63,3 +69,6 @@ func (m MockBrokenApiManager) Status(string) (*manager.Task, error) {
 func (m MockBrokenApiManager) AllTasks() ([]*manager.Task, error) {
 	return nil, errors.New("Broken")
 }
+func (m MockBrokenApiManager) Validate([]byte, bool) *apiManager.Validation {
+	return &apiManager.Validation{Errors: []builder.FieldError{{Path: "$", Message: "Broken"}}}
+}
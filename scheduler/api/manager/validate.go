@@ -0,0 +1,156 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"hydrogen/task/builder"
+	taskManager "hydrogen/task/manager"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task"
+	taskResources "mesos-framework-sdk/task/resources"
+	"strconv"
+)
+
+// Result of checking application definitions without deploying them.
+// Errors would cause a deployment to be rejected.
+// Warnings point out things that would be accepted but may never launch, such as resources no offer can satisfy.
+type Validation struct {
+	Valid    bool                 `json:"valid"`
+	Errors   []builder.FieldError `json:"errors,omitempty"`
+	Warnings []builder.FieldError `json:"warnings,omitempty"`
+}
+
+// Validate checks application definitions without queueing anything.
+// Deployments are expected to be a list of applications, while updates are a single application.
+// Every problem found is reported instead of stopping at the first one.
+func (m *Parser) Validate(decoded []byte, update bool) *Validation {
+	v := &Validation{}
+
+	var apps []*builder.ApplicationJSON
+	var roots []string
+	if update {
+		var app builder.ApplicationJSON
+		if err := decodeStrict(decoded, &app); err != nil {
+			return v.fail("$", err.Error())
+		}
+		apps = append(apps, &app)
+		roots = append(roots, "$")
+	} else {
+		if err := decodeStrict(decoded, &apps); err != nil {
+			return v.fail("$", err.Error())
+		}
+		if len(apps) == 0 {
+			return v.fail("$", "No valid application passed in.")
+		}
+		for i := range apps {
+			roots = append(roots, "$["+strconv.Itoa(i)+"]")
+		}
+	}
+
+	seen := make(map[string]string)
+	instances := 0
+	for i, app := range apps {
+		root := roots[i]
+		v.Errors = append(v.Errors, builder.Validate(root, app)...)
+		v.Warnings = append(v.Warnings, builder.Deprecations(root, app)...)
+
+		if app.Instances < 1 {
+			v.addError(root+".instances", NoInstancesError.Error())
+		}
+		if err := m.checkSpread(app); err != nil {
+			v.addError(root+".strategy.key", err.Error())
+		}
+		instances += app.Instances
+
+		if app.Name != "" {
+			if other, ok := seen[app.Name]; ok {
+				v.addError(root+".name", "Application "+app.Name+" is also defined at "+other+".")
+			}
+			seen[app.Name] = root
+
+			if update {
+				if existing, err := m.taskManager.Get(&app.Name); err != nil {
+					v.addError(root+".name", "Application "+app.Name+" does not exist.")
+				} else {
+					instances -= existing.Instances // They're replaced.
+				}
+			} else {
+				for _, name := range instanceNames(app) {
+					if _, err := m.taskManager.Get(&name); err == nil {
+						v.addError(root+".name", "Task "+name+" already exists.")
+					}
+				}
+			}
+		}
+
+		if app.Resources != nil {
+			res, err := taskResources.ParseResources(app.Resources)
+			if err == nil && !m.canBeOffered(res, app.Filters) {
+				v.addWarning(root+".resources", "No offer currently held by the scheduler can satisfy "+
+					"the requested resources and filters.")
+			}
+		}
+	}
+
+	if err := m.checkQuota(instances); err != nil {
+		v.addError("$", err.Error())
+	}
+
+	v.Valid = len(v.Errors) == 0
+
+	return v
+}
+
+func (v *Validation) addError(path, message string) {
+	v.Errors = append(v.Errors, builder.FieldError{Path: path, Message: message})
+}
+
+func (v *Validation) addWarning(path, message string) {
+	v.Warnings = append(v.Warnings, builder.FieldError{Path: path, Message: message})
+}
+
+// Marks the validation as failed with a single error.
+func (v *Validation) fail(path, message string) *Validation {
+	v.addError(path, message)
+	v.Valid = false
+
+	return v
+}
+
+// Names of the tasks that the task manager will create for the given application.
+func instanceNames(app *builder.ApplicationJSON) []string {
+	if app.Instances <= 1 {
+		return []string{app.Name}
+	}
+
+	names := make([]string, 0, app.Instances)
+	for i := 0; i < app.Instances; i++ {
+		names = append(names, app.Name+"-"+strconv.Itoa(i+1))
+	}
+
+	return names
+}
+
+// Tells us if any offer currently held by the resource manager could run a task with these requirements.
+// Offers are only inspected here, nothing is assigned.
+func (m *Parser) canBeOffered(res []*mesos_v1.Resource, filters []task.Filter) bool {
+	for _, offer := range m.resourceManager.Offers() {
+		if taskManager.HasScalars(offer, res) && taskManager.MatchesFilters(offer, filters) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"hydrogen/scheduler/api/v1"
+	"hydrogen/task/persistence"
+	"net/http"
+)
+
+// Counters describing how the scheduler has been doing since it started.
+type MetricsResponse struct {
+	StorageRetries persistence.RetryStats `json:"storage_retries"`
+}
+
+// Reports our counters.
+func (a *ApiServer) metrics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(MetricsResponse{StorageRetries: a.storage.RetryStats()})
+	default:
+		v1.MethodNotAllowed(w, v1.Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
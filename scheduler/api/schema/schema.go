@@ -0,0 +1,145 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"strings"
+)
+
+// JSON Schema draft that generated schemas conform to.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema describing a single value.
+// Only the subset of keywords needed to describe our API types is supported.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Generate builds a schema from the given Go type by following its JSON struct tags.
+// Objects don't allow any properties that their struct doesn't declare.
+func Generate(t reflect.Type) *Schema {
+	return generate(t, make(map[reflect.Type]bool))
+}
+
+// Keeps track of the structs we're in the middle of describing so that recursive types terminate.
+func generate(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			return &Schema{Type: "object"}
+		}
+
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		s := &Schema{
+			Type:                 "object",
+			Properties:           make(map[string]*Schema),
+			AdditionalProperties: false,
+		}
+		addFields(s, t, visiting)
+
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+
+		return &Schema{Type: "array", Items: generate(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: generate(t.Elem(), visiting)}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		// Interfaces and anything else we can't describe accept any value.
+		return &Schema{}
+	}
+}
+
+// Adds a property for every exported field of the struct.
+// Embedded structs without a JSON name have their fields promoted, just like encoding/json does.
+// Fields of the struct itself win over promoted fields with the same name.
+func addFields(s *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	own := make(map[string]bool)
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			e := field.Type
+			for e.Kind() == reflect.Ptr {
+				e = e.Elem()
+			}
+			if e.Kind() == reflect.Struct {
+				embedded = append(embedded, e)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = generate(field.Type, visiting)
+		own[name] = true
+	}
+
+	for _, e := range embedded {
+		promoted := &Schema{Properties: make(map[string]*Schema)}
+		addFields(promoted, e, visiting)
+		for name, p := range promoted.Properties {
+			if !own[name] {
+				s.Properties[name] = p
+			}
+		}
+	}
+}
+
+// Gets the name that encoding/json would use for the field.
+// An empty name means the tag didn't set one, false means the field is never encoded.
+func jsonName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false // Unexported.
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	return strings.Split(tag, ",")[0], true
+}
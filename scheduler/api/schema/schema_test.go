@@ -0,0 +1,81 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+type embedded struct {
+	Labels map[string]string `json:"labels"`
+	Name   int               `json:"name"` // Shadowed by sample's own name.
+}
+
+type sample struct {
+	Name      string   `json:"name"`
+	Instances int      `json:"instances,omitempty"`
+	CPU       *float64 `json:"cpu"`
+	Args      []string `json:"args"`
+	Ignored   string   `json:"-"`
+	hidden    string
+	Child     *sample `json:"child"`
+	embedded
+}
+
+// Ensures structs are described by their JSON tags and forbid unknown properties.
+func TestGenerate(t *testing.T) {
+	s := Generate(reflect.TypeOf(&sample{}))
+	if s.Type != "object" || s.AdditionalProperties != false {
+		t.Fatalf("Expected a closed object, got %v", s)
+	}
+
+	want := map[string]string{
+		"labels":    "object",
+		"name":      "string",
+		"instances": "integer",
+		"cpu":       "number",
+		"args":      "array",
+		"child":     "object",
+	}
+	if len(s.Properties) != len(want) {
+		t.Fatalf("Expected %d properties, got %v", len(want), s.Properties)
+	}
+	for name, typ := range want {
+		p, ok := s.Properties[name]
+		if !ok || p.Type != typ {
+			t.Fatalf("Expected property %s of type %s, got %v", name, typ, p)
+		}
+	}
+
+	if s.Properties["args"].Items.Type != "string" {
+		t.Fatalf("Expected string items, got %v", s.Properties["args"].Items)
+	}
+
+	// Recursive types stop at the first repetition.
+	if len(s.Properties["child"].Properties) != 0 {
+		t.Fatalf("Expected recursion to stop, got %v", s.Properties["child"])
+	}
+}
+
+// Ensures operations are grouped by path.
+func TestDocument_AddOperation(t *testing.T) {
+	d := NewDocument("test", "v1")
+	d.AddOperation("/app", "get", &Operation{Summary: "get"})
+	d.AddOperation("/app", "post", &Operation{Summary: "post"})
+	if len(d.Paths) != 1 || len(d.Paths["/app"]) != 2 {
+		t.Fatalf("Expected a single path with two operations, got %v", d.Paths)
+	}
+}
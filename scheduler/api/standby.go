@@ -0,0 +1,71 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"hydrogen/scheduler/api/v1"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+)
+
+const (
+	standbyRedirect = "redirect"
+	standbyProxy    = "proxy"
+)
+
+// Wraps a handler so that only the leader changes state.
+// Standbys serve reads from their mirrored tasks and send everything else to the leader,
+// either by redirecting the client or by proxying the request, depending on configuration.
+// The leader won't resign while serving a request, so that nothing it accepted gets lost in the handoff.
+// Every scheduler is expected to serve the API on the same port.
+func (a *ApiServer) leaderOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler(w, r)
+			return
+		}
+
+		if a.ha.Lead(func() { handler(w, r) }) {
+			return
+		}
+
+		// We can't send the request anywhere if the election hasn't settled yet.
+		leader, err := a.ha.GetLeader()
+		if err != nil || leader == "" || leader == a.cfg.Leader.IP {
+			v1.ServiceUnavailable(w, v1.Response{Message: "No leader is available to serve this request, try again later."})
+			return
+		}
+
+		target := &url.URL{
+			Scheme: "http",
+			Host:   net.JoinHostPort(leader, strconv.Itoa(a.cfg.APIServer.Port)),
+		}
+		if a.cfg.APIServer.Cert != "" && a.cfg.APIServer.Key != "" {
+			target.Scheme = "https"
+		}
+
+		switch a.cfg.APIServer.StandbyMode {
+		case standbyProxy:
+			httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+		default:
+			target.Path = r.URL.Path
+			target.RawQuery = r.URL.RawQuery
+			http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+		}
+	}
+}
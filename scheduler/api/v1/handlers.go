@@ -18,17 +18,37 @@ import (
 	"io/ioutil"
 	"mesos-framework-sdk/task/manager"
 	"net/http"
+	sched "hydrogen/scheduler"
 	apiManager "hydrogen/scheduler/api/manager"
+	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
+	"mesos-framework-sdk/scheduler"
 )
 
 // API handlers communicate with the API manager to perform the appropriate actions.
 type Handlers struct {
-	manager apiManager.ApiParser
+	manager   apiManager.ApiParser
+	ha        *ha.HA
+	status    *status.Status
+	config    *sched.Configuration
+	scheduler scheduler.Scheduler
 }
 
 // Returns a new handlers instance for mapping routes.
-func NewHandlers(mgr apiManager.ApiParser) *Handlers {
-	return &Handlers{manager: mgr}
+func NewHandlers(
+	mgr apiManager.ApiParser,
+	ha *ha.HA,
+	st *status.Status,
+	cfg *sched.Configuration,
+	s scheduler.Scheduler) *Handlers {
+
+	return &Handlers{
+		manager:   mgr,
+		ha:        ha,
+		status:    st,
+		config:    cfg,
+		scheduler: s,
+	}
 }
 
 // Deploy handler launches a given application from parsed JSON.
@@ -57,6 +77,11 @@ func (h *Handlers) deployApplication(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
+	if dryRun(r) {
+		h.validate(w, dec, false)
+		return
+	}
+
 	task, err := h.manager.Deploy(dec)
 	if err != nil {
 		InternalServerError(w, Response{Message: err.Error()})
@@ -81,6 +106,11 @@ func (h *Handlers) updateApplication(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
+	if dryRun(r) {
+		h.validate(w, dec, true)
+		return
+	}
+
 	newTask, err := h.manager.Update(dec)
 	if err != nil {
 		InternalServerError(w, Response{Message: err.Error()})
@@ -170,3 +200,44 @@ func (h *Handlers) getAllTasks(w http.ResponseWriter, r *http.Request) {
 	}
 	MultiSuccess(w, data)
 }
+
+// Validate handler checks application definitions without deploying them.
+func (h *Handlers) Validate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		dec, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			BadRequest(w, Response{Message: err.Error()})
+			return
+		}
+
+		defer r.Body.Close()
+
+		h.validate(w, dec, false)
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// Reports every problem found with the given application definitions.
+func (h *Handlers) validate(w http.ResponseWriter, dec []byte, update bool) {
+	result := h.manager.Validate(dec, update)
+	if !result.Valid {
+		BadRequest(w, Response{
+			Message:  "Application definition is invalid.",
+			Errors:   result.Errors,
+			Warnings: result.Warnings,
+		})
+		return
+	}
+
+	Success(w, Response{
+		Message:  "Application definition is valid.",
+		Warnings: result.Warnings,
+	})
+}
+
+// Tells us if the request only wants its input validated.
+func dryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dry_run") == "true"
+}
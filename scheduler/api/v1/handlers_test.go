@@ -15,6 +15,8 @@
 package v1
 
 import (
+	"encoding/json"
+	"hydrogen/scheduler"
 	"io"
 	"mesos-framework-sdk/resources/manager/test"
 	test3 "mesos-framework-sdk/scheduler/test"
@@ -22,14 +24,24 @@ import (
 	"net/http/httptest"
 	"hydrogen/scheduler/api/manager"
 	mockApiManager "hydrogen/scheduler/api/manager/test"
+	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
+	"hydrogen/task/queue"
+	mockLogger "mesos-framework-sdk/logging/test"
+	mockStorage "hydrogen/task/persistence/test"
 	test2 "hydrogen/task/manager/test"
+	"hydrogen/task/volumes"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
 	apiMgr                = new(mockApiManager.MockApiManager)
 	brokenApiMgr          = new(mockApiManager.MockBrokenApiManager)
+	leader                = ha.NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{})
+	st                    = status.New()
+	cfg                   = &scheduler.Configuration{Scheduler: &scheduler.SchedulerConfiguration{ReconcileInterval: time.Minute}}
 	validJSON             = `[{"name": "test", "resources": {"cpu": 0.5, "mem": 128.0}, "command": {"cmd": "echo hello"}}]`
 	killJSON              = `{"name": "test"}`
 	junkJSON              = `not even json, how did this even get here`
@@ -50,7 +62,7 @@ func requestFixture(f http.HandlerFunc, method, endpoint string, r io.Reader) *h
 
 // Verifies that the handlers have the correct state.
 func TestNewHandlers(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	if h.manager != apiMgr {
 		t.Fatal("API does not contain the correct components")
 	}
@@ -58,7 +70,7 @@ func TestNewHandlers(t *testing.T) {
 
 // Validates the deployment endpoint.
 func TestHandlers_Deploy(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Application, "POST", "/app", strings.NewReader(validJSON))
 	if rr.Code != http.StatusOK {
@@ -68,11 +80,13 @@ func TestHandlers_Deploy(t *testing.T) {
 
 // Makes sure the deployment endpoint gives an error when it should.
 func TestHandlers_DeployError(t *testing.T) {
-	h := NewHandlers(brokenApiMgr)
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = manager.NewApiParser(
 		&test.MockResourceManager{},
 		&test2.MockTaskManager{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		test3.MockScheduler{},
+		&scheduler.ApiConfiguration{},
 	)
 	rr := requestFixture(h.Application, "POST", "/app", strings.NewReader(junkJSON))
 	if rr.Code == http.StatusOK {
@@ -82,7 +96,7 @@ func TestHandlers_DeployError(t *testing.T) {
 
 // Validates the endpoint to kill tasks.
 func TestHandlers_Kill(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Application, "DELETE", "/app", strings.NewReader(killJSON))
 	if rr.Code != http.StatusOK {
@@ -92,7 +106,7 @@ func TestHandlers_Kill(t *testing.T) {
 
 // Makes sure the endpoint to kill tasks gives an error when it should.
 func TestHandlers_KillError(t *testing.T) {
-	h := NewHandlers(brokenApiMgr)
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockBrokenApiManager{}
 	rr := requestFixture(h.Application, "DELETE", "/app", strings.NewReader(killJSON))
 	if rr.Code == http.StatusOK {
@@ -102,7 +116,7 @@ func TestHandlers_KillError(t *testing.T) {
 
 // Validates the endpoint to get task state.
 func TestHandlers_State(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Application, "GET", "/app?name=test", nil)
 	if rr.Code != http.StatusOK {
@@ -112,14 +126,14 @@ func TestHandlers_State(t *testing.T) {
 
 // Makes sure the endpoint to get task state gives an error when it should.
 func TestHandlers_StateError(t *testing.T) {
-	h := NewHandlers(brokenApiMgr)
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockBrokenApiManager{}
 	rr := requestFixture(h.Application, "GET", "/app?name=test", nil)
 	if rr.Code == http.StatusOK {
 		t.Fatalf("Wrong status code: want %d but got %d", rr.Code, http.StatusOK)
 	}
 
-	h = NewHandlers(apiMgr)
+	h = NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr = requestFixture(h.Application, "GET", "/app", nil)
 	if rr.Code == http.StatusOK {
@@ -129,7 +143,7 @@ func TestHandlers_StateError(t *testing.T) {
 
 // Validates the endpoint to get all tasks.
 func TestHandlers_Tasks(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Tasks, "GET", "/app/all", nil)
 	if rr.Code != http.StatusOK {
@@ -139,7 +153,7 @@ func TestHandlers_Tasks(t *testing.T) {
 
 // Tests that we get an OK response to an empty task manager.
 func TestHandlers_TasksEmpty(t *testing.T) {
-	h := NewHandlers(brokenApiMgr)
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Tasks, "GET", "/app/all", nil)
 	if rr.Code != http.StatusOK {
@@ -149,7 +163,7 @@ func TestHandlers_TasksEmpty(t *testing.T) {
 
 // Validates the endpoint to update a task.
 func TestHandlers_Update(t *testing.T) {
-	h := NewHandlers(apiMgr)
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockApiManager{}
 	rr := requestFixture(h.Application, "PUT", "/app", strings.NewReader(validJSON))
 	if rr.Code != http.StatusOK {
@@ -159,10 +173,176 @@ func TestHandlers_Update(t *testing.T) {
 
 // Makes sure our endpoint to update a task gives an error when it should.
 func TestHandlers_UpdateError(t *testing.T) {
-	h := NewHandlers(brokenApiMgr)
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
 	h.manager = mockApiManager.MockBrokenApiManager{}
 	rr := requestFixture(h.Application, "PUT", "/app", strings.NewReader(junkJSON))
 	if rr.Code == http.StatusOK {
 		t.Fatalf("Wrong status code: want %d but got %d", 400, http.StatusOK)
 	}
 }
+
+// Validates the endpoint to check application definitions.
+func TestHandlers_Validate(t *testing.T) {
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Validate, "POST", "/app/validate", strings.NewReader(validJSON))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	h = NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr = requestFixture(h.Validate, "POST", "/app/validate", strings.NewReader(junkJSON))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = requestFixture(h.Validate, "GET", "/app/validate", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// Makes sure dry runs only validate and never deploy.
+func TestHandlers_DryRun(t *testing.T) {
+	h := NewHandlers(brokenApiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Application, "POST", "/app?dry_run=true", strings.NewReader(validJSON))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	h = NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr = requestFixture(h.Application, "PUT", "/app?dry_run=true", strings.NewReader(validJSON))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+}
+
+// Validates the endpoint serving the application schema.
+func TestHandlers_Schema(t *testing.T) {
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Schema, "GET", "/schema", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	rr = requestFixture(h.Schema, "POST", "/schema", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// Makes sure the OpenAPI document covers every route and method.
+func TestHandlers_OpenAPI(t *testing.T) {
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.OpenAPI, "GET", "/openapi.json", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	routes := MapRoutes(h)
+	doc := openAPI(routes)
+	for path, route := range routes {
+		for _, method := range route.Methods {
+			if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+				t.Fatalf("%s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+	}
+}
+
+// Validates the endpoint that tells clients where the leader is.
+func TestHandlers_Leader(t *testing.T) {
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Leader, "GET", "/leader", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp LeaderResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if resp.Leader != "1" || resp.Leading {
+		t.Fatalf("Expected a standby reporting leader 1, got %+v", resp)
+	}
+
+	h = NewHandlers(apiMgr, ha.NewHA(new(mockStorage.MockBrokenStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{}),
+		st, cfg, test3.MockScheduler{})
+	rr = requestFixture(h.Leader, "GET", "/leader", nil)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusInternalServerError, rr.Code)
+	}
+
+	rr = requestFixture(h.Leader, "POST", "/leader", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// Validates the endpoint that hands leadership over.
+func TestHandlers_StepDown(t *testing.T) {
+	stepping := ha.NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{})
+	h := NewHandlers(apiMgr, stepping, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.StepDown, "POST", "/leader/stepdown", nil)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusAccepted, rr.Code)
+	}
+
+	select {
+	case <-stepping.StepDownRequests():
+	default:
+		t.Fatal("Expected a step down request")
+	}
+
+	rr = requestFixture(h.StepDown, "GET", "/leader/stepdown", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// Validates the endpoint describing the scheduler.
+func TestHandlers_Info(t *testing.T) {
+	h := NewHandlers(apiMgr, leader, st, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Info, "GET", "/info", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp InfoResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if resp.Leader != "1" || resp.ReconcileInterval != "1m0s" || resp.Version != status.Version || resp.Flags == nil {
+		t.Fatalf("Unexpected scheduler info: %+v", resp)
+	}
+
+	rr = requestFixture(h.Info, "POST", "/info", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestHandlers_Queue(t *testing.T) {
+	queued := status.New()
+	queued.SetQueue([]queue.App{
+		{Name: "db", Priority: 5, Queued: 1, Since: time.Now().Add(-time.Minute)},
+		{Name: "web", Queued: 3, Since: time.Now()},
+	})
+	h := NewHandlers(apiMgr, leader, queued, cfg, test3.MockScheduler{})
+	rr := requestFixture(h.Queue, "GET", "/queue", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp QueueResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if resp.Depth != 4 || len(resp.Apps) != 2 || resp.Apps[0].Name != "db" || resp.Apps[0].Waiting != "1m0s" {
+		t.Fatalf("Unexpected queue: %+v", resp)
+	}
+
+	rr = requestFixture(h.Queue, "POST", "/queue", nil)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Wrong status code: want %d but got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"flag"
+	"hydrogen/scheduler/status"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Describes the running scheduler.
+// Times are formatted as RFC 3339 and left out if they haven't happened yet.
+type InfoResponse struct {
+	FrameworkID       string            `json:"framework_id"`
+	Leader            string            `json:"leader"`
+	Leading           bool              `json:"leading"`
+	Subscribed        bool              `json:"subscribed"`
+	Started           string            `json:"started"`
+	LastHeartbeat     string            `json:"last_heartbeat,omitempty"`
+	ReconcileInterval string            `json:"reconcile_interval"`
+	LastReconcile     string            `json:"last_reconcile,omitempty"`
+	NextReconcile     string            `json:"next_reconcile,omitempty"`
+	Version           string            `json:"version"`
+	Flags             map[string]string `json:"flags"`
+}
+
+// Info handler describes the scheduler, its state, and how it was configured.
+func (h *Handlers) Info(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// The leader is informational here, so failing to read it isn't fatal.
+		leader, _ := h.ha.GetLeader()
+		interval := h.config.Scheduler.ReconcileInterval
+
+		info := InfoResponse{
+			FrameworkID:       h.scheduler.FrameworkInfo().GetId().GetValue(),
+			Leader:            leader,
+			Leading:           h.ha.IsLeader(),
+			Subscribed:        h.status.Subscribed(),
+			Started:           formatTime(h.status.Started()),
+			LastHeartbeat:     formatTime(h.status.LastHeartbeat()),
+			ReconcileInterval: interval.String(),
+			LastReconcile:     formatTime(h.status.LastReconcile()),
+			Version:           status.Version,
+			Flags:             flags(),
+		}
+
+		// Only the leader reconciles.
+		if info.Leading {
+			info.NextReconcile = formatTime(h.status.NextReconcile(interval))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(info)
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// Formats a time for our responses, leaving out times that never happened.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Gets the value of every command line flag.
+// Secrets are masked so that they don't leak through the API.
+func flags() map[string]string {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if strings.Contains(strings.ToLower(f.Name), "secret") && value != "" {
+			value = "********"
+		}
+
+		values[f.Name] = value
+	})
+
+	return values
+}
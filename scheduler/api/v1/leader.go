@@ -0,0 +1,56 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Describes which scheduler is currently leading.
+type LeaderResponse struct {
+	Leader  string `json:"leader"`
+	Leading bool   `json:"leading"`         // Whether the scheduler that answered is the leader.
+	Epoch   int64  `json:"epoch,omitempty"` // Term of the leader, only known by the leader itself.
+}
+
+// Leader handler tells clients where the leader is so they can talk to it directly.
+func (h *Handlers) Leader(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		leader, err := h.ha.GetLeader()
+		if err != nil {
+			InternalServerError(w, Response{Message: err.Error()})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(LeaderResponse{Leader: leader, Leading: h.ha.IsLeader(), Epoch: h.ha.Epoch()})
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// StepDown handler asks the leader to hand leadership over to a standby.
+// Stepping down happens once in-flight requests have been served, so it can't happen within this request.
+func (h *Handlers) StepDown(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.ha.RequestStepDown()
+		Accepted(w, Response{Message: "Stepping down, a standby will take over."})
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
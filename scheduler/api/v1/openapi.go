@@ -0,0 +1,115 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"hydrogen/scheduler/api/schema"
+	"hydrogen/task/builder"
+	"mesos-framework-sdk/task"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Schema handler serves the JSON Schema of the application definitions we accept.
+func (h *Handlers) Schema(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(applicationSchema())
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// OpenAPI handler serves a description of every route in this version of the API.
+func (h *Handlers) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(openAPI(MapRoutes(h)))
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
+
+// Describes the bodies accepted when deploying, updating, and killing applications.
+func applicationSchema() *schema.Schema {
+	return &schema.Schema{
+		Schema: schema.Draft,
+		Title:  "Hydrogen v1 API",
+		Definitions: map[string]*schema.Schema{
+			"application": schema.Generate(reflect.TypeOf(builder.ApplicationJSON{})),
+			"kill":        schema.Generate(reflect.TypeOf(task.KillJson{})),
+		},
+	}
+}
+
+// Builds the OpenAPI document from the documentation attached to each route.
+func openAPI(routes map[string]Route) *schema.Document {
+	doc := schema.NewDocument("Hydrogen", "v1")
+	for path, route := range routes {
+		for _, method := range route.Methods {
+			d := route.Docs[method]
+
+			var response interface{} = Response{}
+			if d.Response != nil {
+				response = d.Response
+			}
+
+			op := &schema.Operation{
+				Summary: d.Summary,
+				Responses: map[string]*schema.Response{
+					"200": {
+						Description: "Success",
+						Content:     schema.JSONContent(schema.Generate(reflect.TypeOf(response))),
+					},
+					"default": {
+						Description: "Error",
+						Content:     schema.JSONContent(schema.Generate(reflect.TypeOf(Response{}))),
+					},
+				},
+			}
+
+			for _, q := range d.Query {
+				op.Parameters = append(op.Parameters, &schema.Parameter{
+					Name:   q,
+					In:     "query",
+					Schema: &schema.Schema{Type: "string"},
+				})
+			}
+
+			if route.Idempotent && method != http.MethodGet {
+				op.Parameters = append(op.Parameters, &schema.Parameter{
+					Name:   "Idempotency-Key",
+					In:     "header",
+					Schema: &schema.Schema{Type: "string"},
+				})
+			}
+
+			if d.Body != nil {
+				op.RequestBody = &schema.RequestBody{
+					Required: true,
+					Content:  schema.JSONContent(schema.Generate(reflect.TypeOf(d.Body))),
+				}
+			}
+
+			doc.AddOperation(path, strings.ToLower(method), op)
+		}
+	}
+
+	return doc
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Describes the tasks waiting to be launched, as of the last offers the leader was sent.
+type QueueResponse struct {
+	Depth int                 `json:"depth"`
+	Apps  []QueuedAppResponse `json:"apps"`
+}
+
+// Describes the queued instances of one application.
+// Since is when the instance that's waited the longest was queued, formatted as RFC 3339, and Waiting is how long ago.
+type QueuedAppResponse struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Queued   int    `json:"queued"`
+	Since    string `json:"since"`
+	Waiting  string `json:"waiting"`
+}
+
+// Queue handler reports how many tasks are waiting to be launched and for how long, in the order they're launched in.
+func (h *Handlers) Queue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		queue := QueueResponse{Apps: []QueuedAppResponse{}}
+		for _, app := range h.status.Queue() {
+			queue.Depth += app.Queued
+			queue.Apps = append(queue.Apps, QueuedAppResponse{
+				Name:     app.Name,
+				Priority: app.Priority,
+				Queued:   app.Queued,
+				Since:    formatTime(app.Since),
+				Waiting:  now.Sub(app.Since).Truncate(time.Second).String(),
+			})
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(queue)
+	default:
+		MethodNotAllowed(w, Response{Message: r.Method + " is not allowed on this endpoint."})
+	}
+}
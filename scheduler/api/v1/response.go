@@ -16,21 +16,27 @@ package v1
 
 import (
 	"encoding/json"
+	"hydrogen/task/builder"
 	"net/http"
 )
 
 // v1 API response format.
 type Response struct {
-	TaskName string `json:"taskname,omitempty"`
-	Message  string `json:"message,omitempty"`
-	State    string `json:"state,omitempty"`
+	TaskName string               `json:"taskname,omitempty"`
+	Message  string               `json:"message,omitempty"`
+	State    string               `json:"state,omitempty"`
+	Errors   []builder.FieldError `json:"errors,omitempty"`
+	Warnings []builder.FieldError `json:"warnings,omitempty"`
 }
 
 var (
 	InternalServerError func(http.ResponseWriter, Response)   = responseFactory(http.StatusInternalServerError)
 	BadRequest          func(http.ResponseWriter, Response)   = responseFactory(http.StatusBadRequest)
 	MethodNotAllowed    func(http.ResponseWriter, Response)   = responseFactory(http.StatusMethodNotAllowed)
+	UnprocessableEntity func(http.ResponseWriter, Response)   = responseFactory(http.StatusUnprocessableEntity)
+	ServiceUnavailable  func(http.ResponseWriter, Response)   = responseFactory(http.StatusServiceUnavailable)
 	Success             func(http.ResponseWriter, Response)   = responseFactory(http.StatusOK)
+	Accepted            func(http.ResponseWriter, Response)   = responseFactory(http.StatusAccepted)
 	MultiSuccess        func(http.ResponseWriter, []Response) = multiResponseFactory(http.StatusOK)
 )
 
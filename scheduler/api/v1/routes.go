@@ -15,26 +15,101 @@
 package v1
 
 import (
+	"hydrogen/scheduler/api/schema"
+	"hydrogen/task/builder"
+	"mesos-framework-sdk/task"
 	"net/http"
 )
 
 const baseUrl string = "/v1/api"
 
 type Route struct {
-	Handler http.HandlerFunc
-	Methods []string
+	Handler    http.HandlerFunc
+	Methods    []string
+	Docs       map[string]Doc // Describes each method for the OpenAPI document.
+	Idempotent bool           // Whether mutating requests can carry an Idempotency-Key header.
+	Leader     bool           // Whether mutating requests have to be served by the leader.
+}
+
+// Describes a single method of a route.
+type Doc struct {
+	Summary  string
+	Query    []string    // Names of the query parameters that are understood.
+	Body     interface{} // Zero value of the request body, nil if there isn't one.
+	Response interface{} // Zero value of the response body, nil for the standard response.
 }
 
 // Returns a mapping of routes to their respective handlers.
 func MapRoutes(h *Handlers) map[string]Route {
 	return map[string]Route{
 		baseUrl + "/app": {
-			h.Application,
-			[]string{"POST", "DELETE", "PUT", "GET"},
+			Handler:    h.Application,
+			Methods:    []string{"POST", "DELETE", "PUT", "GET"},
+			Idempotent: true,
+			Leader:     true,
+			Docs: map[string]Doc{
+				"POST":   {Summary: "Deploy applications", Query: []string{"dry_run"}, Body: []builder.ApplicationJSON{}},
+				"DELETE": {Summary: "Kill an application", Body: task.KillJson{}},
+				"PUT":    {Summary: "Update an application", Query: []string{"dry_run"}, Body: builder.ApplicationJSON{}},
+				"GET":    {Summary: "Get the state of an application", Query: []string{"name"}},
+			},
 		},
 		baseUrl + "/app/all": {
-			h.Tasks,
-			[]string{"GET"},
+			Handler: h.Tasks,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get all tasks known to the scheduler", Response: []Response{}},
+			},
+		},
+		baseUrl + "/app/validate": {
+			Handler: h.Validate,
+			Methods: []string{"POST"},
+			Docs: map[string]Doc{
+				"POST": {Summary: "Validate applications without deploying them", Body: []builder.ApplicationJSON{}},
+			},
+		},
+		baseUrl + "/leader": {
+			Handler: h.Leader,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get the address of the leading scheduler", Response: LeaderResponse{}},
+			},
+		},
+		baseUrl + "/leader/stepdown": {
+			Handler: h.StepDown,
+			Methods: []string{"POST"},
+			Leader:  true,
+			Docs: map[string]Doc{
+				"POST": {Summary: "Hand leadership over to a standby", Response: Response{}},
+			},
+		},
+		baseUrl + "/info": {
+			Handler: h.Info,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get the scheduler's state, version, and configuration", Response: InfoResponse{}},
+			},
+		},
+		baseUrl + "/queue": {
+			Handler: h.Queue,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get the tasks waiting to be launched and how long they've waited", Response: QueueResponse{}},
+			},
+		},
+		baseUrl + "/schema": {
+			Handler: h.Schema,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get the JSON Schema of application definitions", Response: schema.Schema{}},
+			},
+		},
+		baseUrl + "/openapi.json": {
+			Handler: h.OpenAPI,
+			Methods: []string{"GET"},
+			Docs: map[string]Doc{
+				"GET": {Summary: "Get the OpenAPI document for this API", Response: schema.Document{}},
+			},
 		},
 	}
 }
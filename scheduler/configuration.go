@@ -42,29 +42,39 @@ type ExecutorConfiguration struct {
 
 // Persistence connection configuration.
 type PersistenceConfiguration struct {
+	Driver           string
+	Path             string
 	Endpoints        string
 	Timeout          time.Duration
 	KeepaliveTime    time.Duration
 	KeepaliveTimeout time.Duration
 	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	EncryptionKeys   string
+	BatchSize        int
+	BatchDelay       time.Duration
 }
 
 // Configuration for leader (HA) operation.
 type LeaderConfiguration struct {
-	IP            string
-	ServerPort    int
-	AddressFamily string
-	RetryInterval time.Duration
-	ServerRetry   time.Duration
+	IP             string
+	RetryInterval  time.Duration
+	LeaseTTL       time.Duration
+	RenewInterval  time.Duration
+	CatchUpTimeout time.Duration
 }
 
 // Holds configuration for the built-in REST API.
 type ApiConfiguration struct {
-	Server  server.Configuration
-	Version string
-	Cert    string
-	Key     string
-	Port    int
+	Server         server.Configuration
+	Version        string
+	Cert           string
+	Key            string
+	Port           int
+	MaxTasks       int
+	IdempotencyTTL time.Duration
+	StandbyMode    string
 }
 
 // Configuration for the file (executor) server.
@@ -92,6 +102,11 @@ type SchedulerConfiguration struct {
 	Hostname          string
 	ReconcileInterval time.Duration
 	SubscribeRetry    time.Duration
+	OfferRanking      string
+	PreemptionDelay   time.Duration
+	MaxLaunches       int
+	MaintenanceMin    float64
+	ReleaseTimeout    time.Duration
 }
 
 // Stores and initializes all of our configuration.
@@ -120,6 +135,9 @@ func (c *ExecutorConfiguration) initialize() *ExecutorConfiguration {
 
 // Applies default configuration for our persistence connection.
 func (c *PersistenceConfiguration) initialize() *PersistenceConfiguration {
+	flag.StringVar(&c.Driver, "persistence.driver", "etcd", "Where state is kept: etcd, bolt (a single file, "+
+		"for a single scheduler), or memory (lost on exit, for development and testing)")
+	flag.StringVar(&c.Path, "persistence.bolt.path", "hydrogen.db", "Path of the file used by the bolt driver")
 	flag.StringVar(&c.Endpoints, "persistence.endpoints", "http://127.0.0.1:2379", "Comma-separated list of "+
 		"storage endpoints")
 	flag.DurationVar(&c.Timeout, "persistence.timeout", 2*time.Second, "Timeout for CRUD storage operations")
@@ -132,6 +150,16 @@ func (c *PersistenceConfiguration) initialize() *PersistenceConfiguration {
 		"and if no activity is seen "+
 		"even after that the connection is closed")
 	flag.IntVar(&c.MaxRetries, "persistence.retry.max", 3, "How many times persistence operations will be retried")
+	flag.DurationVar(&c.RetryBaseDelay, "persistence.retry.delay.base", 100*time.Millisecond, "How long to wait "+
+		"before the first retry, doubling with every retry after it")
+	flag.DurationVar(&c.RetryMaxDelay, "persistence.retry.delay.max", 5*time.Second, "Longest wait between retries")
+	flag.StringVar(&c.EncryptionKeys, "persistence.encryption.keys", "", "File holding the keys task data is "+
+		"encrypted with, one id=base64 key per line, the first one is used to encrypt. "+
+		"Falls back to $HYDROGEN_ENCRYPTION_KEYS, and task data isn't encrypted if neither is set")
+	flag.IntVar(&c.BatchSize, "persistence.batch.size", 128, "Most task writes applied in a single transaction, "+
+		"0 for no limit. etcd allows 128 operations per transaction by default")
+	flag.DurationVar(&c.BatchDelay, "persistence.batch.delay", 10*time.Millisecond, "Longest time task writes "+
+		"are queued for before they're applied, unless something is waiting on them sooner")
 
 	return c
 }
@@ -139,12 +167,14 @@ func (c *PersistenceConfiguration) initialize() *PersistenceConfiguration {
 // Applies default leader configuration.
 func (c *LeaderConfiguration) initialize() *LeaderConfiguration {
 	flag.StringVar(&c.IP, "ha.ip", "127.0.0.1", "IP address of the node where this framework is running")
-	flag.IntVar(&c.ServerPort, "ha.leader.server.port", 8082, "Port that the leader server listens on")
-	flag.StringVar(&c.AddressFamily, "ha.leader.server.address.family", "tcp4", "tcp4, tcp6, or tcp for dual stack")
 	flag.DurationVar(&c.RetryInterval, "ha.leader.election.retry", 2*time.Second, "How long to wait before retrying "+
 		"the leader election process")
-	flag.DurationVar(&c.ServerRetry, "ha.leader.server.retry", 2*time.Second, "How long to wait before accepting "+
-		"connections from clients after an error")
+	flag.DurationVar(&c.LeaseTTL, "ha.leader.lease.ttl", 10*time.Second, "How long the leader key outlives a leader "+
+		"that stops renewing it, rounded down to the second")
+	flag.DurationVar(&c.RenewInterval, "ha.leader.lease.renew", 3*time.Second, "How often the leader renews its lease, "+
+		"should be well under the lease TTL")
+	flag.DurationVar(&c.CatchUpTimeout, "ha.standby.catchup", 10*time.Second, "How long a new leader waits for its "+
+		"copy of the tasks to catch up before reading them all from persistent storage")
 
 	return c
 }
@@ -155,6 +185,11 @@ func (c *ApiConfiguration) initialize() *ApiConfiguration {
 	flag.StringVar(&c.Cert, "api.server.cert", "", "API server's TLS certificate")
 	flag.StringVar(&c.Key, "api.server.key", "", "API server's TLS key")
 	flag.IntVar(&c.Port, "api.server.port", 8080, "API server's port")
+	flag.IntVar(&c.MaxTasks, "api.quota.tasks", 0, "Maximum number of tasks the scheduler will accept, 0 means unlimited")
+	flag.DurationVar(&c.IdempotencyTTL, "api.idempotency.ttl", 24*time.Hour, "How long the results of requests made "+
+		"with an Idempotency-Key are kept for replay")
+	flag.StringVar(&c.StandbyMode, "api.standby.mode", "redirect", "How standbys handle requests that change "+
+		"state: redirect (307 to the leader) or proxy")
 
 	return c
 }
@@ -188,6 +223,16 @@ func (c *SchedulerConfiguration) initialize() *SchedulerConfiguration {
 	flag.DurationVar(&c.SubscribeRetry, "subscribe.retry", 2*time.Second, "Controls the interval at which subscribe "+
 		"calls will be retried")
 	flag.DurationVar(&c.ReconcileInterval, "reconcile.interval", 15*time.Minute, "How often periodic reconciling happens")
+	flag.StringVar(&c.OfferRanking, "offer.ranking", "binpack", "Which offers tasks are placed on first, unless "+
+		"their application picks its own: binpack (the fullest), spread (the emptiest), or random")
+	flag.DurationVar(&c.PreemptionDelay, "preemption.delay", 5*time.Minute, "How long a task waits for room before "+
+		"tasks of a lower priority are killed to make some, 0 never kills any")
+	flag.IntVar(&c.MaxLaunches, "launch.max", 0, "How many tasks are launched at most each time we're offered "+
+		"resources, the rest wait for the next offers, 0 launches as many as fit")
+	flag.Float64Var(&c.MaintenanceMin, "maintenance.min", 0.5, "The share of a UNIQUE group's instances that "+
+		"have to keep running while instances are moved off agents going down for maintenance")
+	flag.DurationVar(&c.ReleaseTimeout, "volume.release.timeout", time.Hour, "How long we keep asking for offers to "+
+		"destroy the volume of a killed task, before giving up and leaving it to be destroyed by hand, 0 never gives up")
 
 	return c
 }
@@ -15,8 +15,10 @@
 package controller
 
 import (
+	"context"
 	scheduler "hydrogen/scheduler"
 	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
 	"hydrogen/task/manager"
 	"hydrogen/task/persistence"
 	"mesos-framework-sdk/include/mesos_v1"
@@ -53,10 +55,12 @@ type (
 	EventController struct {
 		config      *scheduler.Configuration
 		scheduler   sdkScheduler.Scheduler
-		taskManager sdkTaskManager.TaskManager
+		taskManager manager.TaskManager
 		storage     persistence.Storage
 		logger      logging.Logger
 		ha          *ha.HA
+		status      *status.Status
+		mirror      *mirror
 	}
 )
 
@@ -64,10 +68,11 @@ type (
 func NewEventController(
 	config *scheduler.Configuration,
 	scheduler sdkScheduler.Scheduler,
-	manager sdkTaskManager.TaskManager,
+	manager manager.TaskManager,
 	storage persistence.Storage,
 	logger logging.Logger,
-	ha *ha.HA) *EventController {
+	ha *ha.HA,
+	status *status.Status) *EventController {
 
 	return &EventController{
 		config:      config,
@@ -76,6 +81,8 @@ func NewEventController(
 		storage:     storage,
 		logger:      logger,
 		ha:          ha,
+		status:      status,
+		mirror:      newMirror(storage, manager, logger, config.Leader.RetryInterval),
 	}
 }
 
@@ -86,16 +93,26 @@ func NewEventController(
 // This method blocks forever, or until the scheduler is brought down.
 //
 func (s *EventController) Run(events chan *mesos_v1_scheduler.Event, revives chan *sdkTaskManager.Task, handler events.SchedulerEvent) {
+	// While we're a standby, keep a copy of the leader's tasks so the API can serve reads and we can take over quickly.
+	ctx, cancel := context.WithCancel(context.Background())
+	mirrored := make(chan struct{})
+	go func() {
+		s.mirror.run(ctx)
+		close(mirrored)
+	}()
 
-	// Start the election.
-	s.logger.Emit(logging.INFO, "Starting leader election socket server")
-	go s.ha.Communicate()
-
-	// Block here until we either become a leader or a standby.
+	// Block here until we become the leader.
 	// If we are the leader we break out and continue to execute the rest of the scheduler.
-	// If we are a standby then we connect to the leader and wait for the process to start over again.
+	// If we are a standby then we watch the leader and campaign again once it's gone.
+	// Nothing is changed through the API until we've taken over and start leading below.
 	s.ha.Election()
 
+	// Everything the previous leader wrote happened before our term began, so once our copy has caught up to it, it's complete.
+	// The mirror is stopped before anything else can change tasks, so that it can't replace changes we've yet to write.
+	caughtUp := s.mirror.catchUp(s.ha.Epoch(), s.config.Leader.CatchUpTimeout)
+	cancel()
+	<-mirrored
+
 	// Get the frameworkId from etcd and set it to our frameworkID in our struct.
 	err := s.setFrameworkId()
 	if err != nil {
@@ -103,13 +120,30 @@ func (s *EventController) Run(events chan *mesos_v1_scheduler.Event, revives cha
 	}
 
 	// Recover our state (if any) in the event we (or the server) go down.
-	s.logger.Emit(logging.INFO, "Restoring any persisted state from data store")
-	err = s.restoreTasks()
+	if caughtUp {
+		s.logger.Emit(logging.INFO, "Taking over the tasks mirrored up to revision %d", s.mirror.Revision())
+	} else {
+		s.logger.Emit(logging.INFO, "Restoring any persisted state from data store")
+		err = s.restoreTasks()
+		if err != nil {
+			s.logger.Emit(logging.INFO, "Failed to restore persisted state: %s", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	// Bring old records up to date and move the ones we can't read out of the way.
+	err = s.mirror.repair()
 	if err != nil {
-		s.logger.Emit(logging.INFO, "Failed to restore persisted state: %s", err.Error())
+		s.logger.Emit(logging.ERROR, "Failed to repair persisted tasks: %s", err.Error())
 		os.Exit(2)
 	}
 
+	// Our tasks are complete, so changes can be made through the API from here on.
+	if !s.ha.StartLeading() {
+		s.logger.Emit(logging.ERROR, "Lost the election while taking over")
+		os.Exit(1)
+	}
+
 	// Kick off our scheduled reconciling.
 	s.logger.Emit(logging.INFO, "Starting periodic reconciler thread with a %g minute interval", s.config.Scheduler.ReconcileInterval.Minutes())
 	go s.periodicReconcile()
@@ -132,7 +166,9 @@ func (s *EventController) Run(events chan *mesos_v1_scheduler.Event, revives cha
 				os.Exit(1)
 			}
 
+			// Subscribing blocks for as long as we're connected to the master.
 			resp, err := s.scheduler.Subscribe(events)
+			s.status.SetSubscribed(false)
 			if err != nil {
 				s.logger.Emit(logging.ERROR, "Failed to subscribe: %s", err.Error())
 				if resp != nil && resp.StatusCode == 401 {
@@ -149,9 +185,10 @@ func (s *EventController) Run(events chan *mesos_v1_scheduler.Event, revives cha
 }
 
 // Listens for Mesos events, tasks that need to be revived, and signals and routes to the appropriate handler.
+// SIGUSR1 and step down requests hand leadership over to a standby.
 func (s *EventController) listen(c chan *mesos_v1_scheduler.Event, r chan *sdkTaskManager.Task, h events.SchedulerEvent) {
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
 
 	for {
 		select {
@@ -159,32 +196,45 @@ func (s *EventController) listen(c chan *mesos_v1_scheduler.Event, r chan *sdkTa
 			h.Run(event)
 		case task := <-r:
 			h.Reschedule(task)
-		case <-sigs:
+		case <-s.ha.StepDownRequests():
+			s.handoff()
+		case sig := <-sigs:
+			if sig == syscall.SIGUSR1 {
+				s.handoff()
+			}
 			h.Signals()
 		}
 	}
 }
 
+// Steps down so that a standby can take over right away.
+// Events are handled on this goroutine, so none are in flight. API writes are stopped first, so that every change
+// they made is queued by the time we flush, and we only release the leader key once that's written.
+// Exiting closes our subscription, the new leader subscribes again with the same framework ID.
+func (s *EventController) handoff() {
+	s.logger.Emit(logging.INFO, "Stepping down, handing leadership over to a standby")
+	s.ha.StopLeading()
+	if err := s.taskManager.Flush(); err != nil {
+		s.logger.Emit(
+			logging.ERROR,
+			"Stepping down with task changes that weren't persisted, they'll be reconciled by the new leader: %s",
+			err.Error(),
+		)
+	}
+	if err := s.ha.Resign(); err != nil {
+		s.logger.Emit(logging.ERROR, "Failed to resign, a standby will take over once our lease expires: %s", err.Error())
+	}
+
+	os.Exit(0)
+}
+
 //
 // Get all of our persisted tasks, convert them back into TaskInfo's, and add them to our task manager.
 // If no tasks exist in the data store then we can consider this a fresh run and safely move on.
+// Anything left over from mirroring the previous leader is replaced.
 //
 func (s *EventController) restoreTasks() error {
-	tasks, err := s.storage.ReadAll(manager.TASK_DIRECTORY)
-	if err != nil {
-		return err
-	}
-
-	for _, value := range tasks {
-		task, err := new(sdkTaskManager.Task).Decode([]byte(value))
-		if err != nil {
-			return err
-		}
-
-		s.taskManager.Restore(task)
-	}
-
-	return nil
+	return s.mirror.load()
 }
 
 // Keep our state in check by periodically reconciling.
@@ -194,6 +244,7 @@ func (s *EventController) periodicReconcile() {
 	for {
 		select {
 		case <-ticker.C:
+			s.status.Reconciled()
 			recon, err := s.taskManager.AllByState(sdkTaskManager.RUNNING)
 			if err != nil {
 				continue
@@ -19,18 +19,19 @@ import (
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sdkScheduler "mesos-framework-sdk/scheduler"
 	sched "mesos-framework-sdk/scheduler/test"
-	"mesos-framework-sdk/task/manager"
 	sdkTaskManager "mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
 	"hydrogen/scheduler/events"
 	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
+	taskManager "hydrogen/task/manager"
 	mockTaskManager "hydrogen/task/manager/test"
 	"hydrogen/task/persistence"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
 	"testing"
 	"time"
 )
@@ -51,11 +52,11 @@ func workingEventController() *EventController {
 				MaxRetries: 0,
 			},
 		}
-		sh sdkScheduler.Scheduler = sched.MockScheduler{}
-		m  manager.TaskManager    = &mockTaskManager.MockTaskManager{}
-		s  persistence.Storage    = &mockStorage.MockStorage{}
-		l  logging.Logger         = &mockLogger.MockLogger{}
-		ha                        = ha.NewHA(s, l, cfg.Leader)
+		sh sdkScheduler.Scheduler  = sched.MockScheduler{}
+		m  taskManager.TaskManager = &mockTaskManager.MockTaskManager{}
+		s  persistence.Storage     = &mockStorage.MockStorage{}
+		l  logging.Logger          = &mockLogger.MockLogger{}
+		ha                         = ha.NewHA(s, l, cfg.Leader)
 	)
 	return NewEventController(
 		cfg,
@@ -64,6 +65,7 @@ func workingEventController() *EventController {
 		s,
 		l,
 		ha,
+		status.New(),
 	)
 }
 
@@ -77,11 +79,11 @@ func brokenSchedulerEventController() *EventController {
 				MaxRetries: 0,
 			},
 		}
-		sh sdkScheduler.Scheduler = sched.MockBrokenScheduler{}
-		m  manager.TaskManager    = &mockTaskManager.MockTaskManager{}
-		s  persistence.Storage    = &mockStorage.MockStorage{}
-		l  logging.Logger         = &mockLogger.MockLogger{}
-		ha                        = ha.NewHA(s, l, cfg.Leader)
+		sh sdkScheduler.Scheduler  = sched.MockBrokenScheduler{}
+		m  taskManager.TaskManager = &mockTaskManager.MockTaskManager{}
+		s  persistence.Storage     = &mockStorage.MockStorage{}
+		l  logging.Logger          = &mockLogger.MockLogger{}
+		ha                         = ha.NewHA(s, l, cfg.Leader)
 	)
 	return NewEventController(
 		cfg,
@@ -90,6 +92,7 @@ func brokenSchedulerEventController() *EventController {
 		s,
 		l,
 		ha,
+		status.New(),
 	)
 }
 
@@ -106,9 +109,9 @@ func TestNewEventController(t *testing.T) {
 func TestEventController_Run(t *testing.T) {
 	ctrl := workingEventController()
 	ch := make(chan *mesos_v1_scheduler.Event)
-	r := mockResourceManager.MockResourceManager{}
+	r := mockTaskManager.MockResourceManager{}
 	v := make(chan *sdkTaskManager.Task)
-	h := events.NewHandler(ctrl.taskManager, r, ctrl.config, ctrl.scheduler, ctrl.storage, v, ctrl.logger)
+	h := events.NewHandler(ctrl.taskManager, r, ctrl.config, ctrl.scheduler, ctrl.storage, volumes.NewReservations(ctrl.storage), v, ctrl.status, ctrl.logger)
 	go ctrl.Run(ch, v, h)
 }
 
@@ -123,9 +126,9 @@ func TestEventController_periodicReconcile(t *testing.T) {
 func TestEventController_listen(t *testing.T) {
 	ch := make(chan *mesos_v1_scheduler.Event)
 	ctrl := workingEventController()
-	r := mockResourceManager.MockResourceManager{}
+	r := mockTaskManager.MockResourceManager{}
 	v := make(chan *sdkTaskManager.Task)
-	h := events.NewHandler(ctrl.taskManager, r, ctrl.config, ctrl.scheduler, ctrl.storage, v, ctrl.logger)
+	h := events.NewHandler(ctrl.taskManager, r, ctrl.config, ctrl.scheduler, ctrl.storage, volumes.NewReservations(ctrl.storage), v, ctrl.status, ctrl.logger)
 	go ctrl.Run(ch, v, h)
 
 	ch <- &mesos_v1_scheduler.Event{
@@ -0,0 +1,306 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"hydrogen/task/manager"
+	"hydrogen/task/persistence"
+	"mesos-framework-sdk/logging"
+	sdkTaskManager "mesos-framework-sdk/task/manager"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How often a new leader checks whether its copy of the tasks has caught up.
+const catchUpPoll = 50 * time.Millisecond
+
+// Keeps the task manager in step with the tasks in persistent storage.
+// Standbys use it to serve reads, and a new leader uses it to take over without reading everything again.
+type mirror struct {
+	storage     persistence.Storage
+	taskManager manager.TaskManager
+	logger      logging.Logger
+	retry       time.Duration
+	mutex       sync.RWMutex
+	tasks       map[string]*sdkTaskManager.Task // Keyed by where they're stored.
+	revision    int64                           // Every change up to here has been applied.
+	migrated    map[string]bool                 // Records in an older version, to be written again.
+	corrupt     map[string]string               // Records we couldn't read, to be quarantined.
+	newer       map[string]bool                 // Records written by a newer scheduler.
+}
+
+func newMirror(s persistence.Storage, m manager.TaskManager, l logging.Logger, retry time.Duration) *mirror {
+	return &mirror{
+		storage:     s,
+		taskManager: m,
+		logger:      l,
+		retry:       retry,
+		tasks:       make(map[string]*sdkTaskManager.Task),
+		migrated:    make(map[string]bool),
+		corrupt:     make(map[string]string),
+		newer:       make(map[string]bool),
+	}
+}
+
+// Follows every change to the persisted tasks until the context is done.
+// If the watch is lost we start over from a fresh read.
+func (m *mirror) run(ctx context.Context) {
+	for {
+		if err := m.load(); err != nil {
+			m.logger.Emit(logging.ERROR, "Failed to read the persisted tasks: %s", err.Error())
+		} else {
+			m.follow(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.retry):
+		}
+	}
+}
+
+// Replaces our copy with every persisted task.
+func (m *mirror) load() error {
+	values, revision, err := m.storage.ReadAllWithRevision(manager.TASK_DIRECTORY)
+	unreadable, partial := err.(*persistence.UnreadableError)
+	if err != nil && !partial {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.tasks = make(map[string]*sdkTaskManager.Task, len(values))
+	m.migrated = make(map[string]bool)
+	m.corrupt = make(map[string]string)
+	m.newer = make(map[string]bool)
+	for key, value := range values {
+		m.decode(key, value)
+	}
+	if partial {
+		for key, value := range unreadable.Stored {
+			m.unreadable(key, value, unreadable.Errors[key])
+		}
+	}
+	m.revision = revision
+	m.sync()
+
+	return nil
+}
+
+// Applies changes from where our copy was read until the watch ends.
+func (m *mirror) follow(ctx context.Context) {
+	for event := range m.storage.Watch(ctx, manager.TASK_DIRECTORY, true, m.Revision()) {
+		m.apply(event)
+	}
+
+	if ctx.Err() == nil {
+		m.logger.Emit(logging.ERROR, "Lost our watch on the persisted tasks, reading them again")
+	}
+}
+
+// Applies a single change to our copy.
+func (m *mirror) apply(event persistence.Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	previous := m.tasks[event.Key]
+	switch event.Type {
+	case persistence.Put:
+		if event.Err != nil {
+			m.unreadable(event.Key, event.Value, event.Err)
+		} else {
+			m.decode(event.Key, event.Value)
+		}
+	case persistence.Delete:
+		m.forget(event.Key)
+	}
+
+	if event.Revision > m.revision {
+		m.revision = event.Revision
+	}
+
+	if event.Type != persistence.Progress {
+		m.syncKey(event.Key, previous)
+	}
+}
+
+// Replaces the task stored at the key, keeping track of records we'll have to deal with once we lead.
+// The caller must hold the lock.
+func (m *mirror) decode(key, value string) {
+	m.forget(key)
+
+	task, migrated, err := manager.DecodeRecord([]byte(value))
+	switch {
+	case err == manager.NewerRecordError:
+		m.logger.Emit(logging.ERROR, "Task %s was written by a newer scheduler, ignoring it", key)
+		m.newer[key] = true
+	case err != nil:
+		m.logger.Emit(logging.ERROR, "Failed to decode task %s, it will be quarantined: %s", key, err.Error())
+		m.corrupt[key] = value
+	default:
+		m.tasks[key] = task
+		if migrated {
+			m.migrated[key] = true
+		}
+	}
+}
+
+// Sets aside a record that storage couldn't read for us, such as one that fails to decrypt, to be quarantined as it's stored.
+// Records encrypted with a key we weren't given never get here, they fail the whole read so that we don't lead without them.
+// The caller must hold the lock.
+func (m *mirror) unreadable(key, stored string, err error) {
+	m.forget(key)
+
+	m.logger.Emit(logging.ERROR, "Failed to read task %s, it will be quarantined: %s", key, err.Error())
+	m.corrupt[key] = stored
+}
+
+// Drops everything we know about the key, the caller must hold the lock.
+func (m *mirror) forget(key string) {
+	delete(m.tasks, key)
+	delete(m.migrated, key)
+	delete(m.corrupt, key)
+	delete(m.newer, key)
+}
+
+// Writes migrated records again in the current version, and moves records we couldn't read under the quarantine directory.
+// Only the leader may do this, once it has stopped mirroring.
+// Records written by a newer scheduler are left alone, and fail the repair since we can't run their tasks.
+func (m *mirror) repair() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.newer) > 0 {
+		return errors.New(strconv.Itoa(len(m.newer)) + " tasks were written by a newer version of the scheduler")
+	}
+
+	for key, value := range m.corrupt {
+		if err := m.storage.Update(manager.QUARANTINE_DIRECTORY+key, value); err != nil {
+			return err
+		}
+		if err := m.storage.Delete(key); err != nil {
+			return err
+		}
+
+		m.logger.Emit(logging.ALARM, "Quarantined task %s under %s", key, manager.QUARANTINE_DIRECTORY+key)
+		delete(m.corrupt, key)
+	}
+
+	for key := range m.migrated {
+		data, err := manager.EncodeRecord(m.tasks[key])
+		if err != nil {
+			return err
+		}
+		if err := m.storage.Update(key, string(data)); err != nil {
+			return err
+		}
+
+		delete(m.migrated, key)
+	}
+
+	return nil
+}
+
+// Hands our whole copy to the task manager, the caller must hold the lock.
+// Only needed when our copy is read from scratch, changes after that are handed over one at a time.
+func (m *mirror) sync() {
+	tasks := make([]*sdkTaskManager.Task, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, task)
+	}
+
+	m.taskManager.Sync(tasks...)
+}
+
+// Hands only the task stored at the key to the task manager, which holds the previous one that was stored there.
+// Everything else it holds is already up to date, the caller must hold the lock.
+func (m *mirror) syncKey(key string, previous *sdkTaskManager.Task) {
+	current := m.tasks[key]
+	if previous != nil && (current == nil || current.Info.GetName() != previous.Info.GetName()) && !m.stored(previous.Info.GetName()) {
+		m.taskManager.SyncRemove(previous.Info.GetName())
+	}
+	if current != nil {
+		m.taskManager.SyncTask(current)
+	}
+}
+
+// Whether a task with the name is stored at any key, such as one that's moved to a new key under a new ID.
+// The caller must hold the lock.
+func (m *mirror) stored(name string) bool {
+	for _, task := range m.tasks {
+		if task.Info.GetName() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Revision that every change has been applied up to.
+func (m *mirror) Revision() int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.revision
+}
+
+// Waits for every change up to the revision to be applied.
+// Watches only tell us how far they've got along with changes, so we also check whether the tasks in storage have
+// changed at all since the revision we're at, in which case we already hold everything.
+// Returns false if that doesn't happen within the timeout.
+func (m *mirror) catchUp(revision int64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for m.Revision() < revision {
+		if m.unchanged() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(catchUpPoll)
+	}
+
+	return true
+}
+
+// Tells us if no task has been written or deleted since the revision our copy is at.
+// If so, our copy is moved up to the revision storage is at now.
+func (m *mirror) unchanged() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	all, changed, revision, err := m.storage.Count(manager.TASK_DIRECTORY, m.revision)
+	if err != nil {
+		m.logger.Emit(logging.ERROR, "Failed to count the persisted tasks: %s", err.Error())
+		return false
+	}
+
+	// Nothing's been written since, so the keys in storage are a subset of ours, and they're all there if there are as many.
+	held := int64(len(m.tasks) + len(m.corrupt) + len(m.newer))
+	if changed > 0 || all != held {
+		return false
+	}
+	if revision > m.revision {
+		m.revision = revision
+	}
+
+	return true
+}
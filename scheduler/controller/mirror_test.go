@@ -0,0 +1,297 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"hydrogen/task/manager"
+	mockTaskManager "hydrogen/task/manager/test"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	mockStorage "hydrogen/task/persistence/test"
+	"mesos-framework-sdk/include/mesos_v1"
+	mockLogger "mesos-framework-sdk/logging/test"
+	sdkTaskManager "mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Storage holding two tasks, with changes fed through a channel.
+type watchedStorage struct {
+	mockStorage.MockStorage
+	events chan persistence.Event
+}
+
+func (w watchedStorage) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	return map[string]string{
+		manager.TASK_DIRECTORY + "a": record("a", sdkTaskManager.UNKNOWN),
+		manager.TASK_DIRECTORY + "b": record("b", sdkTaskManager.UNKNOWN),
+	}, 5, nil
+}
+
+func (w watchedStorage) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	return w.events
+}
+
+func (m *mirror) count() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.tasks)
+}
+
+// Does the mirror follow changes on top of what it read?
+func TestMirror_Follow(t *testing.T) {
+	s := watchedStorage{events: make(chan persistence.Event)}
+	m := newMirror(s, &mockTaskManager.MockTaskManager{}, new(mockLogger.MockLogger), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.run(ctx)
+		close(done)
+	}()
+
+	s.events <- persistence.Event{Type: persistence.Put, Key: manager.TASK_DIRECTORY + "c", Value: record("c", sdkTaskManager.UNKNOWN), Revision: 6}
+	s.events <- persistence.Event{Type: persistence.Delete, Key: manager.TASK_DIRECTORY + "a", Revision: 7}
+	s.events <- persistence.Event{Type: persistence.Progress, Revision: 9}
+	close(s.events)
+	cancel()
+	<-done
+
+	if m.count() != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", m.count())
+	}
+	if m.Revision() != 9 {
+		t.Fatalf("Expected to be caught up to revision 9, got %d", m.Revision())
+	}
+}
+
+// Do we know when we've caught up?
+func TestMirror_CatchUp(t *testing.T) {
+	kv := memory.New()
+	kv.Update(manager.TASK_DIRECTORY+"a", record("a", sdkTaskManager.UNKNOWN))
+	kv.Update(manager.TASK_DIRECTORY+"b", record("b", sdkTaskManager.UNKNOWN))
+	m := newMirror(persistence.NewPersistence(kv, 0, 0, 0), &mockTaskManager.MockTaskManager{}, new(mockLogger.MockLogger), 0)
+	if err := m.load(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !m.catchUp(2, 0) {
+		t.Fatal("We should already be caught up to the revision we read at")
+	}
+
+	// Writes to anything but tasks don't leave us behind.
+	kv.Update("/leader", "1")
+	if !m.catchUp(3, 0) || m.Revision() != 3 {
+		t.Fatalf("Expected to be caught up with no tasks changed, got revision %d", m.Revision())
+	}
+
+	// Changes we haven't seen do, whether tasks were written or deleted.
+	kv.Update(manager.TASK_DIRECTORY+"a", record("a", sdkTaskManager.RUNNING))
+	if m.catchUp(4, 0) {
+		t.Fatal("We can't be caught up with a task written since")
+	}
+	m.load()
+	kv.Delete(manager.TASK_DIRECTORY + "b")
+	if m.catchUp(5, 0) {
+		t.Fatal("We can't be caught up with a task deleted since")
+	}
+
+	m = newMirror(new(mockStorage.MockBrokenStorage), &mockTaskManager.MockTaskManager{}, new(mockLogger.MockLogger), 0)
+	if err := m.load(); err == nil {
+		t.Fatal("Loading from broken storage should fail")
+	}
+	if m.catchUp(1, 0) {
+		t.Fatal("We can't tell we're caught up without storage")
+	}
+}
+
+// Migrated records are written again and corrupt ones are quarantined, but only when asked to.
+func TestMirror_Repair(t *testing.T) {
+	manager.RegisterMigration(0, func(data []byte) ([]byte, error) {
+		if string(data) == "corrupt" {
+			return nil, errors.New("Corrupt")
+		}
+		legacy := &sdkTaskManager.Task{Info: &mesos_v1.TaskInfo{Name: utils.ProtoString(string(data))}}
+		return legacy.Encode()
+	})
+	defer manager.RegisterMigration(0, func(data []byte) ([]byte, error) { return data, nil })
+
+	kv := memory.New()
+	kv.Update(manager.TASK_DIRECTORY+"a", "legacy")
+	kv.Update(manager.TASK_DIRECTORY+"b", "corrupt")
+
+	m := newMirror(persistence.NewPersistence(kv, 0, 0, 0), &mockTaskManager.MockTaskManager{}, new(mockLogger.MockLogger), 0)
+	if err := m.load(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if m.count() != 1 {
+		t.Fatalf("Expected only the readable task to be mirrored, got %d", m.count())
+	}
+	if v, _ := kv.Read(manager.TASK_DIRECTORY + "b"); v != "corrupt" {
+		t.Fatal("Standbys shouldn't touch records they can't read")
+	}
+
+	if err := m.repair(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if v, _ := kv.Read(manager.QUARANTINE_DIRECTORY + manager.TASK_DIRECTORY + "b"); v != "corrupt" {
+		t.Fatal("Expected the corrupt record to be quarantined")
+	}
+	if v, _ := kv.Read(manager.TASK_DIRECTORY + "b"); v != "" {
+		t.Fatal("Expected the corrupt record to be moved")
+	}
+	if _, migrated, err := manager.DecodeRecord([]byte(mustRead(kv, manager.TASK_DIRECTORY+"a"))); err != nil || migrated {
+		t.Fatal("Expected the legacy record to be written in the current version")
+	}
+
+	kv.Update(manager.TASK_DIRECTORY+"c", `{"version": 99}`)
+	m.load()
+	if err := m.repair(); err == nil {
+		t.Fatal("Records from a newer scheduler should fail the repair")
+	}
+}
+
+// Storage that can't read one of the tasks, such as one encrypted with a key we don't have.
+type unreadableStorage struct {
+	persistence.Storage
+}
+
+func (u unreadableStorage) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	values, revision, _ := u.Storage.ReadAllWithRevision(key)
+	stored := values[manager.TASK_DIRECTORY+"b"]
+	delete(values, manager.TASK_DIRECTORY+"b")
+
+	return values, revision, &persistence.UnreadableError{
+		Stored: map[string]string{manager.TASK_DIRECTORY + "b": stored},
+		Errors: map[string]error{manager.TASK_DIRECTORY + "b": errors.New("Unknown key")},
+	}
+}
+
+// Records storage can't read are quarantined as they're stored, and the rest are still mirrored.
+func TestMirror_Unreadable(t *testing.T) {
+	kv := memory.New()
+	kv.Update(manager.TASK_DIRECTORY+"a", record("a", sdkTaskManager.UNKNOWN))
+	kv.Update(manager.TASK_DIRECTORY+"b", "sealed")
+
+	m := newMirror(unreadableStorage{persistence.NewPersistence(kv, 0, 0, 0)}, &mockTaskManager.MockTaskManager{}, new(mockLogger.MockLogger), 0)
+	if err := m.load(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if m.count() != 1 {
+		t.Fatalf("Expected the readable task to be mirrored, got %d", m.count())
+	}
+
+	m.apply(persistence.Event{Type: persistence.Put, Key: manager.TASK_DIRECTORY + "c", Value: "sealed", Revision: 6, Err: errors.New("Unknown key")})
+	if err := m.repair(); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, name := range []string{"b", "c"} {
+		if v, _ := kv.Read(manager.QUARANTINE_DIRECTORY + manager.TASK_DIRECTORY + name); v != "sealed" {
+			t.Fatalf("Expected task %s to be quarantined as it was stored, got %q", name, v)
+		}
+	}
+}
+
+// Encodes a task the way the task manager stores it.
+func record(name string, state mesos_v1.TaskState) string {
+	data, _ := manager.EncodeRecord(&sdkTaskManager.Task{
+		Info:  &mesos_v1.TaskInfo{Name: utils.ProtoString(name), TaskId: &mesos_v1.TaskID{Value: utils.ProtoString(name)}},
+		State: state,
+	})
+
+	return string(data)
+}
+
+// Returns a mirror of n stored tasks, along with the task manager it keeps in step.
+func mirrorOf(n int) (*mirror, manager.TaskManager) {
+	kv := memory.New()
+	for i := 0; i < n; i++ {
+		name := "task-" + strconv.Itoa(i)
+		kv.Update(manager.TASK_DIRECTORY+name, record(name, sdkTaskManager.UNKNOWN))
+	}
+
+	storage := persistence.NewPersistence(kv, 0, 0, 0)
+	tm := manager.NewTaskManager(make(map[string]*sdkTaskManager.Task), storage, new(mockLogger.MockLogger))
+	m := newMirror(storage, tm, new(mockLogger.MockLogger), 0)
+	m.load()
+
+	return m, tm
+}
+
+// Changes are handed to the task manager one task at a time, leaving the others alone.
+func TestMirror_ApplyChange(t *testing.T) {
+	m, tm := mirrorOf(3)
+	if tm.TotalTasks() != 3 {
+		t.Fatalf("Expected every task to be handed over when loading, got %d", tm.TotalTasks())
+	}
+	untouched, _ := tm.Get(utils.ProtoString("task-2"))
+
+	m.apply(persistence.Event{
+		Type:     persistence.Put,
+		Key:      manager.TASK_DIRECTORY + "task-0",
+		Value:    record("task-0", sdkTaskManager.RUNNING),
+		Revision: 10,
+	})
+	m.apply(persistence.Event{Type: persistence.Delete, Key: manager.TASK_DIRECTORY + "task-1", Revision: 11})
+	m.apply(persistence.Event{Type: persistence.Put, Key: manager.TASK_DIRECTORY + "task-2", Value: "corrupt", Revision: 12})
+
+	if task, err := tm.Get(utils.ProtoString("task-0")); err != nil || task.State != sdkTaskManager.RUNNING {
+		t.Fatal("Expected the changed task to be replaced")
+	}
+	if tm.HasTask(&mesos_v1.TaskInfo{Name: utils.ProtoString("task-1")}) {
+		t.Fatal("Expected the deleted task to be gone")
+	}
+	if tm.HasTask(untouched.Info) {
+		t.Fatal("Expected a task that can no longer be read to be gone")
+	}
+
+	m.apply(persistence.Event{Type: persistence.Put, Key: manager.TASK_DIRECTORY + "task-3", Value: record("task-3", sdkTaskManager.UNKNOWN)})
+	if tm.TotalTasks() != 2 || m.Revision() != 12 {
+		t.Fatalf("Expected a new task to be added, got %d tasks at revision %d", tm.TotalTasks(), m.Revision())
+	}
+
+	// A task given a new ID moves to a new key, deleting the old one afterwards leaves it be.
+	m.apply(persistence.Event{Type: persistence.Put, Key: manager.TASK_DIRECTORY + "task-3.1", Value: record("task-3", sdkTaskManager.RUNNING)})
+	m.apply(persistence.Event{Type: persistence.Delete, Key: manager.TASK_DIRECTORY + "task-3"})
+	if task, err := tm.Get(utils.ProtoString("task-3")); err != nil || task.State != sdkTaskManager.RUNNING {
+		t.Fatal("Expected the task to be held under its new key")
+	}
+}
+
+// Applying a change costs the same however many tasks there are.
+func BenchmarkMirror_Apply(b *testing.B) {
+	m, _ := mirrorOf(10000)
+	event := persistence.Event{
+		Type:  persistence.Put,
+		Key:   manager.TASK_DIRECTORY + "task-0",
+		Value: record("task-0", sdkTaskManager.RUNNING),
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event.Revision = int64(i)
+		m.apply(event)
+	}
+}
+
+func mustRead(kv *memory.Memory, key string) string {
+	v, _ := kv.Read(key)
+	return v
+}
@@ -17,24 +17,27 @@ package events
 import (
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
 	mockTaskManager "hydrogen/task/manager/test"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
 	"testing"
 )
 
 func TestHandler_Error(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Error(&mesos_v1_scheduler.Event_Error{
@@ -45,11 +48,13 @@ func TestHandler_Error(t *testing.T) {
 func TestHandler_ErrorWithNoMessage(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Error(&mesos_v1_scheduler.Event_Error{
@@ -17,45 +17,70 @@ package events
 import (
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
-	resourceManager "mesos-framework-sdk/resources/manager"
 	"mesos-framework-sdk/scheduler"
 	"mesos-framework-sdk/scheduler/events"
 	taskManager "mesos-framework-sdk/task/manager"
 	"os"
 	sched "hydrogen/scheduler"
+	"hydrogen/scheduler/status"
+	"hydrogen/task/maintenance"
+	"hydrogen/task/manager"
 	"hydrogen/task/persistence"
+	"hydrogen/task/placement"
+	"hydrogen/task/volumes"
 	"sync"
+	"time"
 )
 
 // Event contains various event handlers and holds data that callbacks need to access/modify.
 type Handler struct {
-	taskManager     taskManager.TaskManager
-	resourceManager resourceManager.ResourceManager
+	taskManager     manager.TaskManager
+	resourceManager manager.ResourceManager
+	agents          *placement.Agents
+	reservations    *volumes.Reservations
+	maintenance     *maintenance.Agents
+	waiting         map[string]time.Time // When each queued task started waiting to be launched.
+	launching       map[string]string    // Offer each launched task was placed on, by task ID, until Mesos reports on it.
 	config          *sched.Configuration
 	scheduler       scheduler.Scheduler
 	storage         persistence.Storage
 	revive          chan *taskManager.Task
+	status          *status.Status
 	logger          logging.Logger
 	frameworkLease  int64
 	sync.RWMutex
 }
 
 // NewEvent returns a new Event type which adheres to the SchedulerEvent interface.
-func NewHandler(t taskManager.TaskManager,
-	r resourceManager.ResourceManager,
+func NewHandler(t manager.TaskManager,
+	r manager.ResourceManager,
 	c *sched.Configuration,
 	s scheduler.Scheduler,
 	o persistence.Storage,
+	rv *volumes.Reservations,
 	v chan *taskManager.Task,
+	st *status.Status,
 	l logging.Logger) events.SchedulerEvent {
 
+	// Agents are written in the background along with everything else we persist.
+	size, delay := manager.DEFAULT_BATCH_SIZE, manager.DEFAULT_BATCH_DELAY
+	if c.Persistence != nil {
+		size, delay = c.Persistence.BatchSize, c.Persistence.BatchDelay
+	}
+
 	return &Handler{
 		taskManager:     t,
 		resourceManager: r,
+		agents:          placement.NewAgents(o, persistence.NewWriter(o, size, delay, l)),
+		reservations:    rv,
+		maintenance:     maintenance.NewAgents(),
+		waiting:         make(map[string]time.Time),
+		launching:       make(map[string]string),
 		config:          c,
 		scheduler:       s,
 		storage:         o,
 		revive:          v,
+		status:          st,
 		logger:          l,
 	}
 }
@@ -82,6 +107,7 @@ func (h *Handler) Run(event *mesos_v1_scheduler.Event) {
 	case mesos_v1_scheduler.Event_UPDATE:
 		h.Update(event.GetUpdate())
 	case mesos_v1_scheduler.Event_HEARTBEAT:
+		h.status.Heartbeat()
 		h.refreshFrameworkIdLease()
 	case mesos_v1_scheduler.Event_UNKNOWN:
 		h.logger.Emit(logging.ALARM, "Unknown event received")
@@ -90,6 +116,9 @@ func (h *Handler) Run(event *mesos_v1_scheduler.Event) {
 }
 
 func (h *Handler) Signals() {
+	// Don't leave task changes behind for the next leader to rediscover.
+	h.taskManager.Flush()
+
 	h.RLock()
 	if h.frameworkLease == 0 {
 		os.Exit(0)
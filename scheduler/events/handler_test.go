@@ -16,12 +16,13 @@ package events
 
 import (
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
 	mockTaskManager "hydrogen/task/manager/test"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
 	"testing"
 )
 
@@ -29,11 +30,13 @@ import (
 func TestHandler_NewHandler(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	if e == nil {
@@ -45,11 +48,13 @@ func TestHandler_NewHandler(t *testing.T) {
 func TestHandler_Signals(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Signals()
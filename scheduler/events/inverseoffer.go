@@ -15,11 +15,137 @@
 package events
 
 import (
+	"hydrogen/task/maintenance"
+	"hydrogen/task/placement"
+	"hydrogen/task/priority"
+	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
+	"mesos-framework-sdk/scheduler/strategy"
+	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
+	"net/http"
+	"strings"
+	"time"
 )
 
-// Inverse offers
+// How long Mesos waits before sending an inverse offer we declined again, so we can check on the tasks we're moving.
+const inverseRefuseSeconds = 30.0
+
+// Schedulers that can answer inverse offers, which the SDK's scheduler interface leaves out.
+// Inverse offers we can't answer are left to time out, the tasks on their agents are moved all the same.
+type inverseOfferResponder interface {
+	AcceptInverseOffers(ids []*mesos_v1.OfferID, filters *mesos_v1.Filters) (*http.Response, error)
+	DeclineInverseOffers(ids []*mesos_v1.OfferID, filters *mesos_v1.Filters) (*http.Response, error)
+}
+
+// InverseOffer handles Mesos asking for agents back for maintenance.
+// Nothing new is placed on those agents, and the tasks running on them are killed and queued again so they're launched
+// elsewhere, as long as UNIQUE groups keep the configured share of their instances running.
+// Inverse offers are accepted once none of our tasks are left on their agent, and declined until then.
 func (e *Handler) InverseOffer(ioffers *mesos_v1_scheduler.Event_InverseOffers) {
 	e.logger.Emit(logging.INFO, "Inverse Offer event recieved: %v", ioffers)
+
+	var accepted, declined []*mesos_v1.OfferID
+	for _, offer := range ioffers.GetInverseOffers() {
+		if !maintenance.Affects(offer.GetUnavailability(), time.Now()) {
+			accepted = append(accepted, offer.GetId())
+			continue
+		}
+
+		e.maintenance.Drain(offer)
+		if e.drain(offer.GetAgentId().GetValue()) {
+			accepted = append(accepted, offer.GetId())
+		} else {
+			declined = append(declined, offer.GetId())
+		}
+	}
+
+	if len(accepted) == 0 && len(declined) == 0 {
+		return
+	}
+	responder, ok := e.scheduler.(inverseOfferResponder)
+	if !ok {
+		e.logger.Emit(logging.INFO, "Leaving inverse offers to time out, the scheduler can't answer them")
+		return
+	}
+	if len(accepted) > 0 {
+		if _, err := responder.AcceptInverseOffers(accepted, nil); err != nil {
+			e.logger.Emit(logging.ERROR, "Failed to accept inverse offers: %s", err.Error())
+		}
+	}
+	if len(declined) > 0 {
+		filters := &mesos_v1.Filters{RefuseSeconds: utils.ProtoFloat64(inverseRefuseSeconds)}
+		if _, err := responder.DeclineInverseOffers(declined, filters); err != nil {
+			e.logger.Emit(logging.ERROR, "Failed to decline inverse offers: %s", err.Error())
+		}
+	}
+}
+
+// Moves our tasks off an agent going down for maintenance, telling us if none of them are left on it.
+// Tasks are marked before they're killed so they're queued again once they're gone, like preempted tasks are.
+// Tasks with a persistent volume can't be moved, and neither can instances a UNIQUE group can't spare yet.
+func (e *Handler) drain(agent string) bool {
+	all, err := e.taskManager.All()
+	if err != nil {
+		if e.taskManager.TotalTasks() == 0 {
+			return true // We have no tasks anywhere.
+		}
+
+		// We can't tell what's running there, so the inverse offer is declined and we look again when it's retried.
+		e.logger.Emit(logging.ERROR, "Failed to find our tasks on agent %s: %s", agent, err.Error())
+		return false
+	}
+
+	clear := true
+	moving := []*manager.Task{}
+	for _, task := range all {
+		if task.Info.GetAgentId().GetValue() != agent {
+			continue
+		}
+		if task.State != manager.STAGING && task.State != manager.STARTING && task.State != manager.RUNNING {
+			continue
+		}
+
+		clear = false
+		if priority.Preempted(task) {
+			continue // Already on its way.
+		}
+		if placement.Of(task).Volume != nil {
+			e.logger.Emit(logging.INFO, "Task %s can't be moved off agent %s, its volume is there", task.Info.GetName(), agent)
+			continue
+		}
+		if task.GroupInfo.InGroup && strings.ToLower(task.Strategy.Type) == strategy.UNIQUE {
+			group, err := e.taskManager.GetGroup(task)
+			if err != nil || !maintenance.Movable(task, group, e.config.Scheduler.MaintenanceMin, priority.Preempted) {
+				continue
+			}
+		}
+
+		priority.MarkPreempted(task)
+		moving = append(moving, task)
+	}
+
+	if len(moving) == 0 {
+		return clear
+	}
+
+	e.taskManager.Update(moving...)
+	if err := e.taskManager.Flush(); err != nil {
+		e.logger.Emit(logging.ERROR, "Not moving tasks that couldn't be persisted: %s", err.Error())
+		for _, task := range moving {
+			priority.ClearPreempted(task)
+		}
+		e.taskManager.Update(moving...)
+		return false
+	}
+
+	for _, task := range moving {
+		e.logger.Emit(logging.INFO, "Moving task %s off agent %s for maintenance", task.Info.GetName(), agent)
+		if _, err := e.scheduler.Kill(task.Info.GetTaskId(), task.Info.GetAgentId()); err != nil {
+			e.logger.Emit(logging.ERROR, "Failed to kill task %s: %s", task.Info.GetName(), err.Error())
+		}
+	}
+
+	return false
 }
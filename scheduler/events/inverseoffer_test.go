@@ -18,24 +18,181 @@ import (
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
+	taskManager "hydrogen/task/manager"
 	mockTaskManager "hydrogen/task/manager/test"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/placement"
+	"hydrogen/task/priority"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/task"
+	"net/http"
 	"testing"
+	"time"
 )
 
+// Records how inverse offers are answered, along with what the recording scheduler does.
+type maintenanceScheduler struct {
+	recordingScheduler
+	accepted *[]string
+	declined *[]string
+}
+
+func (m maintenanceScheduler) AcceptInverseOffers(ids []*mesos_v1.OfferID, f *mesos_v1.Filters) (*http.Response, error) {
+	for _, id := range ids {
+		*m.accepted = append(*m.accepted, id.GetValue())
+	}
+	return nil, nil
+}
+
+func (m maintenanceScheduler) DeclineInverseOffers(ids []*mesos_v1.OfferID, f *mesos_v1.Filters) (*http.Response, error) {
+	for _, id := range ids {
+		*m.declined = append(*m.declined, id.GetValue())
+	}
+	return nil, nil
+}
+
+func inverseOffer(id, agent string) *mesos_v1_scheduler.Event_InverseOffers {
+	return &mesos_v1_scheduler.Event_InverseOffers{InverseOffers: []*mesos_v1.InverseOffer{{
+		Id:      &mesos_v1.OfferID{Value: utils.ProtoString(id)},
+		AgentId: &mesos_v1.AgentID{Value: utils.ProtoString(agent)},
+		Unavailability: &mesos_v1.Unavailability{
+			Start: &mesos_v1.TimeInfo{Nanoseconds: utils.ProtoInt64(time.Now().Add(time.Hour).UnixNano())},
+		},
+	}}}
+}
+
+// Tasks are moved off agents going down for maintenance, as long as their UNIQUE group can spare them, and nothing
+// new is placed there until Mesos takes the inverse offer back.
+func TestHandler_InverseOfferDrain(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	apps := []*manager.Task{
+		{Info: &mesos_v1.TaskInfo{Name: utils.ProtoString("web")}, Instances: 2, Strategy: task.Strategy{Type: "unique"}},
+		{Info: &mesos_v1.TaskInfo{Name: utils.ProtoString("cache")}, Instances: 1},
+		{
+			Info:      &mesos_v1.TaskInfo{Name: utils.ProtoString("db")},
+			Instances: 1,
+			Filters:   []task.Filter{placement.Placement{Volume: &volumes.Volume{Size: 1, ContainerPath: "data", Mode: volumes.RW}}.Filter()},
+		},
+	}
+	for _, app := range apps {
+		app.Info.TaskId = &mesos_v1.TaskID{Value: utils.ProtoString(app.Info.GetName())}
+		app.Info.Resources = []*mesos_v1.Resource{{
+			Name:   utils.ProtoString("cpu"),
+			Type:   mesos_v1.Value_SCALAR.Enum(),
+			Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+		}}
+		if err := tm.Add(app); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	for name, agent := range map[string]string{"web-1": "a", "web-2": "b", "cache": "a", "db": "a"} {
+		instance, _ := tm.Get(utils.ProtoString(name))
+		instance.State = manager.RUNNING
+		instance.Info.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString(agent)}
+	}
+
+	s := maintenanceScheduler{recordingScheduler: newRecordingScheduler(), accepted: new([]string), declined: new([]string)}
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: &scheduler.SchedulerConfiguration{MaintenanceMin: 0.5},
+		},
+		s,
+		storage,
+		volumes.NewReservations(storage),
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	).(*Handler)
+
+	e.InverseOffer(inverseOffer("1", "a"))
+	if len(*s.killed) != 2 || len(*s.declined) != 1 {
+		t.Fatalf("Expected web-1 and cache to be moved and the inverse offer declined, killed %v", *s.killed)
+	}
+	for _, name := range []string{"web-1", "cache"} {
+		if moved, _ := tm.Get(utils.ProtoString(name)); !priority.Preempted(moved) {
+			t.Fatalf("Expected %s to be queued again once it's gone", name)
+		}
+	}
+
+	e.InverseOffer(inverseOffer("2", "b"))
+	if len(*s.killed) != 2 || len(*s.declined) != 2 {
+		t.Fatalf("web can't spare another instance while web-1 is moving, killed %v", *s.killed)
+	}
+
+	e.Update(&mesos_v1_scheduler.Event_Update{Status: &mesos_v1.TaskStatus{
+		TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("cache")},
+		State:  mesos_v1.TaskState_TASK_KILLED.Enum(),
+	}})
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{agentOffer("3", "a")}})
+	if cache, _ := tm.Get(utils.ProtoString("cache")); cache.State != manager.UNKNOWN {
+		t.Fatal("Nothing should be placed on an agent going down for maintenance")
+	}
+
+	e.RescindInverseOffer(&mesos_v1_scheduler.Event_RescindInverseOffer{InverseOfferId: &mesos_v1.OfferID{Value: utils.ProtoString("1")}})
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{agentOffer("4", "a")}})
+	if cache, _ := tm.Get(utils.ProtoString("cache")); cache.State != manager.STAGING {
+		t.Fatal("Expected the agent to be placed on again once the inverse offer is rescinded")
+	}
+
+	// Once nothing of ours is left on an agent, its inverse offer is accepted.
+	e.InverseOffer(inverseOffer("5", "c"))
+	if len(*s.accepted) != 1 || (*s.accepted)[0] != "5" {
+		t.Fatalf("Expected the inverse offer for an empty agent to be accepted, got %v", *s.accepted)
+	}
+}
+
+// Holds tasks, but can't list them.
+type unlistableTaskManager struct {
+	mockTaskManager.MockBrokenTaskManager
+}
+
+func (u unlistableTaskManager) TotalTasks() int {
+	return 1
+}
+
+// Agents aren't given up while we can't tell whether our tasks are on them.
+func TestHandler_InverseOfferUnknownTasks(t *testing.T) {
+	s := maintenanceScheduler{recordingScheduler: newRecordingScheduler(), accepted: new([]string), declined: new([]string)}
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	e := NewHandler(
+		unlistableTaskManager{},
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{Scheduler: new(scheduler.SchedulerConfiguration)},
+		s,
+		storage,
+		volumes.NewReservations(storage),
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	)
+
+	e.InverseOffer(inverseOffer("1", "a"))
+	if len(*s.accepted) != 0 || len(*s.declined) != 1 {
+		t.Fatalf("Expected the inverse offer to be declined, accepted %v", *s.accepted)
+	}
+}
+
 func TestHandler_InverseOffer(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.InverseOffer(&mesos_v1_scheduler.Event_InverseOffers{
@@ -52,11 +209,13 @@ func TestHandler_InverseOffer(t *testing.T) {
 func TestHandler_InverseOfferWithNilOffer(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.InverseOffer(&mesos_v1_scheduler.Event_InverseOffers{
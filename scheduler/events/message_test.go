@@ -18,13 +18,14 @@ import (
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
 	mockTaskManager "hydrogen/task/manager/test"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
 	"testing"
 )
 
@@ -32,11 +33,13 @@ import (
 func TestHandler_Message(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Message(&mesos_v1_scheduler.Event_Message{
@@ -50,11 +53,13 @@ func TestHandler_Message(t *testing.T) {
 func TestHandler_MessageNoData(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Message(&mesos_v1_scheduler.Event_Message{
@@ -67,11 +72,13 @@ func TestHandler_MessageNoData(t *testing.T) {
 func TestHandler_NilMessage(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Message(nil)
@@ -81,11 +88,13 @@ func TestHandler_NilMessage(t *testing.T) {
 func TestHandler_MessageWithNoAgent(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Message(&mesos_v1_scheduler.Event_Message{
@@ -104,11 +113,13 @@ func TestHandler_MessageWithNoAgent(t *testing.T) {
 func TestHandler_MessageWithNoExecutor(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Message(&mesos_v1_scheduler.Event_Message{
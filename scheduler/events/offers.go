@@ -15,6 +15,14 @@
 package events
 
 import (
+	"errors"
+	taskManager "hydrogen/task/manager"
+	"hydrogen/task/maintenance"
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
+	"hydrogen/task/priority"
+	"hydrogen/task/queue"
+	"hydrogen/task/volumes"
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
@@ -22,7 +30,9 @@ import (
 	"mesos-framework-sdk/scheduler/strategy"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -37,19 +47,44 @@ const (
 // master.
 //
 func (e *Handler) Offers(offerEvent *mesos_v1_scheduler.Event_Offers) {
+	// Volumes of deleted tasks are destroyed first, offers holding them aren't used for anything else.
+	offers := e.releaseVolumes(offerEvent.GetOffers())
+	// Nothing is placed on agents going down for maintenance.
+	offers = e.avoidMaintenance(offers)
+	e.forgetLaunches()
+
 	// Check if we have any in the task manager we want to launch
 	queued, err := e.taskManager.AllByState(manager.UNKNOWN)
 
 	if err != nil {
 		e.logger.Emit(logging.INFO, "No tasks to launch.")
-		e.scheduler.Suppress()
-		e.declineOffers(offerEvent.GetOffers(), refuseSeconds)
+		e.status.SetQueue(nil)
+		// Volumes waiting to be destroyed still need offers.
+		if released, err := e.reservations.Released(); err == nil && len(released) == 0 {
+			e.scheduler.Suppress()
+		}
+		e.declineOffers(offers, refuseSeconds)
 		return
 	}
 
+	// Higher priority tasks are placed first, so they get the pick of the offers.
+	// Applications of the same priority take turns, so none of them waits on another with more instances.
+	e.wait(queued)
+	queued = queue.Order(queued, e.waiting)
+	defer e.publishQueue(queued)
+
+	// Remember the agents we're offered so constraints can be checked against where instances are placed.
+	if err := e.agents.Observe(offers); err != nil {
+		e.logger.Emit(logging.ERROR, "Failed to record offered agents: %s", err.Error())
+	}
+
 	// Update our resources in the manager
-	e.resourceManager.AddOffers(offerEvent.GetOffers())
+	e.resourceManager.AddOffers(offers)
 	accepts := make(map[*mesos_v1.OfferID][]*mesos_v1.Offer_Operation)
+	launched := []*manager.Task{}
+	offerOf := make(map[string]string)
+	round := make(placements)
+	abandoned := []*mesos_v1.Offer{} // Assigned a task we then couldn't launch on it.
 
 	for _, task := range queued {
 		// If we've hit max retries of a task, kill itself.
@@ -58,22 +93,43 @@ func (e *Handler) Offers(offerEvent *mesos_v1_scheduler.Event_Offers) {
 			continue
 		}
 
-		if !e.resourceManager.HasResources() {
+		if max := e.config.Scheduler.MaxLaunches; max > 0 && len(launched) >= max {
 			break
 		}
 
-		offer, err := e.resourceManager.Assign(task)
-
+		reservation, err := e.reservation(task)
 		if err != nil {
-			// It didn't match any offers.
 			e.logger.Emit(logging.ERROR, err.Error())
-			task.Reschedule(e.revive)
 			continue
 		}
 
-		if !e.applyStrategy(task, offer) {
+		// Once every unreserved resource is used, only tasks offered their volume can still be launched.
+		// What's reserved for them isn't counted, so they're looked for among the rest of the queue.
+		if !e.resourceManager.HasResources() && !held(reservation, offers) {
 			continue
 		}
+
+		// Only offers that the task's strategy and constraints allow are considered.
+		intent := placement.Of(task)
+		placed := e.placed(task, round)
+		available := fitting(task, offers)
+		accept := func(offer *mesos_v1.Offer) bool {
+			agent := placement.Describe(offer)
+			return applyStrategy(task, intent, agent, placed, available) && placement.Satisfied(intent.Constraints, agent, placed)
+		}
+		assignee := task
+		if reservation != nil {
+			assignee, accept = pin(task, reservation, offers, accept)
+		}
+		assignment, err := e.resourceManager.AssignIf(assignee, accept)
+
+		if err != nil {
+			// It didn't match any offers.
+			e.logger.Emit(logging.ERROR, err.Error())
+			task.Reschedule(e.revive)
+			continue
+		}
+		offer := assignment.Offer
 		mesosTask := task.Info
 		t := &mesos_v1.TaskInfo{
 			Name:        mesosTask.Name,
@@ -86,6 +142,22 @@ func (e *Handler) Offers(offerEvent *mesos_v1_scheduler.Event_Offers) {
 			HealthCheck: mesosTask.GetHealthCheck(),
 		}
 
+		operations := []*mesos_v1.Offer_Operation{}
+		if reservation != nil {
+			if !reservation.Holds(offer) {
+				// The reservation is persisted before it's made, so that we never lose track of a volume.
+				reservation.AgentID = offer.GetAgentId().GetValue()
+				if err := e.reservations.Add(reservation); err != nil {
+					e.logger.Emit(logging.ERROR, "Failed to persist the reservation for task %s: %s", task.Info.GetName(), err.Error())
+					abandoned = append(abandoned, offer)
+					continue
+				}
+				operations = append(operations, reservation.Reserve(), reservation.Create())
+			}
+			t.Resources = reservation.Launched()
+		}
+		setPorts(t, intent.Ports, assignment.Ports)
+
 		if e.config.Executor.CustomExecutor && t.Executor == nil {
 			e.setupExecutor(t)
 		}
@@ -94,19 +166,58 @@ func (e *Handler) Offers(offerEvent *mesos_v1_scheduler.Event_Offers) {
 		task.State = manager.STAGING
 
 		e.taskManager.Update(task)
+		launched = append(launched, task)
+		offerOf[task.Info.GetTaskId().GetValue()] = offer.GetId().GetValue()
+		round.add(task, placement.Describe(offer))
 
-		accepts[offer.Id] = append(accepts[offer.Id], resources.LaunchOfferOperation([]*mesos_v1.TaskInfo{t}))
+		operations = append(operations, resources.LaunchOfferOperation([]*mesos_v1.TaskInfo{t}))
+		accepts[offer.Id] = append(accepts[offer.Id], operations...)
+	}
+
+	// Offers we gave up on are declined along with the rest, unless another task is launched on them.
+	unused := []*mesos_v1.Offer{}
+	for _, offer := range abandoned {
+		if _, ok := accepts[offer.Id]; !ok {
+			unused = append(unused, offer)
+		}
+	}
+
+	// Every launch is persisted in one go before we launch anything.
+	// If that fails the tasks go back in the queue, and the offers we'd used are declined along with the rest.
+	if err := e.taskManager.Flush(); err != nil {
+		e.logger.Emit(logging.ERROR, "Not launching tasks that couldn't be persisted: %s", err.Error())
+		for _, task := range launched {
+			task.State = manager.UNKNOWN
+		}
+		e.taskManager.Update(launched...)
+
+		declineIDs := make([]*mesos_v1.OfferID, 0, len(accepts))
+		for id := range accepts {
+			declineIDs = append(declineIDs, id)
+		}
+		if len(declineIDs) > 0 {
+			e.scheduler.Decline(declineIDs, &mesos_v1.Filters{RefuseSeconds: utils.ProtoFloat64(refuseSeconds)})
+		}
+		e.declineOffers(append(e.resourceManager.Offers(), unused...), refuseSeconds)
+		return
+	}
+
+	// Remember where tasks were launched in case Mesos takes the offers back before it tells us about them.
+	for id, offer := range offerOf {
+		e.launching[id] = offer
 	}
 
 	// Multiplex our tasks onto as few offers as possible and launch them all.
 	for id, launches := range accepts {
-		// TODO (tim) The offer operations will need to be parsed for volume mounting and etc.)
 		e.scheduler.Accept([]*mesos_v1.OfferID{id}, launches, nil)
 	}
 
+	// Make room for whatever's been waiting too long.
+	e.preempt(queued)
+
 	// Resource manager pops offers when they are accepted
 	// Offers() returns a list of what is left, therefore whatever is left is to be rejected.
-	e.declineOffers(e.resourceManager.Offers(), refuseSeconds)
+	e.declineOffers(append(e.resourceManager.Offers(), unused...), refuseSeconds)
 }
 
 func (e *Handler) setupExecutor(t *mesos_v1.TaskInfo) {
@@ -164,37 +275,439 @@ func (e *Handler) declineOffers(offers []*mesos_v1.Offer, refuseSeconds float64)
 	e.scheduler.Decline(declineIDs, &mesos_v1.Filters{RefuseSeconds: utils.ProtoFloat64(refuseSeconds)})
 }
 
-// Tells us if the strategy the task has is applicable to this offer.
-func (e *Handler) applyStrategy(task *manager.Task, offer *mesos_v1.Offer) bool {
-	// Apply the strategy.
+// Where instances have been placed while handling a single batch of offers, by group name and then task name.
+// Decisions made earlier in the batch have to count for tasks placed later in it, whatever the task manager shows.
+type placements map[string]map[string]*placement.Agent
+
+// Records that the task has been placed on the agent.
+func (p placements) add(task *manager.Task, agent *placement.Agent) {
+	if !task.GroupInfo.InGroup {
+		return
+	}
+
+	group := p[task.GroupInfo.GroupName]
+	if group == nil {
+		group = make(map[string]*placement.Agent)
+		p[task.GroupInfo.GroupName] = group
+	}
+	group[task.Info.GetName()] = agent
+}
+
+// Tells us if the strategy the task has is applicable to the agent, given the task's placement.
+// Placed are the agents the task's other instances are on and available are those we're offered.
+func applyStrategy(task *manager.Task, intent placement.Placement, agent *placement.Agent, placed, available []*placement.Agent) bool {
 	switch strings.ToLower(task.Strategy.Type) {
-	case strategy.COLOCATE:
+	case placement.SPREAD:
+		return placement.Balanced(intent.SpreadField(), agent, placed, available)
 	case strategy.UNIQUE:
-		if task.GroupInfo.InGroup {
-			groupTasks, err := e.taskManager.GetGroup(task)
-			if err != nil {
-				e.logger.Emit(logging.ERROR, err.Error())
+		// No two instances share an agent, a task without a group has nothing to be unique from.
+		for _, p := range placed {
+			if p.ID == agent.ID {
 				return false
 			}
-			for _, groupTask := range groupTasks {
-				// If we've already launched onto this agent.
-				if groupTask.Info != nil && groupTask.Info.AgentId != nil {
-					if groupTask.Info.AgentId.GetValue() == offer.AgentId.GetValue() {
-						return false
-					}
-				}
+		}
+	case strategy.COLOCATE:
+	default:
+	}
+
+	return true
+}
+
+// Agents of the offers that can fit the task, which its spread strategy balances across.
+func fitting(task *manager.Task, offers []*mesos_v1.Offer) []*placement.Agent {
+	agents := make([]*placement.Agent, 0, len(offers))
+	for _, offer := range offers {
+		if taskManager.HasScalars(offer, task.Info.GetResources()) && taskManager.MatchesFilters(offer, task.Filters) {
+			agents = append(agents, placement.Describe(offer))
+		}
+	}
+
+	return agents
+}
+
+// Agents that the task's other instances are placed on, including those placed earlier in this round.
+// Only instances that are staging or running count, wherever instances that have since died used to be.
+func (e *Handler) placed(task *manager.Task, round placements) []*placement.Agent {
+	if !task.GroupInfo.InGroup {
+		return nil
+	}
+
+	group, err := e.taskManager.GetGroup(task)
+	if err != nil {
+		e.logger.Emit(logging.ERROR, err.Error())
+	}
+
+	agents := make(map[string]*placement.Agent)
+	for _, other := range group {
+		if other.State != manager.STAGING && other.State != manager.STARTING && other.State != manager.RUNNING {
+			continue
+		}
+
+		id := other.Info.GetAgentId().GetValue()
+		if id == "" {
+			continue
+		}
+		agent, ok := e.agents.Get(id)
+		if !ok {
+			// We haven't been offered the agent, so only what it is counts.
+			agent = &placement.Agent{ID: id}
+		}
+		agents[other.Info.GetName()] = agent
+	}
+	for name, agent := range round[task.GroupInfo.GroupName] {
+		agents[name] = agent
+	}
+	delete(agents, task.Info.GetName())
+
+	placed := make([]*placement.Agent, 0, len(agents))
+	for _, agent := range agents {
+		placed = append(placed, agent)
+	}
+
+	return placed
+}
+
+// Hands the task the host ports it was allocated.
+// They're claimed as a resource, passed in as environment variables, mapped into container networks and announced
+// through discovery. Whatever ports an earlier launch of the task was given are replaced.
+func setPorts(t *mesos_v1.TaskInfo, requested []ports.Port, allocated []uint32) {
+	res := make([]*mesos_v1.Resource, 0, len(t.Resources)+1)
+	for _, r := range t.GetResources() {
+		if r.GetName() != ports.RESOURCE {
+			res = append(res, r)
+		}
+	}
+	t.Resources = res
+
+	if len(requested) == 0 {
+		return
+	}
+	t.Resources = append(t.Resources, ports.Resource(allocated))
+
+	// The command and container are shared with the task we launched from, so they're copied before being changed.
+	if t.Command != nil {
+		cmd := *t.Command
+		env := &mesos_v1.Environment{}
+		vars := ports.Environment(requested, allocated)
+		for _, v := range cmd.GetEnvironment().GetVariables() {
+			if _, ok := vars[v.GetName()]; !ok {
+				env.Variables = append(env.Variables, v)
 			}
-		} else {
-			if t, err := e.taskManager.Get(task.Info.Name); err != nil {
-				if t.Info.AgentId != nil {
-					if t.Info.AgentId.GetValue() == offer.AgentId.GetValue() {
-						return false
-					}
+		}
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			env.Variables = append(env.Variables, &mesos_v1.Environment_Variable{
+				Name:  utils.ProtoString(name),
+				Value: utils.ProtoString(vars[name]),
+			})
+		}
+		cmd.Environment = env
+		t.Command = &cmd
+	}
+
+	mappings := []*mesos_v1.NetworkInfo_PortMapping{}
+	discovery := &mesos_v1.Ports{}
+	for i, p := range requested {
+		host := allocated[i]
+		discovery.Ports = append(discovery.Ports, &mesos_v1.Port{
+			Number:   &host,
+			Name:     utils.ProtoString(p.Name),
+			Protocol: utils.ProtoString(p.Protocol),
+		})
+		if p.Container != 0 {
+			container := p.Container
+			mappings = append(mappings, &mesos_v1.NetworkInfo_PortMapping{
+				HostPort:      &host,
+				ContainerPort: &container,
+				Protocol:      utils.ProtoString(p.Protocol),
+			})
+		}
+	}
+	t.Discovery = &mesos_v1.DiscoveryInfo{
+		Visibility: mesos_v1.DiscoveryInfo_FRAMEWORK.Enum(),
+		Name:       t.Name,
+		Ports:      discovery,
+	}
+
+	if t.Container != nil && len(t.Container.NetworkInfos) > 0 {
+		container := *t.Container
+		container.NetworkInfos = make([]*mesos_v1.NetworkInfo, 0, len(t.Container.NetworkInfos))
+		for _, n := range t.Container.NetworkInfos {
+			network := *n
+			network.PortMappings = mappings
+			container.NetworkInfos = append(container.NetworkInfos, &network)
+		}
+		t.Container = &container
+	}
+}
+
+// The reservation for a task with a persistent volume, or a new one if the task has yet to be given its volume.
+// Tasks without a volume have none.
+func (e *Handler) reservation(task *manager.Task) (*volumes.Reservation, error) {
+	volume := placement.Of(task).Volume
+	if volume == nil {
+		return nil, nil
+	}
+
+	reservation, err := e.reservations.Get(task.Info.GetName())
+	if err != nil || reservation != nil {
+		return reservation, err
+	}
+
+	role := e.config.Scheduler.Role
+	if role == "" || role == "*" {
+		return nil, errors.New("Task " + task.Info.GetName() + " has a persistent volume, which needs the scheduler to have a role")
+	}
+
+	return volumes.New(task.Info.GetName(), role, e.config.Scheduler.Principal, task.Info.GetResources(), *volume), nil
+}
+
+// What's asked of the resource manager for a task with a persistent volume.
+// Until the volume's been placed, the task needs its own resources and the volume's disk out of any offer it'd accept.
+// From then on only the agent holding it is accepted. If we're offered the volume the task needs nothing more than
+// what's reserved for it, otherwise it's reserved again, since the last attempt never made it.
+func pin(task *manager.Task, r *volumes.Reservation, offers []*mesos_v1.Offer, accept func(*mesos_v1.Offer) bool) (*manager.Task, func(*mesos_v1.Offer) bool) {
+	if r.AgentID == "" {
+		return withResources(task, r.Needs()), accept
+	}
+
+	needs := r.Needs()
+	if held(r, offers) {
+		needs = nil
+	}
+
+	return withResources(task, needs), func(offer *mesos_v1.Offer) bool {
+		return offer.GetAgentId().GetValue() == r.AgentID && (needs != nil || r.Holds(offer))
+	}
+}
+
+// Tells us if we're offered the volume the reservation holds. Tasks without a reservation have none.
+func held(r *volumes.Reservation, offers []*mesos_v1.Offer) bool {
+	if r == nil || r.AgentID == "" {
+		return false
+	}
+
+	for _, offer := range offers {
+		if r.Holds(offer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A copy of the task that needs the given resources instead of its own.
+func withResources(task *manager.Task, res []*mesos_v1.Resource) *manager.Task {
+	info := *task.Info
+	info.Resources = res
+	copied := *task
+	copied.Info = &info
+
+	return &copied
+}
+
+// Destroys the volumes of deleted tasks and unreserves what they had, on whichever offers hold them.
+// Returns the offers that are left over, including those we failed to destroy volumes on, so they're used or declined.
+func (e *Handler) releaseVolumes(offers []*mesos_v1.Offer) []*mesos_v1.Offer {
+	// Volumes we haven't been offered in a long time are given up on, so they don't keep us from suppressing offers.
+	if timeout := e.config.Scheduler.ReleaseTimeout; timeout > 0 {
+		expired, err := e.reservations.Expire(timeout)
+		if err != nil {
+			e.logger.Emit(logging.ERROR, "Failed to expire reservations: %s", err.Error())
+		}
+		for _, r := range expired {
+			e.logger.Emit(
+				logging.ALARM,
+				"Gave up destroying the volume %s of task %s on agent %s, it has to be destroyed by hand",
+				r.PersistenceID,
+				r.Task,
+				r.AgentID,
+			)
+		}
+	}
+
+	released, err := e.reservations.Released()
+	if err != nil {
+		e.logger.Emit(logging.ERROR, "Failed to read reservations: %s", err.Error())
+		return offers
+	}
+	if len(released) == 0 {
+		return offers
+	}
+
+	left := make([]*mesos_v1.Offer, 0, len(offers))
+	for _, offer := range offers {
+		operations := []*mesos_v1.Offer_Operation{}
+		tasks := []string{}
+		for _, r := range released {
+			if r.Holds(offer) {
+				operations = append(operations, r.Destroy(), r.Unreserve())
+				tasks = append(tasks, r.Task)
+			}
+		}
+		if len(operations) == 0 {
+			left = append(left, offer)
+			continue
+		}
+
+		if _, err := e.scheduler.Accept([]*mesos_v1.OfferID{offer.GetId()}, operations, nil); err != nil {
+			e.logger.Emit(logging.ERROR, "Failed to destroy volumes on agent %s: %s", offer.GetAgentId().GetValue(), err.Error())
+			left = append(left, offer)
+			continue
+		}
+		for _, task := range tasks {
+			e.logger.Emit(logging.INFO, "Destroyed the volume of task %s", task)
+			if err := e.reservations.Remove(task); err != nil {
+				e.logger.Emit(logging.ERROR, "Failed to forget the reservation for task %s: %s", task, err.Error())
+			}
+		}
+	}
+
+	return left
+}
+
+// Forgets where tasks were launched once they've moved on or are gone, whether or not Mesos told us about it.
+func (e *Handler) forgetLaunches() {
+	for id := range e.launching {
+		task, err := e.taskManager.GetById(&mesos_v1.TaskID{Value: utils.ProtoString(id)})
+		if err != nil || task.State != manager.STAGING {
+			delete(e.launching, id)
+		}
+	}
+}
+
+// Remembers when each queued task started waiting, forgetting tasks that are no longer queued.
+func (e *Handler) wait(queued []*manager.Task) {
+	now := time.Now()
+	waiting := make(map[string]time.Time, len(queued))
+	for _, task := range queued {
+		since, ok := e.waiting[task.Info.GetName()]
+		if !ok {
+			since = now
+		}
+		waiting[task.Info.GetName()] = since
+	}
+	e.waiting = waiting
+}
+
+// Declines offers from agents going down for maintenance, so nothing new is placed on them, and returns the rest.
+func (e *Handler) avoidMaintenance(offers []*mesos_v1.Offer) []*mesos_v1.Offer {
+	now := time.Now()
+	available := make([]*mesos_v1.Offer, 0, len(offers))
+	draining := []*mesos_v1.Offer{}
+	for _, offer := range offers {
+		if maintenance.Affects(offer.GetUnavailability(), now) || e.maintenance.Draining(offer.GetAgentId().GetValue()) {
+			draining = append(draining, offer)
+			continue
+		}
+		available = append(available, offer)
+	}
+
+	e.declineOffers(draining, refuseSeconds)
+
+	return available
+}
+
+// Records what's still waiting to be launched once we're done with a batch of offers, so it can be reported.
+func (e *Handler) publishQueue(queued []*manager.Task) {
+	waiting := make([]*manager.Task, 0, len(queued))
+	for _, task := range queued {
+		if task.State == manager.UNKNOWN && !task.IsKill {
+			waiting = append(waiting, task)
+		}
+	}
+	e.status.SetQueue(queue.Summarize(waiting, e.waiting))
+}
+
+// Kills tasks of a lower priority to make room for queued tasks that have waited longer than the preemption delay.
+// Victims are marked as preempted and persisted before they're killed, so that they're queued again once they're gone.
+func (e *Handler) preempt(queued []*manager.Task) {
+	delay := e.config.Scheduler.PreemptionDelay
+	if delay <= 0 {
+		return
+	}
+
+	var running []*manager.Task
+	for _, task := range queued {
+		if task.State != manager.UNKNOWN || time.Since(e.waiting[task.Info.GetName()]) < delay {
+			continue
+		}
+
+		if running == nil {
+			all, err := e.taskManager.All()
+			if err != nil {
+				return
+			}
+			for _, t := range all {
+				if t.State == manager.STAGING || t.State == manager.STARTING || t.State == manager.RUNNING {
+					running = append(running, t)
 				}
 			}
+		}
+
+		victims := priority.Victims(task, running, e.suitable(task))
+		if len(victims) == 0 {
+			continue
+		}
 
+		for _, victim := range victims {
+			priority.MarkPreempted(victim)
 		}
-	default:
+		e.taskManager.Update(victims...)
+		if err := e.taskManager.Flush(); err != nil {
+			e.logger.Emit(logging.ERROR, "Not preempting tasks that couldn't be persisted: %s", err.Error())
+			for _, victim := range victims {
+				priority.ClearPreempted(victim)
+			}
+			e.taskManager.Update(victims...)
+			return
+		}
+
+		for _, victim := range victims {
+			e.logger.Emit(
+				logging.INFO,
+				"Preempting task %s on agent %s for task %s",
+				victim.Info.GetName(),
+				victim.Info.GetAgentId().GetValue(),
+				task.Info.GetName(),
+			)
+			if _, err := e.scheduler.Kill(victim.Info.GetTaskId(), victim.Info.GetAgentId()); err != nil {
+				e.logger.Emit(logging.ERROR, "Failed to kill task %s: %s", victim.Info.GetName(), err.Error())
+			}
+		}
+
+		// The task gets a chance at what's been freed before anything else is killed for it.
+		e.waiting[task.Info.GetName()] = time.Now()
+	}
+}
+
+// Tells us if the task could be placed on the agent once there's room, as far as its placement goes.
+func (e *Handler) suitable(task *manager.Task) func(string) bool {
+	intent := placement.Of(task)
+	placed := e.placed(task, nil)
+
+	pinned := ""
+	if reservation, err := e.reservations.Get(task.Info.GetName()); err == nil && reservation != nil {
+		pinned = reservation.AgentID
+	}
+
+	return func(id string) bool {
+		if pinned != "" && id != pinned {
+			return false
+		}
+		if e.maintenance.Draining(id) {
+			return false
+		}
+
+		agent, ok := e.agents.Get(id)
+		if !ok {
+			agent = &placement.Agent{ID: id}
+		}
+
+		return applyStrategy(task, intent, agent, placed, nil) && placement.Satisfied(intent.Constraints, agent, placed)
 	}
-	return true
 }
@@ -15,27 +15,41 @@
 package events
 
 import (
+	"errors"
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
+	taskManager "hydrogen/task/manager"
 	mockTaskManager "hydrogen/task/manager/test"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	"hydrogen/task/ports"
+	"hydrogen/task/placement"
+	"hydrogen/task/priority"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/task"
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestHandler_Offers(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
-		new(scheduler.Configuration),
+		mockTaskManager.MockResourceManager{},
+		&scheduler.Configuration{Scheduler: new(scheduler.SchedulerConfiguration)},
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 
@@ -72,11 +86,13 @@ func TestHandler_Offers(t *testing.T) {
 func TestHandler_OffersWithQueuedTasks(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
-		new(scheduler.Configuration),
+		mockTaskManager.MockResourceManager{},
+		&scheduler.Configuration{Scheduler: new(scheduler.SchedulerConfiguration)},
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 
@@ -109,3 +125,602 @@ func TestHandler_OffersWithQueuedTasks(t *testing.T) {
 		Offers: offers,
 	})
 }
+
+// Offer of enough resources for a few tasks from the given agent.
+func agentOffer(id, agent string) *mesos_v1.Offer {
+	return &mesos_v1.Offer{
+		Id:       &mesos_v1.OfferID{Value: utils.ProtoString(id)},
+		AgentId:  &mesos_v1.AgentID{Value: utils.ProtoString(agent)},
+		Hostname: utils.ProtoString(agent),
+		Resources: []*mesos_v1.Resource{{
+			Name:   utils.ProtoString("cpu"),
+			Type:   mesos_v1.Value_SCALAR.Enum(),
+			Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(4.0)},
+		}},
+	}
+}
+
+// Instances of a UNIQUE group never share an agent, including instances placed earlier in the same batch of offers.
+func TestHandler_OffersUnique(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances int
+		running   map[int]string // Instances already running, by index, on the given agents.
+		previous  map[int]string // Queued instances that ran on the given agents before.
+		offers    []*mesos_v1.Offer
+		launched  int
+	}{
+		{
+			name:      "one offer",
+			instances: 3,
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a")},
+			launched:  1,
+		},
+		{
+			name:      "several offers from one agent",
+			instances: 3,
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "a")},
+			launched:  1,
+		},
+		{
+			name:      "an offer per agent",
+			instances: 3,
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "b"), agentOffer("3", "c")},
+			launched:  3,
+		},
+		{
+			name:      "fewer agents than instances",
+			instances: 3,
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "b"), agentOffer("3", "b")},
+			launched:  2,
+		},
+		{
+			name:      "agent already running an instance",
+			instances: 3,
+			running:   map[int]string{0: "a"},
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "b")},
+			launched:  1,
+		},
+		{
+			name:      "agents that instances used to run on",
+			instances: 2,
+			previous:  map[int]string{0: "a", 1: "a"},
+			offers:    []*mesos_v1.Offer{agentOffer("1", "a")},
+			launched:  1,
+		},
+	}
+
+	for _, test := range tests {
+		storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+		tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+		err := tm.Add(&manager.Task{
+			Info: &mesos_v1.TaskInfo{
+				Name:   utils.ProtoString("app"),
+				TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("app")},
+				Resources: []*mesos_v1.Resource{{
+					Name:   utils.ProtoString("cpu"),
+					Type:   mesos_v1.Value_SCALAR.Enum(),
+					Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+				}},
+			},
+			Instances: test.instances,
+			Strategy:  task.Strategy{Type: "unique"},
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		for i := 0; i < test.instances; i++ {
+			name := "app-" + strconv.Itoa(i+1)
+			instance, _ := tm.Get(&name)
+			if agent, ok := test.running[i]; ok {
+				instance.State = manager.RUNNING
+				instance.Info.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString(agent)}
+			}
+			if agent, ok := test.previous[i]; ok {
+				instance.Info.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString(agent)}
+			}
+		}
+
+		e := NewHandler(
+			tm,
+			taskManager.NewResourceManager(nil),
+			&scheduler.Configuration{
+				Executor:  new(scheduler.ExecutorConfiguration),
+				Scheduler: new(scheduler.SchedulerConfiguration),
+			},
+			sched.MockScheduler{},
+			storage,
+			volumes.NewReservations(storage),
+			make(chan *manager.Task, test.instances),
+			status.New(),
+			&mockLogger.MockLogger{},
+		)
+		e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: test.offers})
+
+		staging, _ := tm.AllByState(manager.STAGING)
+		agents := make(map[string]bool)
+		for _, s := range staging {
+			agents[s.Info.GetAgentId().GetValue()] = true
+		}
+		for _, r := range test.running {
+			if agents[r] {
+				t.Errorf("%s: launched onto agent %s that's already running an instance", test.name, r)
+			}
+			agents[r] = true
+		}
+
+		if len(staging) != test.launched {
+			t.Errorf("%s: expected %d instances to be launched, got %d", test.name, test.launched, len(staging))
+		}
+		if len(agents) != len(staging)+len(test.running) {
+			t.Errorf("%s: expected every instance on its own agent, got %d agents", test.name, len(agents))
+		}
+	}
+}
+
+// Records the operations of every offer it accepts, every offer it declines, and every task it kills.
+type recordingScheduler struct {
+	sched.MockScheduler
+	operations *[]*mesos_v1.Offer_Operation
+	declined   *[]string
+	killed     *[]string
+	revived    *int
+}
+
+func newRecordingScheduler() recordingScheduler {
+	return recordingScheduler{
+		operations: new([]*mesos_v1.Offer_Operation),
+		declined:   new([]string),
+		killed:     new([]string),
+		revived:    new(int),
+	}
+}
+
+func (r recordingScheduler) Decline(ids []*mesos_v1.OfferID, f *mesos_v1.Filters) (*http.Response, error) {
+	for _, id := range ids {
+		*r.declined = append(*r.declined, id.GetValue())
+	}
+	return nil, nil
+}
+
+func (r recordingScheduler) Accept(ids []*mesos_v1.OfferID, ops []*mesos_v1.Offer_Operation, f *mesos_v1.Filters) (*http.Response, error) {
+	*r.operations = append(*r.operations, ops...)
+	return nil, nil
+}
+
+func (r recordingScheduler) Kill(id *mesos_v1.TaskID, agent *mesos_v1.AgentID) (*http.Response, error) {
+	*r.killed = append(*r.killed, id.GetValue())
+	return nil, nil
+}
+
+func (r recordingScheduler) Revive() (*http.Response, error) {
+	*r.revived++
+	return nil, nil
+}
+
+func (r recordingScheduler) types() []mesos_v1.Offer_Operation_Type {
+	types := []mesos_v1.Offer_Operation_Type{}
+	for _, op := range *r.operations {
+		if op != nil {
+			types = append(types, op.GetType())
+		}
+	}
+	*r.operations = nil
+
+	return types
+}
+
+// A task with a persistent volume reserves it on its first launch, is relaunched where it is, and it's only destroyed
+// once the task's been deleted.
+func TestHandler_OffersVolume(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	volume := volumes.Volume{Size: 1024, ContainerPath: "data", Mode: volumes.RW}
+	err := tm.Add(&manager.Task{
+		Info: &mesos_v1.TaskInfo{
+			Name:   utils.ProtoString("db"),
+			TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("db")},
+			Resources: []*mesos_v1.Resource{{
+				Name:   utils.ProtoString("cpu"),
+				Type:   mesos_v1.Value_SCALAR.Enum(),
+				Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+			}},
+		},
+		Instances: 1,
+		Filters:   []task.Filter{placement.Placement{Volume: &volume}.Filter()},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := newRecordingScheduler()
+	reservations := volumes.NewReservations(storage)
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: &scheduler.SchedulerConfiguration{Role: "db", Principal: "hydrogen"},
+		},
+		s,
+		storage,
+		reservations,
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	).(*Handler)
+
+	withDisk := func(offer *mesos_v1.Offer, res ...*mesos_v1.Resource) *mesos_v1.Offer {
+		offer.Resources = append(offer.Resources, &mesos_v1.Resource{
+			Name:   utils.ProtoString("disk"),
+			Type:   mesos_v1.Value_SCALAR.Enum(),
+			Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(4096.0)},
+		})
+		offer.Resources = append(offer.Resources, res...)
+		return offer
+	}
+
+	// The first launch reserves and creates the volume, after persisting where it is.
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{withDisk(agentOffer("1", "a"))}})
+	types := s.types()
+	if len(types) != 2 || types[0] != mesos_v1.Offer_Operation_RESERVE || types[1] != mesos_v1.Offer_Operation_CREATE {
+		t.Fatalf("Expected the volume to be reserved and created, got %v", types)
+	}
+	reservation, err := volumes.NewReservations(storage).Get("db")
+	if err != nil || reservation == nil || reservation.AgentID != "a" {
+		t.Fatalf("Expected the reservation on agent a to be persisted, got %+v: %v", reservation, err)
+	}
+	launched, _ := tm.Get(utils.ProtoString("db"))
+	if launched.State != manager.STAGING || len(launched.Info.Resources) != 2 {
+		t.Fatalf("Expected the task to be launched with its reserved cpu and volume, got %v", launched.Info.Resources)
+	}
+
+	// Once it's failed, it's only relaunched on the agent holding its volume, which is left as it is.
+	launched.State = manager.UNKNOWN
+	tm.Update(launched)
+	held := withDisk(agentOffer("3", "a"), reservation.Launched()...)
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{withDisk(agentOffer("2", "b")), held}})
+	if types := s.types(); len(types) != 0 {
+		t.Fatalf("Expected nothing to be reserved again, got %v", types)
+	}
+	if launched, _ := tm.Get(utils.ProtoString("db")); launched.State != manager.STAGING || launched.Info.GetAgentId().GetValue() != "a" {
+		t.Fatalf("Expected the task to be relaunched on agent a, got %v", launched.Info.GetAgentId())
+	}
+
+	// Deleting the task destroys the volume and unreserves everything the next time we're offered it.
+	tm.Delete(launched)
+	if err := reservations.Release("db"); err != nil {
+		t.Fatal(err.Error())
+	}
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{held}})
+	types = s.types()
+	if len(types) != 2 || types[0] != mesos_v1.Offer_Operation_DESTROY || types[1] != mesos_v1.Offer_Operation_UNRESERVE {
+		t.Fatalf("Expected the volume to be destroyed and unreserved, got %v", types)
+	}
+	if reservation, _ := volumes.NewReservations(storage).Get("db"); reservation != nil {
+		t.Fatal("Expected the reservation to be forgotten")
+	}
+}
+
+// Offers holding nothing but a task's volume still relaunch it, even when every other queued task is left waiting.
+func TestHandler_OffersVolumeOnlyReserved(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	volume := volumes.Volume{Size: 1024, ContainerPath: "data", Mode: volumes.RW}
+	cpu := []*mesos_v1.Resource{{
+		Name:   utils.ProtoString("cpu"),
+		Type:   mesos_v1.Value_SCALAR.Enum(),
+		Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+	}}
+	for name, filters := range map[string][]task.Filter{"web": nil, "db": {placement.Placement{Volume: &volume}.Filter()}} {
+		err := tm.Add(&manager.Task{
+			Info: &mesos_v1.TaskInfo{
+				Name:      utils.ProtoString(name),
+				TaskId:    &mesos_v1.TaskID{Value: utils.ProtoString(name)},
+				Resources: cpu,
+			},
+			Instances: 1,
+			Filters:   filters,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	reservations := volumes.NewReservations(storage)
+	reservation := volumes.New("db", "db", "hydrogen", cpu, volume)
+	reservation.AgentID = "a"
+	if err := reservations.Add(reservation); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := newRecordingScheduler()
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: &scheduler.SchedulerConfiguration{Role: "db", Principal: "hydrogen"},
+		},
+		s,
+		storage,
+		reservations,
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	).(*Handler)
+
+	held := agentOffer("1", "a")
+	held.Resources = reservation.Launched()
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{held}})
+
+	if db, _ := tm.Get(utils.ProtoString("db")); db.State != manager.STAGING || db.Info.GetAgentId().GetValue() != "a" {
+		t.Fatalf("Expected the task to be relaunched on its volume, got %v", db.State)
+	}
+	if web, _ := tm.Get(utils.ProtoString("web")); web.State != manager.UNKNOWN {
+		t.Fatalf("Nothing unreserved was offered for the other task, got %v", web.State)
+	}
+}
+
+// Fails to accept any offer.
+type refusingScheduler struct {
+	recordingScheduler
+}
+
+func (r refusingScheduler) Accept(ids []*mesos_v1.OfferID, ops []*mesos_v1.Offer_Operation, f *mesos_v1.Filters) (*http.Response, error) {
+	return nil, errors.New("Refused")
+}
+
+// Offers we can't use because reserving or releasing a volume failed are declined, rather than held until they time out.
+func TestHandler_OffersVolumeFailed(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	volume := volumes.Volume{Size: 1024, ContainerPath: "data", Mode: volumes.RW}
+	err := tm.Add(&manager.Task{
+		Info: &mesos_v1.TaskInfo{
+			Name:   utils.ProtoString("db"),
+			TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("db")},
+			Resources: []*mesos_v1.Resource{{
+				Name:   utils.ProtoString("cpu"),
+				Type:   mesos_v1.Value_SCALAR.Enum(),
+				Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+			}},
+		},
+		Instances: 1,
+		Filters:   []task.Filter{placement.Placement{Volume: &volume}.Filter()},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Reservations can be read but not written.
+	fenced := memory.New()
+	fenced.Fence("/leader", 1)
+	config := &scheduler.Configuration{
+		Executor:  new(scheduler.ExecutorConfiguration),
+		Scheduler: &scheduler.SchedulerConfiguration{Role: "db", Principal: "hydrogen"},
+	}
+	s := newRecordingScheduler()
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		config,
+		s,
+		storage,
+		volumes.NewReservations(persistence.NewPersistence(fenced, 0, 0, 0)),
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	)
+	offer := agentOffer("1", "a")
+	offer.Resources = append(offer.Resources, &mesos_v1.Resource{
+		Name:   utils.ProtoString("disk"),
+		Type:   mesos_v1.Value_SCALAR.Enum(),
+		Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(4096.0)},
+	})
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{offer}})
+	if len(*s.declined) != 1 || (*s.declined)[0] != "1" || len(*s.operations) != 0 {
+		t.Fatalf("Expected the offer to be declined once the reservation failed, got %v", *s.declined)
+	}
+
+	// An offer whose volume we fail to destroy is declined too.
+	tm.Delete(&manager.Task{Info: &mesos_v1.TaskInfo{Name: utils.ProtoString("db"), TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("db")}}})
+	reservations := volumes.NewReservations(storage)
+	reservation := volumes.New("db", "db", "hydrogen", nil, volume)
+	reservation.AgentID = "a"
+	reservation.Released = true
+	if err := reservations.Add(reservation); err != nil {
+		t.Fatal(err.Error())
+	}
+	refusing := refusingScheduler{newRecordingScheduler()}
+	e = NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		config,
+		refusing,
+		storage,
+		reservations,
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	)
+	held := agentOffer("2", "a")
+	held.Resources = reservation.Launched()
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{held}})
+	if len(*refusing.declined) != 1 || (*refusing.declined)[0] != "2" {
+		t.Fatalf("Expected the offer to be declined once destroying the volume failed, got %v", *refusing.declined)
+	}
+}
+
+// A high priority task that's waited too long has lower priority tasks killed for it, which are then queued again.
+func TestHandler_OffersPreempt(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	for name, p := range map[string]int{"batch": -1, "web": 10} {
+		err := tm.Add(&manager.Task{
+			Info: &mesos_v1.TaskInfo{
+				Name:   utils.ProtoString(name),
+				TaskId: &mesos_v1.TaskID{Value: utils.ProtoString(name)},
+				Resources: []*mesos_v1.Resource{{
+					Name:   utils.ProtoString("cpu"),
+					Type:   mesos_v1.Value_SCALAR.Enum(),
+					Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(4.0)},
+				}},
+			},
+			Instances: 1,
+			Filters:   []task.Filter{placement.Placement{Priority: p}.Filter()},
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	batch, _ := tm.Get(utils.ProtoString("batch"))
+	batch.State = manager.RUNNING
+	batch.Info.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString("a")}
+
+	s := newRecordingScheduler()
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: &scheduler.SchedulerConfiguration{PreemptionDelay: time.Minute},
+		},
+		s,
+		storage,
+		volumes.NewReservations(storage),
+		make(chan *manager.Task, 1),
+		status.New(),
+		&mockLogger.MockLogger{},
+	).(*Handler)
+	small := &mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{{
+		Id:      &mesos_v1.OfferID{Value: utils.ProtoString("1")},
+		AgentId: &mesos_v1.AgentID{Value: utils.ProtoString("b")},
+		Resources: []*mesos_v1.Resource{{
+			Name:   utils.ProtoString("cpu"),
+			Type:   mesos_v1.Value_SCALAR.Enum(),
+			Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+		}},
+	}}}
+
+	e.Offers(small)
+	if len(*s.killed) != 0 {
+		t.Fatalf("Nothing should be preempted before the delay is up, killed %v", *s.killed)
+	}
+
+	e.waiting["web"] = time.Now().Add(-2 * time.Minute)
+	e.Offers(small)
+	if len(*s.killed) != 1 || (*s.killed)[0] != "batch" || !priority.Preempted(batch) {
+		t.Fatalf("Expected the batch task to be preempted, killed %v", *s.killed)
+	}
+
+	e.Offers(small)
+	if len(*s.killed) != 1 {
+		t.Fatalf("The web task should get a chance at the room it's been given first, killed %v", *s.killed)
+	}
+
+	e.Update(&mesos_v1_scheduler.Event_Update{Status: &mesos_v1.TaskStatus{
+		TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("batch")},
+		State:  mesos_v1.TaskState_TASK_KILLED.Enum(),
+	}})
+	if batch, err := tm.Get(utils.ProtoString("batch")); err != nil || batch.State != manager.UNKNOWN || priority.Preempted(batch) {
+		t.Fatal("Expected the preempted task to be queued again")
+	}
+}
+
+// Applications take turns at the offers, and no more than the maximum are launched at once.
+func TestHandler_OffersFair(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	for name, instances := range map[string]int{"big": 5, "small": 1} {
+		err := tm.Add(&manager.Task{
+			Info: &mesos_v1.TaskInfo{
+				Name:   utils.ProtoString(name),
+				TaskId: &mesos_v1.TaskID{Value: utils.ProtoString(name)},
+				Resources: []*mesos_v1.Resource{{
+					Name:   utils.ProtoString("cpu"),
+					Type:   mesos_v1.Value_SCALAR.Enum(),
+					Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(1.0)},
+				}},
+			},
+			Instances: instances,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	st := status.New()
+	e := NewHandler(
+		tm,
+		taskManager.NewResourceManager(nil),
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: &scheduler.SchedulerConfiguration{MaxLaunches: 2},
+		},
+		newRecordingScheduler(),
+		storage,
+		volumes.NewReservations(storage),
+		make(chan *manager.Task, 1),
+		st,
+		&mockLogger.MockLogger{},
+	).(*Handler)
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "b")}})
+
+	launched, err := tm.AllByState(manager.STAGING)
+	if err != nil || len(launched) != 2 {
+		t.Fatalf("Expected 2 tasks to be launched, got %d: %v", len(launched), err)
+	}
+	if small, _ := tm.Get(utils.ProtoString("small")); small.State != manager.STAGING {
+		t.Fatal("Expected the small application to get its turn alongside the big one")
+	}
+
+	queue := st.Queue()
+	if len(queue) != 1 || queue[0].Name != "big" || queue[0].Queued != 4 || queue[0].Since.IsZero() {
+		t.Fatalf("Expected the rest of the big application to be reported as queued, got %+v", queue)
+	}
+}
+
+// Ports are handed to the task without changing the task it was launched from, and replace those of earlier launches.
+func TestSetPorts(t *testing.T) {
+	requested := []ports.Port{{Name: "http", Protocol: "tcp", Container: 8080}}
+	original := &mesos_v1.TaskInfo{
+		Name: utils.ProtoString("app"),
+		Command: &mesos_v1.CommandInfo{Environment: &mesos_v1.Environment{Variables: []*mesos_v1.Environment_Variable{
+			{Name: utils.ProtoString("USER_VAR"), Value: utils.ProtoString("1")},
+		}}},
+		Container: &mesos_v1.ContainerInfo{NetworkInfos: []*mesos_v1.NetworkInfo{{Name: utils.ProtoString("cni")}}},
+	}
+
+	first := *original
+	setPorts(&first, requested, []uint32{31000})
+	second := first
+	setPorts(&second, requested, []uint32{31001})
+
+	if len(original.Command.Environment.Variables) != 1 || len(original.Container.NetworkInfos[0].PortMappings) != 0 {
+		t.Fatal("Expected the original task to be left alone")
+	}
+	if len(second.Resources) != 1 || second.Resources[0].GetRanges().GetRange()[0].GetBegin() != 31001 {
+		t.Fatalf("Expected a single ports resource for the new port, got %v", second.Resources)
+	}
+
+	env := make(map[string]string)
+	for _, v := range second.Command.GetEnvironment().GetVariables() {
+		if _, ok := env[v.GetName()]; ok {
+			t.Fatalf("Variable %s is set more than once", v.GetName())
+		}
+		env[v.GetName()] = v.GetValue()
+	}
+	if env["USER_VAR"] != "1" || env["PORT0"] != "31001" || env["PORT_HTTP"] != "31001" {
+		t.Fatalf("Unexpected environment %v", env)
+	}
+
+	mappings := second.Container.NetworkInfos[0].PortMappings
+	if len(mappings) != 1 || *mappings[0].HostPort != 31001 || *mappings[0].ContainerPort != 8080 {
+		t.Fatalf("Expected port 31001 to be mapped to 8080, got %v", mappings)
+	}
+	if second.Discovery == nil || len(second.Discovery.Ports.Ports) != 1 || *second.Discovery.Ports.Ports[0].Number != 31001 {
+		t.Fatalf("Expected the port to be announced, got %v", second.Discovery)
+	}
+}
@@ -15,14 +15,18 @@
 package events
 
 import (
+	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
+	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
 )
 
 //
 // Rescind is a public method that handles a rescind event from the mesos-master.
 // Rescind events only occur if an offer isn't declined properly within the offer
 // timeout period.
+// The offer is forgotten, and tasks launched on it that Mesos hasn't told us about yet are queued again under new IDs.
 //
 func (e *Handler) Rescind(rescindEvent *mesos_v1_scheduler.Event_Rescind) {
 	if rescindEvent != nil {
@@ -30,4 +34,43 @@ func (e *Handler) Rescind(rescindEvent *mesos_v1_scheduler.Event_Rescind) {
 	} else {
 		e.logger.Emit(logging.INFO, "Rescind event recieved was nil!")
 	}
+
+	id := rescindEvent.GetOfferId()
+	if id.GetValue() == "" {
+		return
+	}
+	e.resourceManager.RemoveOffer(id)
+
+	requeued := []*manager.Task{}
+	for taskID, offer := range e.launching {
+		if offer != id.GetValue() {
+			continue
+		}
+		delete(e.launching, taskID)
+
+		task, err := e.taskManager.GetById(&mesos_v1.TaskID{Value: utils.ProtoString(taskID)})
+		if err != nil || task.State != manager.STAGING {
+			continue
+		}
+		e.logger.Emit(logging.INFO, "Task %s was launched on rescinded offer %s, queueing it again", task.Info.GetName(), offer)
+
+		// Mesos still reports on the launch that failed, so the next attempt gets an ID of its own.
+		// Updates for the old one don't match any task, and are only acknowledged.
+		// It's a copy, so that the task manager can tell where the task was stored before.
+		info := *task.Info
+		info.TaskId = &mesos_v1.TaskID{Value: utils.ProtoString(task.Info.GetName() + "." + utils.UuidAsString())}
+		next := *task
+		next.Info = &info
+		next.State = manager.UNKNOWN
+		requeued = append(requeued, &next)
+	}
+
+	if len(requeued) == 0 {
+		return
+	}
+	if err := e.taskManager.Update(requeued...); err != nil {
+		e.logger.Emit(logging.ERROR, "Failed to queue tasks launched on rescinded offer %s again: %s", id.GetValue(), err.Error())
+		return
+	}
+	e.scheduler.Revive()
 }
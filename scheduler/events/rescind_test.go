@@ -15,25 +15,34 @@
 package events
 
 import (
+	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	mockLogger "mesos-framework-sdk/logging/test"
-	mockResourceManager "mesos-framework-sdk/resources/manager/test"
 	sched "mesos-framework-sdk/scheduler/test"
 	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
 	"hydrogen/scheduler"
+	"hydrogen/scheduler/status"
+	taskManager "hydrogen/task/manager"
 	mockTaskManager "hydrogen/task/manager/test"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
 	mockStorage "hydrogen/task/persistence/test"
+	"hydrogen/task/volumes"
+	"strings"
 	"testing"
 )
 
 func TestHandler_Rescind(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Rescind(&mesos_v1_scheduler.Event_Rescind{})
@@ -42,13 +51,121 @@ func TestHandler_Rescind(t *testing.T) {
 func TestHandler_RescindWithNil(t *testing.T) {
 	e := NewHandler(
 		mockTaskManager.MockTaskManager{},
-		mockResourceManager.MockResourceManager{},
+		mockTaskManager.MockResourceManager{},
 		new(scheduler.Configuration),
 		sched.MockScheduler{},
 		&mockStorage.MockStorage{},
+		volumes.NewReservations(&mockStorage.MockStorage{}),
 		make(chan *manager.Task),
+		status.New(),
 		&mockLogger.MockLogger{},
 	)
 	e.Rescind(&mesos_v1_scheduler.Event_Rescind{OfferId: nil})
 	e.Rescind(nil)
 }
+
+// Tasks launched on an offer that's rescinded before Mesos tells us about them are queued again, others are left be.
+func TestHandler_RescindLaunched(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	tm := taskManager.NewTaskManager(make(map[string]*manager.Task), storage, &mockLogger.MockLogger{})
+	for _, name := range []string{"web", "db"} {
+		err := tm.Add(&manager.Task{
+			Info: &mesos_v1.TaskInfo{
+				Name:   utils.ProtoString(name),
+				TaskId: &mesos_v1.TaskID{Value: utils.ProtoString(name)},
+				Resources: []*mesos_v1.Resource{{
+					Name:   utils.ProtoString("cpu"),
+					Type:   mesos_v1.Value_SCALAR.Enum(),
+					Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(4.0)},
+				}},
+			},
+			Instances: 1,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	s := newRecordingScheduler()
+	rm := taskManager.NewResourceManager(nil)
+	e := NewHandler(
+		tm,
+		rm,
+		&scheduler.Configuration{
+			Executor:  new(scheduler.ExecutorConfiguration),
+			Scheduler: new(scheduler.SchedulerConfiguration),
+		},
+		s,
+		storage,
+		volumes.NewReservations(storage),
+		make(chan *manager.Task, 2),
+		status.New(),
+		&mockLogger.MockLogger{},
+	)
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{agentOffer("1", "a"), agentOffer("2", "b")}})
+	if staging, _ := tm.AllByState(manager.STAGING); len(staging) != 2 {
+		t.Fatalf("Expected both tasks to be launched, got %d", len(staging))
+	}
+
+	// Applications of the same priority go in order of their names, so web is on offer 2.
+	// Mesos has heard of it, so that offer can't be taken back anymore.
+	launched, _ := tm.Get(utils.ProtoString("web"))
+	if launched.Info.GetAgentId().GetValue() != "b" {
+		t.Fatalf("Expected web to be launched on agent b, got %s", launched.Info.GetAgentId().GetValue())
+	}
+	e.Update(&mesos_v1_scheduler.Event_Update{Status: &mesos_v1.TaskStatus{
+		TaskId: launched.Info.GetTaskId(),
+		State:  mesos_v1.TaskState_TASK_RUNNING.Enum(),
+	}})
+
+	e.Rescind(&mesos_v1_scheduler.Event_Rescind{OfferId: &mesos_v1.OfferID{Value: utils.ProtoString("2")}})
+	if *s.revived != 0 || launched.State != manager.RUNNING {
+		t.Fatal("A task Mesos has told us about shouldn't be queued again")
+	}
+
+	e.Rescind(&mesos_v1_scheduler.Event_Rescind{OfferId: &mesos_v1.OfferID{Value: utils.ProtoString("1")}})
+	queued, err := tm.AllByState(manager.UNKNOWN)
+	if err != nil || len(queued) != 1 || queued[0].Info.GetAgentId().GetValue() != "a" {
+		t.Fatalf("Expected the task launched on the rescinded offer to be queued again, got %v", queued)
+	}
+	if *s.revived != 1 {
+		t.Fatalf("Expected offers to be revived once, got %d", *s.revived)
+	}
+
+	// The next attempt has an ID of its own, so Mesos dropping the one that failed doesn't count against it.
+	if id := queued[0].Info.GetTaskId().GetValue(); id == "db" || !strings.HasPrefix(id, "db.") {
+		t.Fatalf("Expected the task to be queued again under a new ID, got %s", id)
+	}
+	e.Update(&mesos_v1_scheduler.Event_Update{Status: &mesos_v1.TaskStatus{
+		TaskId: &mesos_v1.TaskID{Value: utils.ProtoString("db")},
+		State:  mesos_v1.TaskState_TASK_DROPPED.Enum(),
+	}})
+	if queued[0].State != manager.UNKNOWN {
+		t.Fatalf("Updates for the failed launch should be ignored, got %v", queued[0].State)
+	}
+
+	// Only the new ID is stored, so the old record can't bring the task back once it's deleted.
+	stored, _, _ := storage.ReadAllWithRevision(taskManager.TASK_DIRECTORY)
+	if _, ok := stored[taskManager.TASK_DIRECTORY+"db"]; ok || len(stored) != 2 {
+		t.Fatalf("Expected the task to be moved to its new key, got %v", stored)
+	}
+
+	// Rescinding it again does nothing, and so does rescinding an offer we're holding.
+	rm.AddOffers([]*mesos_v1.Offer{agentOffer("3", "c")})
+	e.Rescind(&mesos_v1_scheduler.Event_Rescind{OfferId: &mesos_v1.OfferID{Value: utils.ProtoString("1")}})
+	e.Rescind(&mesos_v1_scheduler.Event_Rescind{OfferId: &mesos_v1.OfferID{Value: utils.ProtoString("3")}})
+	if *s.revived != 1 || len(rm.Offers()) != 0 {
+		t.Fatal("Expected the held offer to be forgotten without reviving")
+	}
+
+	// Launches of tasks that are gone before Mesos reports on them are forgotten too.
+	e.Offers(&mesos_v1_scheduler.Event_Offers{Offers: []*mesos_v1.Offer{agentOffer("4", "a")}})
+	if len(e.(*Handler).launching) != 1 {
+		t.Fatal("Expected the task to be launched again")
+	}
+	tm.Delete(queued[0])
+	e.Offers(&mesos_v1_scheduler.Event_Offers{})
+	if len(e.(*Handler).launching) != 0 {
+		t.Fatalf("Expected the deleted task's launch to be forgotten, got %v", e.(*Handler).launching)
+	}
+}
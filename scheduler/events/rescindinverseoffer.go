@@ -22,7 +22,9 @@ import (
 //
 // Rescind Inverse Offers is a public method that handles the event
 // when an inverse offer isn't declined or accepted within the time out period set.
+// The agent is placed on again until Mesos sends another inverse offer for it.
 //
 func (e *Handler) RescindInverseOffer(rioffers *mesos_v1_scheduler.Event_RescindInverseOffer) {
 	e.logger.Emit(logging.INFO, "Rescind Inverse Offer event recieved: %v", rioffers)
+	e.maintenance.Rescind(rioffers.GetInverseOfferId().GetValue())
 }
@@ -30,6 +30,8 @@ func (h *Handler) Subscribed(subEvent *mesos_v1_scheduler.Event_Subscribed) {
 	idVal := id.GetValue()
 	h.scheduler.FrameworkInfo().Id = id
 	h.logger.Emit(logging.INFO, "Subscribed with an ID of %s", idVal)
+	h.status.SetSubscribed(true)
+	h.status.Heartbeat()
 
 	err := h.createFrameworkIdLease(idVal)
 	if err != nil {
@@ -37,6 +39,9 @@ func (h *Handler) Subscribed(subEvent *mesos_v1_scheduler.Event_Subscribed) {
 		os.Exit(3)
 	}
 
+	// Offers from before we subscribed are gone, and so is any chance of them being rescinded.
+	h.launching = make(map[string]string)
+
 	h.scheduler.Revive() // Reset to revive offers regardless if there are tasks or not.
 	// We do this to force a check for any tasks that we might have missed during downtime.
 	// Reconcile after we subscribe in case we resubscribed due to a failure.
@@ -15,6 +15,7 @@
 package events
 
 import (
+	"hydrogen/task/priority"
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
@@ -29,11 +30,16 @@ func (e *Handler) Update(updateEvent *mesos_v1_scheduler.Event_Update) {
 	taskID := status.GetTaskId()
 
 	// Always acknowledge that we've received the message from Mesos.
+	// Only once what it changed has been persisted though, otherwise Mesos sends it again.
 	defer func() {
 		if len(status.GetUuid()) == 0 {
 			// We don't ack events that don't have uuid's.
 			return
 		}
+		if err := e.taskManager.Flush(); err != nil {
+			e.logger.Emit(logging.ERROR, "Not acknowledging the update for task ID %s until it's persisted", taskID.GetValue())
+			return
+		}
 		_, err := e.scheduler.Acknowledge(agentID, taskID, status.GetUuid())
 		if err != nil {
 			e.logger.Emit(
@@ -46,6 +52,9 @@ func (e *Handler) Update(updateEvent *mesos_v1_scheduler.Event_Update) {
 		}
 	}()
 
+	// Whatever happened to the task, the offer it was launched on can't be taken back anymore.
+	delete(e.launching, taskID.GetValue())
+
 	task, err := e.taskManager.GetById(taskID)
 	if err != nil {
 		// The event is from a task that has been deleted from the task manager,
@@ -103,6 +112,16 @@ func (e *Handler) Update(updateEvent *mesos_v1_scheduler.Event_Update) {
 		// Agent might be dead, master is unsure. Will return to RUNNING state possibly or die.
 		e.logger.Emit(logging.ERROR, "Task %s gone by operator: %s", taskIdVal, message)
 	case mesos_v1.TaskState_TASK_KILLED:
+		if priority.Preempted(task) {
+			// Killed to make room for a higher priority task, so it's queued again for when there's room.
+			e.logger.Emit(logging.INFO, "Task %s on agent %s was preempted", taskIdVal, agentIdVal)
+			priority.ClearPreempted(task)
+			task.State = manager.UNKNOWN
+			e.taskManager.Update(task)
+			e.scheduler.Revive()
+			break
+		}
+
 		// Task was killed.
 		e.logger.Emit(
 			logging.INFO,
@@ -15,12 +15,12 @@
 package ha
 
 import (
-	"mesos-framework-sdk/logging"
-	"net"
-	"os"
+	"context"
 	"hydrogen/scheduler"
 	"hydrogen/task/persistence"
-	"strconv"
+	"mesos-framework-sdk/logging"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -29,181 +29,278 @@ const (
 )
 
 type HA struct {
-	logger  logging.Logger
-	config  *scheduler.LeaderConfiguration
-	storage persistence.Storage
+	logger    logging.Logger
+	config    *scheduler.LeaderConfiguration
+	storage   persistence.Storage
+	mutex     sync.RWMutex
+	term      sync.RWMutex // Held for reading by anything that has to finish before we stop leading.
+	elected   bool         // We hold the leader key, but only lead once we've taken over.
+	leading   bool
+	resigned  bool // We gave up leading on purpose, so losing the lease isn't a newer leader taking over.
+	lease     int64
+	epoch     int64
+	stepDowns chan struct{}
 }
 
 func NewHA(s persistence.Storage, l logging.Logger, c *scheduler.LeaderConfiguration) *HA {
 	return &HA{
-		logger:  l,
-		config:  c,
-		storage: s,
+		logger:    l,
+		config:    c,
+		storage:   s,
+		stepDowns: make(chan struct{}, 1),
 	}
 }
 
-// Communicate is a public method that defines how we communicate in our HA implementation.
-// Here we set up a listening mechanism on a TCP channel for other nodes to talk to us.
-func (h *HA) Communicate() {
-	// NOTE (tim): Using a generic Listener might be better so we don't have to assume TCP
-	// for all implementations in future.
-	addr, err := net.ResolveTCPAddr(h.config.AddressFamily, "["+h.config.IP+"]:"+
-		strconv.Itoa(h.config.ServerPort))
-	if err != nil {
-		h.logger.Emit(logging.ERROR, "Leader server exiting: %s", err.Error())
-		return
-	}
+// Election defines how we elect our leader in our HA mode.
+// All running schedulers campaign by trying to create the leader key under a lease, only one of them can succeed.
+// The winner keeps its lease alive for as long as it leads, so the key disappears on its own if the leader dies.
+// Everyone else watches the key and campaigns again once it's gone.
+// Winning doesn't make us lead yet, we StartLeading once we've taken over from the previous leader.
+func (h *HA) Election() {
+	for {
+		lease, epoch, err := h.campaign()
+		if err != nil {
+			h.logger.Emit(logging.ERROR, "Failed to persist leader information: %s", err.Error())
+			os.Exit(3)
+		}
 
-	// We start listening for connections.
-	tcp, err := net.ListenTCP(h.config.AddressFamily, addr)
-	if err != nil {
-		h.logger.Emit(logging.ERROR, "Leader server exiting: %s", err.Error())
-		return
-	}
+		if lease != 0 {
+			h.logger.Emit(logging.INFO, "We're leading with epoch %d", epoch)
 
-	for {
+			// Nothing we write can land once a newer leader has been elected.
+			// The fence is up before we lead, so that no write is ever made without it.
+			h.storage.Fence(leaderKey, epoch)
+			h.storage.OnFenced(h.stepDown)
 
-		// Block here until we get a new connection.
-		conn, err := tcp.AcceptTCP()
-		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to accept client: %s", err.Error())
-			time.Sleep(h.config.ServerRetry)
-			continue
+			h.mutex.Lock()
+			h.lease = lease
+			h.epoch = epoch
+			h.elected = true
+			h.resigned = false
+			h.mutex.Unlock()
+
+			go h.keepalive(lease)
+			break // We are the leader, exit the loop and start the scheduler/API.
 		}
 
-		remote := conn.RemoteAddr().String()
-		host, _, err := net.SplitHostPort(remote)
+		// Block here until the current leader goes away.
+		h.follow()
+	}
+}
+
+// Tries to become the leader by creating the leader key, if nobody else has.
+// Returns our lease and the epoch of our term, a lease of 0 means someone else is leading.
+// The epoch is the revision the leader key was created at, so every term has a higher one than the last.
+func (h *HA) campaign() (int64, int64, error) {
+	var lease, epoch int64
+	policy := h.storage.CheckPolicy(nil)
+	err := h.storage.RunPolicy(policy, func() error {
+		l, e, err := h.storage.CreateIfAbsent(leaderKey, h.config.IP, h.leaseTTL())
 		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to parse IP and port of incoming standby connection")
-			return
+			h.logger.Emit(logging.ERROR, "Failed to campaign for leadership: %s", err.Error())
+			return err
 		}
 
-		h.logger.Emit(logging.INFO, "Standby "+host+" connected")
-		go func(conn *net.TCPConn) {
-			buff := make([]byte, 1)
-			_, err := conn.Read(buff)
+		lease, epoch = l, e
+		return nil
+	})
 
-			// This cast requires Go 1.6+
-			if err, ok := err.(net.Error); ok && err.Timeout() {
-				h.logger.Emit(logging.ERROR, "Connection from "+host+" timed out")
-			} else {
-				h.logger.Emit(logging.ERROR, "Lost connection to standby "+host)
-			}
-		}(conn)
+	return lease, epoch, err
+}
+
+// Watches the leader key until the leader is gone.
+// Returns early if the watch fails so that we can campaign again and find out where we stand.
+func (h *HA) follow() {
+	leader, revision, err := h.readLeader()
+	if err != nil || leader == "" {
+		// The leader went away since we campaigned, or we can't tell. Either way, don't campaign again right away.
+		time.Sleep(h.config.RetryInterval)
+		return
+	}
 
-		// TODO build out some config to use for setting the keep alive period here
-		if err := conn.SetKeepAlive(true); err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to set keep alive: %s", err.Error())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Watch from the revision we read at, so that we can't miss the leader going away in between.
+	events := h.storage.Watch(ctx, leaderKey, false, revision)
+
+	h.logger.Emit(logging.INFO, "Following leader %s", leader)
+	for event := range events {
+		if event.Type == persistence.Delete {
+			h.logger.Emit(logging.INFO, "Leader %s is gone, starting a new election", leader)
+			return
 		}
 	}
 
+	h.logger.Emit(logging.ERROR, "Lost our watch on the leader, retrying the election")
+	time.Sleep(h.config.RetryInterval)
 }
 
-//
-// Election defines how we elect our leader in our HA mode.
-// All running schedulers attempt to write themselves as the leader to etcd.
-// If there is another existing leader we connect to the leader as a client using TCP keepalive.
-// Should the leader ever go down, we start the election again and wait for an instance to win the election.
-// This is a simple approach in which who ever gets to write to etcd first becomes the leader.
-// Note that reads and writes are atomic operations.
-//
-func (h *HA) Election() {
-	for {
-		// This will only set us as the leader if there isn't an already existing leader.
-		// If there's an already existing leader then this call is effectively a no-op.
-		err := h.CreateLeader()
-		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to persist leader information: %s", err.Error())
-			os.Exit(3)
-		}
+// Refreshes our lease for as long as we lead.
+// If it can't be refreshed before it expires, another scheduler may already be leading, so we have to go.
+func (h *HA) keepalive(lease int64) {
+	ticker := time.NewTicker(h.renewInterval())
+	defer ticker.Stop()
 
-		leader, err := h.GetLeader()
-		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to get leader information: %s", err.Error())
-			os.Exit(5)
+	renewed := time.Now()
+	for range ticker.C {
+		if !h.isElected() {
+			return // We resigned and gave the lease up on purpose.
 		}
 
-		// If the leader fetched from persistent storage does not match the IP provided to this instance
-		// then we should connect to the already existing leader.
-		if leader != h.config.IP {
-			h.logger.Emit(logging.INFO, "Connecting to existing leader")
-
-			// Block here until we lose connection to the leader.
-			// Once the connection has been lost, elect a new leader.
-			err := h.leaderClient(leader)
-
-			// Only delete the key if we've lost the connection, not timed out.
-			// This cast requires Go 1.6+
-			// NOTE (tim): Casting here is dangerous and could lead to a panic
-			if err, ok := err.(net.Error); ok && err.Timeout() {
-				h.logger.Emit(logging.ERROR, "Timed out connecting to leader")
-			} else {
-				h.logger.Emit(logging.ERROR, "Lost connection to leader")
-				err := h.deleteLeader()
-				if err != nil {
-					h.logger.Emit(logging.ERROR, "Failed to delete leader information: %s", err.Error())
-					os.Exit(4)
-				}
+		if err := h.storage.RefreshLease(lease); err != nil {
+			h.logger.Emit(logging.ERROR, "Failed to refresh leader lease: %s", err.Error())
+			if time.Since(renewed) < time.Duration(h.leaseTTL())*time.Second {
+				continue
 			}
-		} else {
-			h.logger.Emit(logging.INFO, "We're leading")
-			break // We are the leader, exit the loop and start the scheduler/API.
+
+			h.logger.Emit(logging.ALARM, "Leader lease expired, we are no longer the leader")
+			h.stepDown()
 		}
+
+		renewed = time.Now()
 	}
 }
 
-//
-// Connects to the leader and determines if and when we should start the leader election process.
-//
-func (h *HA) leaderClient(leader string) error {
-	conn, err := net.DialTimeout(h.config.AddressFamily, "["+leader+"]:"+
-		strconv.Itoa(h.config.ServerPort), 2*time.Second)
-	if err != nil {
-		return err
+// TTL of the leader lease in seconds, which is the granularity leases are kept at.
+func (h *HA) leaseTTL() int64 {
+	ttl := int64(h.config.LeaseTTL.Seconds())
+	if ttl < 1 {
+		ttl = 1
 	}
 
-	h.logger.Emit(logging.INFO, "Successfully connected to leader %s", leader)
+	return ttl
+}
 
-	// NOTE (tim): This cast has the potential to panic.
-	tcp := conn.(*net.TCPConn)
-	if err := tcp.SetKeepAlive(true); err != nil {
-		return err
+// How often the lease is renewed, defaulting to a third of its TTL.
+func (h *HA) renewInterval() time.Duration {
+	if h.config.RenewInterval > 0 {
+		return h.config.RenewInterval
 	}
 
-	// Currently the leader server does not send us anything as we rely on TCP keepalive.
-	// Allocate the smallest buffer we can and block on reading data.
-	buffer := make([]byte, 1)
-	_, err = tcp.Read(buffer)
+	return time.Duration(h.leaseTTL()) * time.Second / 3
+}
 
-	return err
+// Stops leading as soon as we find out that we're no longer the leader.
+// We exit so that we come back as a standby with a clean slate.
+// Revoking our lease when we resign fences us off too, whoever resigned exits on their own terms then.
+func (h *HA) stepDown() {
+	h.mutex.Lock()
+	h.elected = false
+	h.leading = false
+	resigned := h.resigned
+	h.mutex.Unlock()
+
+	if resigned {
+		return
+	}
+
+	h.logger.Emit(logging.ALARM, "A newer leader has taken over, stepping down")
+	os.Exit(1)
 }
 
-// Deletes the current leader information.
-func (h *HA) deleteLeader() error {
-	policy := h.storage.CheckPolicy(nil)
-	return h.storage.RunPolicy(policy, func() error {
-		err := h.storage.Delete(leaderKey)
-		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to delete leader: %s", err.Error())
-		}
+// Lead runs the function only if we're leading, and keeps us from resigning until it returns.
+// Reports whether the function was run.
+func (h *HA) Lead(f func()) bool {
+	h.term.RLock()
+	defer h.term.RUnlock()
 
-		return err
-	})
+	if !h.IsLeader() {
+		return false
+	}
+
+	f()
+
+	return true
+}
+
+// StartLeading lets functions run under Lead, once we've been elected and have taken over.
+// Returns false if we're no longer elected.
+func (h *HA) StartLeading() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.leading = h.elected
+	return h.leading
+}
+
+// Tells us if we hold the leader key, whether or not we've started leading.
+func (h *HA) isElected() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.elected
 }
 
-// Atomically create leader information.
-func (h *HA) CreateLeader() error {
+// StopLeading waits for everything running under Lead to return, and keeps anything else from running under it.
+// We still hold the leader key, so that whatever they changed can be written before we Resign.
+func (h *HA) StopLeading() {
+	h.term.Lock()
+	defer h.term.Unlock()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.elected = false
+	h.leading = false
+	h.resigned = true
+}
+
+// Resign hands leadership over to a standby without waiting for our lease to expire.
+// We stop leading if we haven't already, then release the leader key.
+func (h *HA) Resign() error {
+	h.StopLeading()
+
+	h.mutex.RLock()
+	lease := h.lease
+	h.mutex.RUnlock()
+
 	policy := h.storage.CheckPolicy(nil)
 	return h.storage.RunPolicy(policy, func() error {
-		err := h.storage.Create(leaderKey, h.config.IP)
+		err := h.storage.RevokeLease(lease)
 		if err != nil {
-			h.logger.Emit(logging.ERROR, "Failed to set leader: %s", err.Error())
+			h.logger.Emit(logging.ERROR, "Failed to release the leader key: %s", err.Error())
 		}
 
 		return err
 	})
 }
 
+// RequestStepDown asks whoever is listening on StepDownRequests to resign on our behalf.
+// Requests made while another one is pending are dropped.
+func (h *HA) RequestStepDown() {
+	select {
+	case h.stepDowns <- struct{}{}:
+	default:
+	}
+}
+
+// StepDownRequests receives every request to step down.
+func (h *HA) StepDownRequests() <-chan struct{} {
+	return h.stepDowns
+}
+
+// Epoch of the term we've been elected to, 0 if we haven't been or have given it up.
+// A newer leader always has a higher epoch.
+func (h *HA) Epoch() int64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if !h.elected {
+		return 0
+	}
+
+	return h.epoch
+}
+
+// IsLeader tells us if this instance has won the election and taken over.
+// Standbys, and leaders that are still in the middle of the election or of taking over, are not leading.
+func (h *HA) IsLeader() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.leading
+}
+
 // Atomically get leader information.
 func (h *HA) GetLeader() (string, error) {
 	var leader string
@@ -225,3 +322,26 @@ func (h *HA) GetLeader() (string, error) {
 
 	return leader, nil
 }
+
+// Reads the leader along with the revision of the store it was read at, so that we can watch for changes since.
+func (h *HA) readLeader() (string, int64, error) {
+	var leader string
+	var revision int64
+	policy := h.storage.CheckPolicy(nil)
+	err := h.storage.RunPolicy(policy, func() error {
+		values, r, err := h.storage.ReadAllWithRevision(leaderKey)
+		if err != nil {
+			h.logger.Emit(logging.ERROR, "Failed to get the leader: %s", err.Error())
+			return err
+		}
+
+		leader, revision = values[leaderKey], r
+		return nil
+	})
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return leader, revision, nil
+}
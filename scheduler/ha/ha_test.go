@@ -17,52 +17,211 @@ package ha
 import (
 	mockLogger "mesos-framework-sdk/logging/test"
 	"hydrogen/scheduler"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
 	mockStorage "hydrogen/task/persistence/test"
 	"testing"
+	"time"
 )
 
-// Possible to test communication with a variadic input for a channel.
-// If a channel is passed in, it communicates on that channel.
-// Can block on the "read" of that channel.
-func TestHA_Communicate(t *testing.T) {
+func TestHA_Election(t *testing.T) {
 	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
 		IP: "1", // Make sure we break out of our HA loop by matching on what mock storage gives us.
 	})
-	go ha.Communicate()
+	if ha.IsLeader() {
+		t.Fatal("We shouldn't be leading before the election")
+	}
+
 	ha.Election()
+	if ha.IsLeader() {
+		t.Fatal("We shouldn't be leading until we've taken over")
+	}
+	if ha.Epoch() != 1 {
+		t.Fatalf("Expected the epoch mock storage gives us, got %d", ha.Epoch())
+	}
+	if !ha.StartLeading() || !ha.IsLeader() {
+		t.Fatal("We should be leading once we start to")
+	}
 }
 
-func TestHA_Election(t *testing.T) {
-	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
-		IP: "1", // Make sure we break out of our HA loop by matching on what mock storage gives us.
-	})
+// Storage that records whether we were already leading when the fence went up.
+type fenceStorage struct {
+	mockStorage.MockStorage
+	ha      **HA
+	leading *bool
+}
+
+func (f fenceStorage) Fence(key string, revision int64) {
+	*f.leading = (*f.ha).IsLeader()
+}
+
+// Nothing can be written under Lead before the fence is up.
+func TestHA_ElectionFencesFirst(t *testing.T) {
+	var ha *HA
+	leading := true
+	ha = NewHA(fenceStorage{ha: &ha, leading: &leading}, new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{IP: "1"})
 	ha.Election()
+	ha.StartLeading()
+
+	if leading || !ha.IsLeader() {
+		t.Fatal("Expected the fence to be up before we lead")
+	}
 }
 
-// Can we create a leader?
-func TestHA_CreateLeader(t *testing.T) {
+// Can we campaign for leadership?
+func TestHA_Campaign(t *testing.T) {
 	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
-		IP: "1", // Make sure we break out of our HA loop by matching on what mock storage gives us.
+		IP: "1",
 	})
-	if err := ha.CreateLeader(); err != nil {
-		t.Logf("Failed to create a leader %v", err.Error())
+	if lease, _, err := ha.campaign(); err != nil || lease == 0 {
+		t.Logf("Failed to win the campaign: %v", err)
 		t.Fail()
 	}
+
+	ha = NewHA(new(mockStorage.MockBrokenStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
+		IP: "1",
+	})
+	if _, _, err := ha.campaign(); err == nil {
+		t.Log("Campaigning with broken storage should fail")
+		t.Fail()
+	}
+}
+
+// Following a leader should return once the watch ends.
+func TestHA_Follow(t *testing.T) {
+	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
+		IP: "2",
+	})
+	ha.follow()
+}
+
+// Storage where the leader goes away right after it's been read.
+type vanishingLeader struct {
+	persistence.Storage
+}
+
+func (v vanishingLeader) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	values, revision, err := v.Storage.ReadAllWithRevision(key)
+	v.Storage.Delete(leaderKey)
+	return values, revision, err
+}
+
+// The leader going away between reading it and watching it isn't missed.
+func TestHA_FollowFromRead(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	if _, _, err := storage.CreateIfAbsent(leaderKey, "1", 10); err != nil {
+		t.Fatal(err)
+	}
+	ha := NewHA(vanishingLeader{storage}, new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{IP: "2"})
+
+	followed := make(chan struct{})
+	go func() {
+		ha.follow()
+		close(followed)
+	}()
+
+	select {
+	case <-followed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected to stop following once the leader is gone")
+	}
 }
 
-// Can we create and get the leader?
+// Nobody leading makes us back off before campaigning again.
+func TestHA_FollowNoLeader(t *testing.T) {
+	ha := NewHA(persistence.NewPersistence(memory.New(), 0, 0, 0), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
+		IP:            "2",
+		RetryInterval: 50 * time.Millisecond,
+	})
+
+	start := time.Now()
+	ha.follow()
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("Expected to back off when there's no leader to follow")
+	}
+}
+
+// Can we get the leader?
 func TestHA_GetLeader(t *testing.T) {
 	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
 		IP: "1", // Make sure we break out of our HA loop by matching on what mock storage gives us.
 	})
-	if err := ha.CreateLeader(); err != nil {
-		t.Logf("Failed to create a leader %v\n", err.Error())
+	leader, err := ha.GetLeader()
+	if err != nil || leader != "1" {
+		t.Logf("Failed to grab the leader %v\n", err)
 		t.Fail()
 	}
-	// Leader string is simply an empty string during testing...
-	_, err := ha.GetLeader()
-	if err != nil {
-		t.Logf("Failed to grab the leader %v\n", err.Error())
+}
+
+// Leases are renewed a few times before they expire.
+func TestHA_RenewInterval(t *testing.T) {
+	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
+		LeaseTTL: 9 * time.Second,
+	})
+	if ha.renewInterval() != 3*time.Second {
+		t.Logf("Expected a third of the lease TTL, got %v", ha.renewInterval())
 		t.Fail()
 	}
 }
+
+// Resigning stops us from leading, and nothing runs under Lead afterwards.
+func TestHA_Resign(t *testing.T) {
+	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{
+		IP: "1",
+	})
+	ha.Election()
+	ran := false
+	if ha.Lead(func() { ran = true }) || ran {
+		t.Fatal("Functions shouldn't run under Lead until we've taken over")
+	}
+	ha.StartLeading()
+
+	if !ha.Lead(func() { ran = true }) || !ran {
+		t.Fatal("The leader should run functions under Lead")
+	}
+
+	// API changes are stopped before we resign, so that they can be written while we still hold the leader key.
+	ha.StopLeading()
+	if ha.IsLeader() || ha.Lead(func() { ran = false }) || !ran {
+		t.Fatal("Functions shouldn't run under Lead once we've stopped leading")
+	}
+
+	if err := ha.Resign(); err != nil {
+		t.Fatalf("Failed to resign: %s", err.Error())
+	}
+	if ha.IsLeader() || ha.Epoch() != 0 {
+		t.Fatal("We shouldn't be leading after resigning")
+	}
+
+	ran = false
+	if ha.Lead(func() { ran = true }) || ran {
+		t.Fatal("Functions shouldn't run under Lead once we've resigned")
+	}
+
+	// Being fenced off by our own revoked lease doesn't make us exit as if a newer leader took over.
+	ha.stepDown()
+
+	ha = NewHA(new(mockStorage.MockBrokenStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{})
+	if err := ha.Resign(); err == nil {
+		t.Fatal("Resigning with broken storage should fail")
+	}
+}
+
+// Step down requests are delivered, and pending ones aren't stacked up.
+func TestHA_RequestStepDown(t *testing.T) {
+	ha := NewHA(new(mockStorage.MockStorage), new(mockLogger.MockLogger), &scheduler.LeaderConfiguration{})
+	ha.RequestStepDown()
+	ha.RequestStepDown()
+
+	select {
+	case <-ha.StepDownRequests():
+	default:
+		t.Fatal("Expected a step down request")
+	}
+
+	select {
+	case <-ha.StepDownRequests():
+		t.Fatal("Only one step down request should have been pending")
+	default:
+	}
+}
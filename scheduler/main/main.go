@@ -16,26 +16,34 @@ package main
 
 import (
 	"encoding/base64"
+	"errors"
 	"flag"
+	"fmt"
 	"hydrogen/scheduler"
 	"hydrogen/scheduler/api"
 	apiManager "hydrogen/scheduler/api/manager"
 	"hydrogen/scheduler/controller"
 	"hydrogen/scheduler/events"
 	"hydrogen/scheduler/ha"
+	"hydrogen/scheduler/status"
 	"hydrogen/task/manager"
 	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/bolt"
+	"hydrogen/task/persistence/drivers/etcd"
+	"hydrogen/task/persistence/drivers/memory"
+	"hydrogen/task/persistence/encryption"
+	"hydrogen/task/placement"
+	"hydrogen/task/volumes"
 	"mesos-framework-sdk/client"
 	"mesos-framework-sdk/include/mesos_v1"
 	"mesos-framework-sdk/include/mesos_v1_scheduler"
 	"mesos-framework-sdk/logging"
-	"mesos-framework-sdk/persistence/drivers/etcd"
-	resourceManager "mesos-framework-sdk/resources/manager"
 	sched "mesos-framework-sdk/scheduler"
 	"mesos-framework-sdk/server"
 	"mesos-framework-sdk/server/file"
 	sdkTaskManager "mesos-framework-sdk/task/manager"
 	t "mesos-framework-sdk/task/manager"
+	"os"
 	"strings"
 )
 
@@ -58,6 +66,22 @@ func main() {
 
 	flag.Parse()
 
+	// Subcommands work on persistent storage directly, without starting the scheduler.
+	// Snapshots copy values as they're stored, so encrypted values stay encrypted.
+	switch flag.Arg(0) {
+	case "snapshot", "reencrypt":
+		kv, err := newKeyValueStore(config.Persistence)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to persistent storage: %s\n", err.Error())
+			os.Exit(9)
+		}
+
+		if flag.Arg(0) == "snapshot" {
+			os.Exit(runSnapshot(kv, flag.Args()[1:]))
+		}
+		os.Exit(runReencrypt(kv, config.Persistence))
+	}
+
 	// Executor Server
 	execSrvCfg := server.NewConfiguration(
 		config.FileServer.Cert,
@@ -72,17 +96,28 @@ func main() {
 	go executorSrv.Serve()
 
 	// Storage interface that holds client and retry policy manager.
-	p := persistence.NewPersistence(etcd.NewClient(
-		strings.Split(config.Persistence.Endpoints, ","),
-		config.Persistence.Timeout,
-		config.Persistence.KeepaliveTime,
-		config.Persistence.KeepaliveTimeout,
-	), config.Persistence.MaxRetries)
-
-	// Manages our tasks.
-	taskManager := manager.NewTaskManager(
+	kv, err := newKeyValueStore(config.Persistence)
+	if err != nil {
+		logger.Emit(logging.ERROR, "Failed to connect to persistent storage: %s", err.Error())
+		os.Exit(9)
+	}
+	kv, err = withEncryption(kv, config.Persistence)
+	if err != nil {
+		logger.Emit(logging.ERROR, "Failed to load encryption keys: %s", err.Error())
+		os.Exit(9)
+	}
+	p := persistence.NewPersistence(
+		kv,
+		config.Persistence.MaxRetries,
+		config.Persistence.RetryBaseDelay,
+		config.Persistence.RetryMaxDelay,
+	)
+
+	// Manages our tasks, batching what they write.
+	taskManager := manager.NewBatchingTaskManager(
 		make(map[string]*t.Task),
 		p,
+		persistence.NewWriter(p, config.Persistence.BatchSize, config.Persistence.BatchDelay, logger),
 		logger,
 	)
 
@@ -90,25 +125,33 @@ func main() {
 		[]byte(config.Scheduler.Principal+":"+config.Scheduler.Secret),
 	)
 
-	r := resourceManager.NewDefaultResourceManager() // Manages resources from the cluster
+	ranking, ok := placement.Rankings[config.Scheduler.OfferRanking]
+	if !ok {
+		logger.Emit(logging.ERROR, "Unknown offer ranking %s", config.Scheduler.OfferRanking)
+		os.Exit(10)
+	}
+	r := manager.NewResourceManager(ranking) // Manages resources from the cluster
 	c := client.NewClient(client.ClientData{
 		Endpoint: config.Scheduler.MesosEndpoint,
 		Auth:     auth,
 	}, logger) // Manages scheduler/executor HTTP calls, authorization, and new master detection.
-	s := sched.NewDefaultScheduler(c, frameworkInfo, logger) // Manages how to route and schedule tasks.
-	m := apiManager.NewApiParser(r, taskManager, s)          // Middleware for our API.
+	s := sched.NewDefaultScheduler(c, frameworkInfo, logger)                        // Manages how to route and schedule tasks.
+	reservations := volumes.NewReservations(p)                                      // What we've reserved for persistent volumes.
+	m := apiManager.NewApiParser(r, taskManager, reservations, s, config.APIServer) // Middleware for our API.
 	ha := ha.NewHA(p, logger, config.Leader)
+	st := status.New() // Tracks what the scheduler is doing for the API to report.
 
 	// Used to listen for events coming from mesos master to our scheduler.
 	eventChan := make(chan *mesos_v1_scheduler.Event)
 	reviveChan := make(chan *sdkTaskManager.Task)
 
 	// Event controller manages scheduler events and how they are handled.
-	e := controller.NewEventController(config, s, taskManager, p, logger, ha)
+	e := controller.NewEventController(config, s, taskManager, p, logger, ha, st)
 
 	logger.Emit(logging.INFO, "Starting API server")
 
 	// Run our API in a go routine to listen for user requests.
+	// Until we win the election, reads are served from the leader's mirrored tasks and writes are sent to the leader.
 	config.APIServer.Server = server.NewConfiguration(
 		config.APIServer.Cert,
 		config.APIServer.Key,
@@ -116,11 +159,36 @@ func main() {
 		config.APIServer.Port,
 	)
 
-	apiSrv := api.NewApiServer(config, m, logger)
+	apiSrv := api.NewApiServer(config, m, p, ha, st, s, logger)
 	go apiSrv.RunAPI(nil) // nil means to use default handlers.
 
 	// Run our event controller and kick off HA leader election.
 	// Then subscribe to Mesos and start listening for events.
-	h := events.NewHandler(taskManager, r, config, s, p, reviveChan, logger)
+	h := events.NewHandler(taskManager, r, config, s, p, reservations, reviveChan, st, logger)
 	e.Run(eventChan, reviveChan, h)
 }
+
+// Connects to the key-value store chosen by the persistence driver.
+func newKeyValueStore(c *scheduler.PersistenceConfiguration) (persistence.KeyValueStore, error) {
+	switch c.Driver {
+	case "etcd":
+		return etcd.NewClient(strings.Split(c.Endpoints, ","), c.Timeout, c.KeepaliveTime, c.KeepaliveTimeout)
+	case "bolt":
+		return bolt.NewClient(c.Path, c.Timeout)
+	case "memory":
+		return memory.New(), nil
+	default:
+		return nil, errors.New("Unknown persistence driver " + c.Driver)
+	}
+}
+
+// Encrypts task data with the configured keys, if there are any.
+// Without keys, task data that was encrypted fails to read rather than being quarantined as corrupt.
+func withEncryption(kv persistence.KeyValueStore, c *scheduler.PersistenceConfiguration) (persistence.KeyValueStore, error) {
+	keyring, err := encryption.LoadKeyring(c.EncryptionKeys)
+	if err != nil {
+		return kv, err
+	}
+
+	return encryption.New(kv, keyring, encryptedPrefixes...), nil
+}
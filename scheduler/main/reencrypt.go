@@ -0,0 +1,70 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hydrogen/scheduler"
+	"hydrogen/task/manager"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/encryption"
+	"os"
+)
+
+// Values under these prefixes are encrypted when encryption keys are given.
+var encryptedPrefixes = []string{
+	manager.TASK_DIRECTORY,
+	manager.QUARANTINE_DIRECTORY + "/",
+}
+
+// Runs the reencrypt subcommand, returning the exit code.
+// Every encrypted value is written again with the active key, so that older keys can be retired.
+// Values stored before encryption was turned on are encrypted too.
+func runReencrypt(kv persistence.KeyValueStore, c *scheduler.PersistenceConfiguration) int {
+	keyring, err := encryption.LoadKeyring(c.EncryptionKeys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load encryption keys: %s\n", err.Error())
+		return 1
+	}
+	if keyring == nil {
+		fmt.Fprintln(os.Stderr, encryption.NoKeysError.Error())
+		return 1
+	}
+
+	// A running leader could write a task between us reading and writing it.
+	leader, err := kv.Read("/leader")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the leader: %s\n", err.Error())
+		return 1
+	}
+	if leader != "" {
+		fmt.Fprintln(os.Stderr, "A scheduler is leading, stop every scheduler before re-encrypting")
+		return 1
+	}
+
+	written, err := encryption.New(kv, keyring, encryptedPrefixes...).Reencrypt()
+	if _, ok := err.(*persistence.UnreadableError); ok {
+		fmt.Fprintf(os.Stderr, "Nothing was re-encrypted, some values can't be decrypted: %s\n", err.Error())
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to re-encrypt after writing %d values: %s\n", written, err.Error())
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Re-encrypted %d values with key %s\n", written, keyring.Active())
+
+	return 0
+}
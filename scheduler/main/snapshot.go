@@ -0,0 +1,87 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/snapshot"
+	"os"
+)
+
+const snapshotUsage = `Usage:
+  snapshot export                  Writes our state to stdout
+  snapshot import [-force] <file>  Reads our state from the file, "-" means stdin`
+
+// Runs the snapshot subcommand against the store, returning the exit code.
+func runSnapshot(kv persistence.KeyValueStore, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		return 1
+	}
+
+	switch args[0] {
+	case "export":
+		s, err := snapshot.Export(kv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export snapshot: %s\n", err.Error())
+			return 1
+		}
+
+		if err := s.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write snapshot: %s\n", err.Error())
+			return 1
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %d keys at revision %d\n", len(s.Entries), s.Revision)
+	case "import":
+		flags := flag.NewFlagSet("snapshot import", flag.ContinueOnError)
+		force := flags.Bool("force", false, "Replace any state already in storage, deleting what the snapshot doesn't hold")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, snapshotUsage)
+			return 1
+		}
+
+		in := os.Stdin
+		if flags.Arg(0) != "-" {
+			f, err := os.Open(flags.Arg(0))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to open snapshot: %s\n", err.Error())
+				return 1
+			}
+			defer f.Close()
+			in = f
+		}
+
+		s, err := snapshot.Read(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read snapshot: %s\n", err.Error())
+			return 1
+		}
+
+		if err := snapshot.Import(kv, s, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import snapshot: %s\n", err.Error())
+			return 1
+		}
+
+		fmt.Fprintf(os.Stderr, "Imported %d keys from revision %d\n", len(s.Entries), s.Revision)
+	default:
+		fmt.Fprintln(os.Stderr, snapshotUsage)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"hydrogen/task/queue"
+	"sync"
+	"time"
+)
+
+// Version of the scheduler, set at build time with -ldflags "-X hydrogen/scheduler/status.Version=...".
+var Version = "dev"
+
+// Status keeps track of what the scheduler is doing so that it can be reported through the API.
+// It's written to by the event handlers and the controller, and read by the API server.
+type Status struct {
+	mutex         sync.RWMutex
+	started       time.Time
+	subscribed    bool
+	lastHeartbeat time.Time
+	lastReconcile time.Time
+	queue         []queue.App
+}
+
+// Returns a new status for a scheduler that has just started.
+func New() *Status {
+	return &Status{started: time.Now()}
+}
+
+// Started is when the scheduler was started.
+func (s *Status) Started() time.Time {
+	return s.started
+}
+
+// SetSubscribed records whether we currently hold a subscription with the Mesos master.
+func (s *Status) SetSubscribed(subscribed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.subscribed = subscribed
+}
+
+// Subscribed tells us if we currently hold a subscription with the Mesos master.
+func (s *Status) Subscribed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.subscribed
+}
+
+// Heartbeat records that the Mesos master has just been heard from.
+func (s *Status) Heartbeat() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastHeartbeat = time.Now()
+}
+
+// LastHeartbeat is when the Mesos master was last heard from.
+// The zero time means it never has been.
+func (s *Status) LastHeartbeat() time.Time {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.lastHeartbeat
+}
+
+// Reconciled records that periodic reconciliation has just run.
+func (s *Status) Reconciled() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastReconcile = time.Now()
+}
+
+// LastReconcile is when periodic reconciliation last ran.
+// The zero time means it never has.
+func (s *Status) LastReconcile() time.Time {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.lastReconcile
+}
+
+// NextReconcile is when periodic reconciliation is due to run again, given its interval.
+func (s *Status) NextReconcile(interval time.Duration) time.Time {
+	last := s.LastReconcile()
+	if last.IsZero() {
+		last = s.started
+	}
+
+	return last.Add(interval)
+}
+
+// SetQueue records the applications that are waiting for tasks to be launched, as of the last offers we were sent.
+func (s *Status) SetQueue(apps []queue.App) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queue = apps
+}
+
+// Queue is what was last recorded by SetQueue, in the order tasks are launched in.
+func (s *Status) Queue() []queue.App {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]queue.App(nil), s.queue...)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"hydrogen/task/queue"
+	"testing"
+	"time"
+)
+
+func TestStatus_Subscribed(t *testing.T) {
+	s := New()
+	if s.Subscribed() {
+		t.Fatal("A new status shouldn't be subscribed")
+	}
+
+	s.SetSubscribed(true)
+	if !s.Subscribed() {
+		t.Fatal("Status should be subscribed")
+	}
+}
+
+func TestStatus_Heartbeat(t *testing.T) {
+	s := New()
+	if !s.LastHeartbeat().IsZero() {
+		t.Fatal("A new status shouldn't have seen a heartbeat")
+	}
+
+	s.Heartbeat()
+	if s.LastHeartbeat().IsZero() {
+		t.Fatal("Heartbeat wasn't recorded")
+	}
+}
+
+func TestStatus_NextReconcile(t *testing.T) {
+	s := New()
+	if next := s.NextReconcile(time.Minute); !next.Equal(s.Started().Add(time.Minute)) {
+		t.Fatalf("First reconcile should be due an interval after starting, got %v", next)
+	}
+
+	s.Reconciled()
+	if next := s.NextReconcile(time.Minute); !next.Equal(s.LastReconcile().Add(time.Minute)) {
+		t.Fatalf("Next reconcile should be due an interval after the last one, got %v", next)
+	}
+}
+
+func TestStatus_Queue(t *testing.T) {
+	s := New()
+	if len(s.Queue()) != 0 {
+		t.Fatal("A new status shouldn't have anything queued")
+	}
+
+	s.SetQueue([]queue.App{{Name: "web", Queued: 2}})
+	apps := s.Queue()
+	apps[0].Queued = 0
+	if q := s.Queue(); len(q) != 1 || q[0].Queued != 2 {
+		t.Fatalf("Expected the recorded queue back untouched, got %+v", q)
+	}
+}
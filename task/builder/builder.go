@@ -16,6 +16,9 @@ package builder
 
 import (
 	"errors"
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
+	"hydrogen/task/volumes"
 	"mesos-framework-sdk/include/mesos_v1"
 	resourcebuilder "mesos-framework-sdk/resources"
 	"mesos-framework-sdk/task"
@@ -27,14 +30,59 @@ import (
 	"mesos-framework-sdk/task/resources"
 	"mesos-framework-sdk/task/retry"
 	"mesos-framework-sdk/utils"
+	"strings"
 	"time"
 )
 
 var NoNameError = errors.New("A name is required for the application. Please set the name field.")
 var NoResourcesError = errors.New("Application requested with no resources. Please set some resources.")
 
+type (
+	// An application definition as the API accepts it.
+	// Adds placement constraints, spread strategies, offer rankings, host ports, persistent volumes and priorities on top
+	// of what the SDK understands.
+	ApplicationJSON struct {
+		task.ApplicationJSON
+		Strategy         StrategyJSON `json:"strategy"`
+		Constraints      [][]string   `json:"constraints"`
+		Ranking          string       `json:"ranking,omitempty"` // Overrides the scheduler's offer ranking.
+		Ports            []PortJSON   `json:"ports,omitempty"`
+		PersistentVolume *VolumeJSON  `json:"persistent_volume,omitempty"`
+		Priority         int          `json:"priority,omitempty"` // Higher goes first, and can preempt lower.
+	}
+
+	// Deployment strategy, the key is the agent attribute or fault domain field a spread strategy balances across.
+	StrategyJSON struct {
+		Type string `json:"type"`
+		Key  string `json:"key,omitempty"`
+	}
+
+	// Host port requested by an application, any free port is picked if none is given.
+	// The container port maps the host port into the application's container networks.
+	PortJSON struct {
+		Name          string `json:"name,omitempty"`
+		Port          uint32 `json:"port,omitempty"`
+		Protocol      string `json:"protocol,omitempty"`
+		ContainerPort uint32 `json:"container_port,omitempty"`
+	}
+
+	// Persistent volume reserved for each of the application's instances, which are then always run where theirs is.
+	// The size is in megabytes and the mode is either RW or RO.
+	VolumeJSON struct {
+		Size          float64 `json:"size"`
+		ContainerPath string  `json:"container_path"`
+		Mode          string  `json:"mode,omitempty"`
+	}
+)
+
+var StrategyKeyError = errors.New("Only the spread strategy takes a key.")
+var DeprecatedFilterError = errors.New("Filters of this type are ignored and will be rejected in a future release. " +
+	"Please use TEXT, SCALAR, SET or RANGES.")
+var UnknownRankingError = errors.New("Unknown offer ranking. Please use binpack, spread or random.")
+var ContainerPortError = errors.New("Container ports can only be mapped into container networks. Please set a network.")
+
 // Parses a 1...n tasks.  Any error fails all other tasks.
-func Application(tasks ...*task.ApplicationJSON) ([]*manager.Task, error) {
+func Application(tasks ...*ApplicationJSON) ([]*manager.Task, error) {
 	parsedTasks := []*manager.Task{}
 
 	for _, t := range tasks {
@@ -87,10 +135,18 @@ func Application(tasks ...*task.ApplicationJSON) ([]*manager.Task, error) {
 		name := t.Name
 		taskId := &mesos_v1.TaskID{Value: utils.ProtoString(name)}
 
+		// Filters only match offers by their attributes, anything else is kept in the task's placement.
+		// Filters of other types are still accepted, but ignored.
 		if len(t.Filters) > 0 {
-			taskIntent.Filters = t.Filters
+			taskIntent.Filters = append([]task.Filter{}, t.Filters...)
 		}
 
+		constraints, err := placement.ParseAll(t.Constraints)
+		if err != nil {
+			return nil, err
+		}
+		p := placement.Placement{Constraints: constraints, Priority: t.Priority}
+
 		if t.Retry != nil {
 			duration, err := time.ParseDuration(t.Retry.Time + "s")
 			if err != nil {
@@ -116,7 +172,33 @@ func Application(tasks ...*task.ApplicationJSON) ([]*manager.Task, error) {
 
 		taskIntent.Instances = t.Instances
 
-		taskIntent.Strategy = t.Strategy
+		if t.Strategy.Key != "" {
+			if strings.ToLower(t.Strategy.Type) != placement.SPREAD {
+				return nil, StrategyKeyError
+			}
+			p.Spread = t.Strategy.Key
+		}
+		taskIntent.Strategy = task.Strategy{Type: t.Strategy.Type}
+
+		if t.Ranking != "" {
+			if _, ok := placement.Rankings[strings.ToLower(t.Ranking)]; !ok {
+				return nil, UnknownRankingError
+			}
+			p.Ranking = strings.ToLower(t.Ranking)
+		}
+
+		if p.Ports, err = parsePorts(t); err != nil {
+			return nil, err
+		}
+
+		volume, stateful, err := parseVolume(t)
+		if err != nil {
+			return nil, err
+		}
+		if stateful {
+			p.Volume = &volume
+		}
+		placement.Set(taskIntent, p)
 
 		taskIntent.Info = resourcebuilder.CreateTaskInfo(
 			utils.ProtoString(name),
@@ -132,3 +214,36 @@ func Application(tasks ...*task.ApplicationJSON) ([]*manager.Task, error) {
 	}
 	return parsedTasks, nil
 }
+
+// Reads the host ports the application requests.
+func parsePorts(t *ApplicationJSON) ([]ports.Port, error) {
+	requested := make([]ports.Port, 0, len(t.Ports))
+	for _, p := range t.Ports {
+		if p.ContainerPort != 0 && (t.Container == nil || len(t.Container.Network) == 0) {
+			return nil, ContainerPortError
+		}
+		requested = append(requested, ports.Port{
+			Name:      p.Name,
+			Protocol:  p.Protocol,
+			Host:      p.Port,
+			Container: p.ContainerPort,
+		})
+	}
+
+	return ports.Validate(requested)
+}
+
+// Reads the persistent volume the application requests, if any.
+func parseVolume(t *ApplicationJSON) (volumes.Volume, bool, error) {
+	if t.PersistentVolume == nil {
+		return volumes.Volume{}, false, nil
+	}
+
+	v := volumes.Volume{
+		Size:          t.PersistentVolume.Size,
+		ContainerPath: t.PersistentVolume.ContainerPath,
+		Mode:          t.PersistentVolume.Mode,
+	}
+
+	return v, true, v.Validate()
+}
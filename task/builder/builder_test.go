@@ -15,6 +15,9 @@
 package builder
 
 import (
+	"hydrogen/task/placement"
+	"hydrogen/task/priority"
+	"hydrogen/task/volumes"
 	"mesos-framework-sdk/task"
 	"mesos-framework-sdk/utils"
 	"testing"
@@ -53,13 +56,223 @@ func TestApplication(t *testing.T) {
 		Labels:  a,
 		Filters: b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err != nil {
 		t.Log(err.Error())
 		t.FailNow()
 	}
 }
 
+func TestApplicationConstraints(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+			Filters: []task.Filter{{Type: "TEXT", Value: []string{"ssd"}}},
+		},
+		Constraints: [][]string{{"hostname", "UNIQUE"}},
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if f := tasks[0].Filters; len(f) != 2 || len(placement.Of(tasks[0]).Constraints) != 1 || len(test.Filters) != 1 {
+		t.Logf("Expected the constraint to be kept in the task's placement, got %v", f)
+		t.FailNow()
+	}
+
+	// Filters only match attributes, so nothing can be slipped into the placement through them.
+	// Other types are still accepted, with a warning.
+	test.Filters = append(test.Filters, placement.Placement{Priority: 100}.Filter())
+	tasks, err = Application(test)
+	if err != nil || placement.Of(tasks[0]).Priority != 0 {
+		t.Logf("Expected a filter of another type to be accepted but left out of the placement, got %v", err)
+		t.FailNow()
+	}
+	if errs := Validate("$", test); len(errs) != 0 {
+		t.Logf("Expected no errors for the filter, got %v", errs)
+		t.FailNow()
+	}
+	if warnings := Deprecations("$", test); len(warnings) != 1 || warnings[0].Path != "$.filters[1]" {
+		t.Logf("Expected a warning for the filter, got %v", warnings)
+		t.FailNow()
+	}
+	test.Filters = test.Filters[:1]
+
+	test.Constraints = [][]string{{"hostname", "NEAR"}}
+	if _, err := Application(test); err == nil {
+		t.Log("Expected an unknown constraint operator to fail.")
+		t.FailNow()
+	}
+}
+
+func TestApplicationSpread(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+		},
+		Strategy: StrategyJSON{Type: "spread", Key: "rack"},
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if tasks[0].Strategy.Type != placement.SPREAD || placement.Of(tasks[0]).SpreadField() != "rack" {
+		t.Logf("Expected instances to be spread across racks, got %v %v", tasks[0].Strategy, tasks[0].Filters)
+		t.FailNow()
+	}
+
+	test.Strategy.Type = "unique"
+	if _, err := Application(test); err != StrategyKeyError {
+		t.Log("Expected a key on a strategy other than spread to fail.")
+		t.FailNow()
+	}
+}
+
+func TestApplicationPorts(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+		},
+		Ports: []PortJSON{{Name: "http"}, {Port: 9000, Protocol: "UDP"}},
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	requested := placement.Of(tasks[0]).Ports
+	if len(requested) != 2 || requested[0].Protocol != "tcp" || requested[1].Host != 9000 || requested[1].Protocol != "udp" {
+		t.Logf("Expected the task to carry its ports, got %v", requested)
+		t.FailNow()
+	}
+
+	test.Ports[0].ContainerPort = 8080
+	if _, err := Application(test); err != ContainerPortError {
+		t.Log("Expected a container port without a container network to fail.")
+		t.FailNow()
+	}
+
+	test.Ports = []PortJSON{{Port: 9000}, {Port: 9000}}
+	if errs := Validate("$", test); len(errs) != 1 || errs[0].Path != "$.ports" {
+		t.Logf("Expected an error for the ports, got %v", errs)
+		t.FailNow()
+	}
+}
+
+func TestApplicationVolume(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+		},
+		PersistentVolume: &VolumeJSON{Size: 1024, ContainerPath: "data"},
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if v := placement.Of(tasks[0]).Volume; v == nil || v.Size != 1024 || v.Mode != volumes.RW {
+		t.Logf("Expected the task to carry a read-write volume, got %v", tasks[0].Filters)
+		t.FailNow()
+	}
+
+	test.PersistentVolume.ContainerPath = ""
+	if errs := Validate("$", test); len(errs) != 1 || errs[0].Path != "$.persistent_volume" {
+		t.Logf("Expected an error for the volume, got %v", errs)
+		t.FailNow()
+	}
+}
+
+func TestApplicationPriority(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+		},
+		Priority: 100,
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if p := priority.Of(tasks[0]); p != 100 {
+		t.Logf("Expected the task to carry its priority, got %d", p)
+		t.FailNow()
+	}
+}
+
+func TestApplicationRanking(t *testing.T) {
+	test := &ApplicationJSON{
+		ApplicationJSON: task.ApplicationJSON{
+			Name: "Test Task",
+			Resources: &task.ResourceJSON{
+				Cpu: 0.5,
+				Mem: 128.0,
+			},
+			Command: &task.CommandJSON{
+				Cmd: utils.ProtoString("/bin/sleep 1"),
+			},
+		},
+		Ranking: "Spread",
+	}
+	tasks, err := Application(test)
+	if err != nil {
+		t.Log(err.Error())
+		t.FailNow()
+	}
+	if _, ok := placement.Of(tasks[0]).Rank(); !ok {
+		t.Logf("Expected the task to carry its ranking, got %v", tasks[0].Filters)
+		t.FailNow()
+	}
+
+	test.Ranking = "tetris"
+	if _, err := Application(test); err != UnknownRankingError {
+		t.Log("Expected an unknown ranking to fail.")
+		t.FailNow()
+	}
+	if errs := Validate("$", test); len(errs) != 1 || errs[0].Path != "$.ranking" {
+		t.Logf("Expected an error for the ranking, got %v", errs)
+		t.FailNow()
+	}
+}
+
 func TestApplicationNoName(t *testing.T) {
 	a := make(map[string]string, 0)
 	b := make([]task.Filter, 0)
@@ -73,7 +286,7 @@ func TestApplicationNoName(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err == nil {
 		t.Log(err.Error())
 		t.FailNow()
@@ -93,7 +306,7 @@ func TestApplicationNoResources(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err == nil {
 		t.Log(err.Error())
 		t.FailNow()
@@ -118,7 +331,7 @@ func TestApplicationCommandFail(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err == nil {
 		t.Log(err.Error())
 		t.FailNow()
@@ -149,7 +362,7 @@ func TestApplicationContainerFail(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err == nil {
 		t.Log(err)
 		t.FailNow()
@@ -192,7 +405,7 @@ func TestApplicationWithDockerContainer(t *testing.T) {
 		Labels:  a,
 		Filters: b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err != nil {
 		t.Log(err.Error())
 		t.FailNow()
@@ -220,7 +433,7 @@ func TestApplicationFailResources(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err == nil {
 		t.Log(err.Error())
 		t.FailNow()
@@ -248,7 +461,7 @@ func TestApplicationFailLabels(t *testing.T) {
 		Labels:      a,
 		Filters:     b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 
 	if err == nil {
 		t.FailNow()
@@ -289,9 +502,39 @@ func TestApplicationHealthChecks(t *testing.T) {
 		Labels:  a,
 		Filters: b,
 	}
-	_, err := Application(test)
+	_, err := Application(&ApplicationJSON{ApplicationJSON: *test})
 	if err != nil {
 		t.Log(err.Error())
 		t.FailNow()
 	}
 }
+
+func TestValidate(t *testing.T) {
+	test := &task.ApplicationJSON{
+		Name:      "",
+		Resources: nil,
+		Command: &task.CommandJSON{
+			Cmd: utils.ProtoString("/bin/sleep 1"),
+		},
+		Retry: &task.TimeRetry{Time: "not a number"},
+	}
+	errs := Validate("$[0]", &ApplicationJSON{
+		ApplicationJSON: *test,
+		Constraints:     [][]string{{"hostname", "UNIQUE"}, {"hostname", "NEAR"}},
+	})
+	if len(errs) != 4 {
+		t.Logf("Expected 4 errors, got %v", errs)
+		t.FailNow()
+	}
+
+	paths := map[string]bool{}
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, path := range []string{"$[0].name", "$[0].resources", "$[0].retry.time", "$[0].constraints[1]"} {
+		if !paths[path] {
+			t.Logf("Expected an error for %s, got %v", path, errs)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	taskManager "hydrogen/task/manager"
+	"hydrogen/task/placement"
+	"mesos-framework-sdk/task/command"
+	"mesos-framework-sdk/task/container"
+	"mesos-framework-sdk/task/healthcheck"
+	"mesos-framework-sdk/task/labels"
+	"mesos-framework-sdk/task/resources"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Describes a single problem with an application definition.
+// The path is a JSON path pointing at the offending field, such as "$[0].resources".
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validate runs the same parsing steps as Application but keeps going after a failure.
+// Every problem found is reported against the path of the field that caused it.
+// The root is the JSON path of the application itself, such as "$[0]" or "$".
+func Validate(root string, t *ApplicationJSON) []FieldError {
+	errs := []FieldError{}
+	add := func(field string, err error) {
+		errs = append(errs, FieldError{Path: root + "." + field, Message: err.Error()})
+	}
+
+	if t.Name == "" {
+		add("name", NoNameError)
+	}
+
+	if t.Resources == nil {
+		add("resources", NoResourcesError)
+	} else if _, err := resources.ParseResources(t.Resources); err != nil {
+		add("resources", err)
+	}
+
+	cmd, err := command.ParseCommandInfo(t.Command)
+	if err != nil {
+		add("command", err)
+	}
+
+	if _, err := container.ParseContainer(t.Container); err != nil {
+		add("container", err)
+	}
+
+	if _, err := labels.ParseLabels(t.Labels); err != nil {
+		add("labels", err)
+	}
+
+	// Health checks can depend on the command, so they're only checked once the command parses.
+	if err == nil {
+		if _, err := healthcheck.ParseHealthCheck(t.HealthCheck, cmd); err != nil {
+			add("healthcheck", err)
+		}
+	}
+
+	if t.Retry != nil {
+		if _, err := time.ParseDuration(t.Retry.Time + "s"); err != nil {
+			add("retry.time", err)
+		}
+	}
+
+	if t.Strategy.Key != "" && strings.ToLower(t.Strategy.Type) != placement.SPREAD {
+		add("strategy.key", StrategyKeyError)
+	}
+
+	if _, ok := placement.Rankings[strings.ToLower(t.Ranking)]; t.Ranking != "" && !ok {
+		add("ranking", UnknownRankingError)
+	}
+
+	if _, err := parsePorts(t); err != nil {
+		add("ports", err)
+	}
+
+	if _, _, err := parseVolume(t); err != nil {
+		add("persistent_volume", err)
+	}
+
+	for i, raw := range t.Constraints {
+		if _, err := placement.Parse(raw); err != nil {
+			add("constraints["+strconv.Itoa(i)+"]", err)
+		}
+	}
+
+	return errs
+}
+
+// Deprecations reports what the application still relies on that we only keep accepting for now.
+func Deprecations(root string, t *ApplicationJSON) []FieldError {
+	warnings := []FieldError{}
+	for i, f := range t.Filters {
+		if !taskManager.IsAttributeFilter(f) {
+			warnings = append(warnings, FieldError{
+				Path:    root + ".filters[" + strconv.Itoa(i) + "]",
+				Message: DeprecatedFilterError.Error(),
+			})
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"math"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task/manager"
+	"sync"
+	"time"
+)
+
+// Agents keeps track of the agents Mesos has scheduled maintenance for, from the inverse offers we're sent.
+// Nothing new is placed on them, and what's running on them is moved elsewhere.
+type Agents struct {
+	mutex  sync.RWMutex
+	offers map[string]*mesos_v1.InverseOffer // By agent ID.
+}
+
+// Returns an empty set of agents.
+func NewAgents() *Agents {
+	return &Agents{offers: make(map[string]*mesos_v1.InverseOffer)}
+}
+
+// Drain records that the inverse offer's agent is going down for maintenance.
+func (a *Agents) Drain(offer *mesos_v1.InverseOffer) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.offers[offer.GetAgentId().GetValue()] = offer
+}
+
+// Rescind forgets the agent of an inverse offer that Mesos took back.
+func (a *Agents) Rescind(id string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for agent, offer := range a.offers {
+		if offer.GetId().GetValue() == id {
+			delete(a.offers, agent)
+		}
+	}
+}
+
+// Draining tells us if the agent is going down for maintenance, and nothing new should be placed on it.
+func (a *Agents) Draining(agent string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	offer, ok := a.offers[agent]
+	return ok && Affects(offer.GetUnavailability(), time.Now())
+}
+
+// Affects tells us if a maintenance window still matters at the given time, which it does unless it's over.
+// Windows without a duration never end.
+func Affects(u *mesos_v1.Unavailability, now time.Time) bool {
+	if u == nil {
+		return false
+	}
+	if u.GetDuration() == nil {
+		return true
+	}
+
+	end := time.Unix(0, u.GetStart().GetNanoseconds()+u.GetDuration().GetNanoseconds())
+	return now.Before(end)
+}
+
+// Movable tells us if an instance can be killed to move it off an agent without taking its group below the minimum
+// share of instances that have to stay running. The group includes the instance itself, and instances that are already
+// being moved don't count as running.
+func Movable(t *manager.Task, group []*manager.Task, minimum float64, moving func(*manager.Task) bool) bool {
+	running := 0
+	for _, instance := range group {
+		if instance.State == manager.RUNNING && !moving(instance) && instance.Info.GetName() != t.Info.GetName() {
+			running++
+		}
+	}
+
+	// Rounding errors aren't allowed to ask for one more instance than the minimum does.
+	required := int(math.Ceil(minimum*float64(len(group)) - 1e-9))
+	return running >= required
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func window(start time.Time, duration time.Duration) *mesos_v1.Unavailability {
+	u := &mesos_v1.Unavailability{Start: &mesos_v1.TimeInfo{Nanoseconds: utils.ProtoInt64(start.UnixNano())}}
+	if duration > 0 {
+		u.Duration = &mesos_v1.DurationInfo{Nanoseconds: utils.ProtoInt64(int64(duration))}
+	}
+
+	return u
+}
+
+func TestAffects(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		window  *mesos_v1.Unavailability
+		affects bool
+	}{
+		{"upcoming", window(now.Add(time.Hour), time.Hour), true},
+		{"underway", window(now.Add(-time.Minute), time.Hour), true},
+		{"over", window(now.Add(-2*time.Hour), time.Hour), false},
+		{"never ends", window(now.Add(-2*time.Hour), 0), true},
+		{"none", nil, false},
+	}
+
+	for _, test := range tests {
+		if got := Affects(test.window, now); got != test.affects {
+			t.Errorf("%s: expected %v, got %v", test.name, test.affects, got)
+		}
+	}
+}
+
+func TestAgents_Draining(t *testing.T) {
+	agents := NewAgents()
+	agents.Drain(&mesos_v1.InverseOffer{
+		Id:             &mesos_v1.OfferID{Value: utils.ProtoString("1")},
+		AgentId:        &mesos_v1.AgentID{Value: utils.ProtoString("a")},
+		Unavailability: window(time.Now(), time.Hour),
+	})
+	if !agents.Draining("a") || agents.Draining("b") {
+		t.Fatal("Expected only agent a to be draining")
+	}
+
+	agents.Rescind("2")
+	if !agents.Draining("a") {
+		t.Fatal("Another inverse offer being rescinded shouldn't matter")
+	}
+	agents.Rescind("1")
+	if agents.Draining("a") {
+		t.Fatal("Expected the agent to be forgotten once its inverse offer is rescinded")
+	}
+}
+
+func TestMovable(t *testing.T) {
+	group := []*manager.Task{}
+	for i := 1; i <= 4; i++ {
+		group = append(group, &manager.Task{
+			Info:  &mesos_v1.TaskInfo{Name: utils.ProtoString("web-" + strconv.Itoa(i))},
+			State: manager.RUNNING,
+		})
+	}
+	moving := map[*manager.Task]bool{}
+	isMoving := func(t *manager.Task) bool { return moving[t] }
+
+	if !Movable(group[0], group, 0.5, isMoving) {
+		t.Fatal("Expected 3 of 4 instances to be enough")
+	}
+	moving[group[0]] = true
+	if !Movable(group[1], group, 0.5, isMoving) {
+		t.Fatal("Expected 2 of 4 instances to be enough")
+	}
+	moving[group[1]] = true
+	if Movable(group[2], group, 0.5, isMoving) {
+		t.Fatal("1 of 4 instances is below the minimum")
+	}
+
+	group[3].State = manager.STAGING
+	if !Movable(group[0], group, 0.25, func(*manager.Task) bool { return false }) {
+		t.Fatal("Expected the other running instances to be enough")
+	}
+	if Movable(group[0], group[:1], 0.3, isMoving) {
+		t.Fatal("A single instance can't be moved unless the minimum is 0")
+	}
+	if !Movable(group[0], group[:1], 0, isMoving) {
+		t.Fatal("Expected anything to be movable without a minimum")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version of the task records we write.
+	// Bump it, and register a migration from the previous version, whenever the way tasks are persisted changes.
+	RecordVersion = 2
+
+	// Records we can't read are moved under here, keeping the rest of their key.
+	QUARANTINE_DIRECTORY = "/quarantine"
+)
+
+// Returned for records written by a newer version of the scheduler.
+// These aren't corrupt, so they're never quarantined.
+var NewerRecordError = errors.New("Task record was written by a newer version of the scheduler")
+
+type (
+	// Envelope that every task is persisted in.
+	// Records written before the envelope existed are version 0, and hold nothing but the encoded task.
+	record struct {
+		Version int    `json:"version"`
+		Task    []byte `json:"task"`
+	}
+
+	// Migration upgrades an encoded task from one record version to the next.
+	Migration func(data []byte) ([]byte, error)
+)
+
+// Migrations keyed by the version they upgrade from.
+var migrations = map[int]Migration{
+	// Version 1 only added the envelope, the task itself is encoded the same way.
+	0: func(data []byte) ([]byte, error) { return data, nil },
+	1: migratePlacement,
+}
+
+// RegisterMigration adds the migration that upgrades records from the given version.
+func RegisterMigration(from int, m Migration) {
+	migrations[from] = m
+}
+
+// EncodeRecord encodes the task in the current version of our record envelope.
+func EncodeRecord(t *manager.Task) ([]byte, error) {
+	data, err := t.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(record{Version: RecordVersion, Task: data})
+}
+
+// DecodeRecord decodes a task from any version of our record envelope, migrating it as needed.
+// Also tells us if the record was migrated, in which case it should be written again.
+func DecodeRecord(data []byte) (*manager.Task, bool, error) {
+	r := record{}
+	if err := json.Unmarshal(data, &r); err != nil || r.Version < 1 {
+		r = record{Version: 0, Task: data}
+	}
+
+	if r.Version > RecordVersion {
+		return nil, false, NewerRecordError
+	}
+
+	migrated := r.Version < RecordVersion
+	for ; r.Version < RecordVersion; r.Version++ {
+		m, ok := migrations[r.Version]
+		if !ok {
+			return nil, false, errors.New("No migration from task record version " + strconv.Itoa(r.Version))
+		}
+
+		upgraded, err := m(r.Task)
+		if err != nil {
+			return nil, false, err
+		}
+		r.Task = upgraded
+	}
+
+	t, err := new(manager.Task).Decode(r.Task)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return t, migrated, nil
+}
+
+// Version 2 keeps the task's placement in a single filter, where version 1 had a filter for each part of it.
+// Parts that couldn't be read are dropped, as they were ignored before.
+func migratePlacement(data []byte) ([]byte, error) {
+	t, err := new(manager.Task).Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := placement.Placement{}
+	filters := make([]task.Filter, 0, len(t.Filters))
+	for _, f := range t.Filters {
+		v := f.Value
+		switch strings.ToUpper(f.Type) {
+		case "CONSTRAINT":
+			if c, err := placement.Parse(v); err == nil {
+				p.Constraints = append(p.Constraints, c)
+			}
+		case "STRATEGY":
+			if len(v) == 1 {
+				p.Spread = v[0]
+			}
+		case "RANKING":
+			if len(v) == 1 {
+				p.Ranking = strings.ToLower(v[0])
+			}
+		case "PORT":
+			if len(v) != 4 {
+				continue
+			}
+			host, err := strconv.ParseUint(v[2], 10, 32)
+			if err != nil {
+				continue
+			}
+			container, err := strconv.ParseUint(v[3], 10, 32)
+			if err != nil {
+				continue
+			}
+			p.Ports = append(p.Ports, ports.Port{Name: v[0], Protocol: v[1], Host: uint32(host), Container: uint32(container)})
+		case "VOLUME":
+			if len(v) != 3 {
+				continue
+			}
+			size, err := strconv.ParseFloat(v[0], 64)
+			volume := volumes.Volume{Size: size, ContainerPath: v[1], Mode: v[2]}
+			if err == nil && volume.Validate() == nil {
+				p.Volume = &volume
+			}
+		case "PRIORITY":
+			if len(v) == 1 {
+				p.Priority, _ = strconv.Atoi(v[0])
+			}
+		case "PREEMPTED":
+			p.Preempted = true
+		default:
+			filters = append(filters, f)
+		}
+	}
+	t.Filters = filters
+	placement.Set(t, p)
+
+	return t.Encode()
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"reflect"
+	"testing"
+)
+
+// Records we write are read back without migrating.
+func TestRecord_RoundTrip(t *testing.T) {
+	data, err := EncodeRecord(&manager.Task{Info: CreateTestTask("test")})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, migrated, err := DecodeRecord(data); err != nil || migrated {
+		t.Fatalf("Expected a current record, got migrated %v: %v", migrated, err)
+	}
+}
+
+// Records from before the envelope are migrated.
+func TestRecord_Migrate(t *testing.T) {
+	legacy, err := (&manager.Task{Info: CreateTestTask("test")}).Encode()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, migrated, err := DecodeRecord(legacy); err != nil || !migrated {
+		t.Fatalf("Expected the legacy record to be migrated, got migrated %v: %v", migrated, err)
+	}
+
+	RegisterMigration(0, func(data []byte) ([]byte, error) { return nil, errors.New("Broken") })
+	defer RegisterMigration(0, func(data []byte) ([]byte, error) { return data, nil })
+	if _, _, err := DecodeRecord(legacy); err == nil {
+		t.Fatal("Failed migrations should fail decoding")
+	}
+}
+
+// Records from a newer scheduler are told apart from corrupt ones.
+func TestRecord_Newer(t *testing.T) {
+	if _, _, err := DecodeRecord([]byte(`{"version": 99}`)); err != NewerRecordError {
+		t.Fatalf("Expected a newer record error, got %v", err)
+	}
+}
+
+// Placements kept in a filter for each of their parts are gathered into one.
+func TestRecord_MigratePlacement(t *testing.T) {
+	ssd := task.Filter{Type: "TEXT", Value: []string{"ssd"}}
+	legacy, _ := (&manager.Task{Info: CreateTestTask("test"), Filters: []task.Filter{
+		ssd,
+		{Type: "CONSTRAINT", Value: []string{"hostname", "UNIQUE", ""}},
+		{Type: "STRATEGY", Value: []string{"rack"}},
+		{Type: "PORT", Value: []string{"http", "tcp", "0", "8080"}},
+		{Type: "PORT", Value: []string{"", "udp", "9000", "0"}},
+		{Type: "VOLUME", Value: []string{"1024", "data", "RW"}},
+		{Type: "PRIORITY", Value: []string{"10"}},
+		{Type: "PREEMPTED"},
+	}}).Encode()
+	data, _ := json.Marshal(record{Version: 1, Task: legacy})
+
+	migrated, _, err := DecodeRecord(data)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	p := placement.Of(migrated)
+	expected := []ports.Port{{Name: "http", Protocol: "tcp", Container: 8080}, {Protocol: "udp", Host: 9000}}
+	if len(p.Constraints) != 1 || p.Spread != "rack" || !reflect.DeepEqual(p.Ports, expected) || p.Volume == nil ||
+		p.Volume.Size != 1024 || p.Priority != 10 || !p.Preempted {
+		t.Fatalf("Expected every part of the placement to be kept, got %+v", p)
+	}
+	if len(migrated.Filters) != 2 || !reflect.DeepEqual(migrated.Filters[0], ssd) {
+		t.Fatalf("Expected only the placement to be added to the other filters, got %v", migrated.Filters)
+	}
+}
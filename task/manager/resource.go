@@ -0,0 +1,325 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"errors"
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
+	"mesos-framework-sdk/include/mesos_v1"
+	resourceManager "mesos-framework-sdk/resources/manager"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Extends the SDK's resource manager with a say in which offer a task is placed on.
+	ResourceManager interface {
+		resourceManager.ResourceManager
+
+		// Like Assign, but only offers the function accepts are considered.
+		// A nil function accepts every offer.
+		AssignIf(task *manager.Task, accept func(*mesos_v1.Offer) bool) (*Assignment, error)
+
+		// Forgets an offer Mesos has taken back, telling us if we were holding it.
+		RemoveOffer(id *mesos_v1.OfferID) bool
+	}
+
+	// Assignment is the offer a task has been placed on, along with what it was given out of it.
+	Assignment struct {
+		Offer *mesos_v1.Offer
+		Ports []uint32 // Host ports, in the order the task requested them.
+	}
+
+	// Our resource manager, which holds the offers we're currently deciding on.
+	// Tasks are placed on the best ranked offer that has enough resources left and matches their filters.
+	// Several tasks can be placed on the same offer, so that they're launched together.
+	// Dynamically reserved resources aren't counted, they belong to the task they were reserved for.
+	ResourceHandler struct {
+		mutex   sync.Mutex
+		offers  []*heldOffer
+		filters map[string][]task.Filter // Added on top of the task's own, keyed by task name.
+		ranking placement.Ranking        // Used for tasks that don't pick their own.
+	}
+
+	// An offer along with how much of it is left.
+	heldOffer struct {
+		offer     *mesos_v1.Offer
+		remaining map[string]float64
+		ports     ports.Ranges
+		used      bool
+	}
+)
+
+// Returns the resource manager used by the scheduler, ranking offers with the given ranking by default.
+// Without a ranking, offers are used in the order they came in.
+func NewResourceManager(ranking placement.Ranking) *ResourceHandler {
+	return &ResourceHandler{filters: make(map[string][]task.Filter), ranking: ranking}
+}
+
+// Replaces the offers we're holding with the given ones.
+func (r *ResourceHandler) AddOffers(offers []*mesos_v1.Offer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.offers = make([]*heldOffer, 0, len(offers))
+	for _, offer := range offers {
+		r.offers = append(r.offers, &heldOffer{
+			offer:     offer,
+			remaining: scalars(unreserved(offer.GetResources())),
+			ports:     ports.FromResources(offer.GetResources()),
+		})
+	}
+}
+
+// Tells us if any offer has resources left to place tasks on.
+func (r *ResourceHandler) HasResources() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, held := range r.offers {
+		for _, amount := range held.remaining {
+			if amount > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Adds filters that the task's offers must match on top of its own.
+func (r *ResourceHandler) AddFilter(t *mesos_v1.TaskInfo, filters []task.Filter) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.filters[t.GetName()] = append(r.filters[t.GetName()], filters...)
+
+	return nil
+}
+
+// Removes the filters added for the task.
+func (r *ResourceHandler) ClearFilters(t *mesos_v1.TaskInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.filters, t.GetName())
+}
+
+// Places the task on the first offer that can run it.
+func (r *ResourceHandler) Assign(t *manager.Task) (*mesos_v1.Offer, error) {
+	a, err := r.AssignIf(t, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Offer, nil
+}
+
+// Places the task on the best ranked offer that can run it and that the function accepts.
+// The task's own ranking is used if it has one, otherwise ours is.
+// What the task needs is taken out of the offer, whatever is left can still be used by other tasks.
+func (r *ResourceHandler) AssignIf(t *manager.Task, accept func(*mesos_v1.Offer) bool) (*Assignment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	needs := scalars(t.Info.GetResources())
+	p := placement.Of(t)
+	requested := p.Ports
+	filters := append(append([]task.Filter{}, t.Filters...), r.filters[t.Info.GetName()]...)
+
+	candidates := []placement.Candidate{}
+	held := make(map[*mesos_v1.Offer]*heldOffer)
+	for _, h := range r.offers {
+		if !fits(h.remaining, needs) || !MatchesFilters(h.offer, filters) {
+			continue
+		}
+		if _, _, ok := ports.Allocate(h.ports, requested); !ok {
+			continue
+		}
+		if accept != nil && !accept(h.offer) {
+			continue
+		}
+
+		candidates = append(candidates, placement.Candidate{Offer: h.offer, Remaining: h.remaining})
+		held[h.offer] = h
+	}
+
+	if len(candidates) == 0 {
+		return nil, errors.New("No offer can run task " + t.Info.GetName())
+	}
+
+	ranking, ok := p.Rank()
+	if !ok {
+		ranking = r.ranking
+	}
+	if ranking != nil {
+		ranking(candidates, needs)
+	}
+
+	chosen := held[candidates[0].Offer]
+	for name, amount := range needs {
+		chosen.remaining[name] -= amount
+	}
+	allocated, left, _ := ports.Allocate(chosen.ports, requested)
+	chosen.ports = left
+	chosen.used = true
+
+	return &Assignment{Offer: chosen.offer, Ports: allocated}, nil
+}
+
+// Forgets an offer Mesos has taken back, so nothing else is placed on it.
+func (r *ResourceHandler) RemoveOffer(id *mesos_v1.OfferID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, held := range r.offers {
+		if held.offer.GetId().GetValue() == id.GetValue() {
+			r.offers = append(r.offers[:i], r.offers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Offers that no task has been placed on.
+func (r *ResourceHandler) Offers() []*mesos_v1.Offer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	offers := []*mesos_v1.Offer{}
+	for _, held := range r.offers {
+		if !held.used {
+			offers = append(offers, held.offer)
+		}
+	}
+
+	return offers
+}
+
+// HasScalars checks that the offer holds enough of every scalar resource requested.
+func HasScalars(offer *mesos_v1.Offer, res []*mesos_v1.Resource) bool {
+	return fits(scalars(offer.GetResources()), scalars(res))
+}
+
+// Tells us if the filter matches offers by their attributes, which is the only kind applications can ask for.
+func IsAttributeFilter(f task.Filter) bool {
+	switch strings.ToUpper(f.Type) {
+	case "TEXT", "SCALAR", "SET", "RANGES":
+		return true
+	}
+
+	return false
+}
+
+// MatchesFilters checks that every attribute filter matches at least one of the offer's attributes.
+// The task's placement is kept among its filters but isn't matched here. Filters of any other type are deprecated,
+// and never rule out an offer so that applications defined with them still run.
+func MatchesFilters(offer *mesos_v1.Offer, filters []task.Filter) bool {
+	for _, f := range filters {
+		if !IsAttributeFilter(f) {
+			continue
+		}
+
+		matched := false
+		for _, attr := range offer.GetAttributes() {
+			if matchesAttribute(attr, f) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Checks a single attribute against any of the filter's values.
+func matchesAttribute(attr *mesos_v1.Attribute, f task.Filter) bool {
+	for _, value := range f.Value {
+		switch strings.ToUpper(f.Type) {
+		case "TEXT":
+			if attr.GetType() == mesos_v1.Value_TEXT && attr.GetText().GetValue() == value {
+				return true
+			}
+		case "SCALAR":
+			n, err := strconv.ParseFloat(value, 64)
+			if err == nil && attr.GetType() == mesos_v1.Value_SCALAR && attr.GetScalar().GetValue() == n {
+				return true
+			}
+		case "SET":
+			if attr.GetType() == mesos_v1.Value_SET {
+				for _, item := range attr.GetSet().GetItem() {
+					if item == value {
+						return true
+					}
+				}
+			}
+		case "RANGES":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err == nil && attr.GetType() == mesos_v1.Value_RANGES {
+				for _, r := range attr.GetRanges().GetRange() {
+					if n >= r.GetBegin() && n <= r.GetEnd() {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Totals the scalar resources by name.
+func scalars(res []*mesos_v1.Resource) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, r := range res {
+		if r.GetType() == mesos_v1.Value_SCALAR {
+			totals[r.GetName()] += r.GetScalar().GetValue()
+		}
+	}
+
+	return totals
+}
+
+// Resources that haven't been dynamically reserved, those are only used by the tasks they were reserved for.
+func unreserved(res []*mesos_v1.Resource) []*mesos_v1.Resource {
+	free := make([]*mesos_v1.Resource, 0, len(res))
+	for _, r := range res {
+		if r.GetReservation() == nil {
+			free = append(free, r)
+		}
+	}
+
+	return free
+}
+
+// Tells us if what's available covers every need.
+func fits(available, needs map[string]float64) bool {
+	for name, amount := range needs {
+		if available[name] < amount {
+			return false
+		}
+	}
+
+	return true
+}
@@ -15,8 +15,9 @@
 package manager
 
 import (
+	"hydrogen/task/placement"
+	"hydrogen/task/ports"
 	"mesos-framework-sdk/include/mesos_v1"
-	"mesos-framework-sdk/resources/manager"
 	"mesos-framework-sdk/task"
 	manager2 "mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
@@ -50,7 +51,7 @@ func createOffers(num int) (o []*mesos_v1.Offer) {
 }
 
 func TestNewResourceManager(t *testing.T) {
-	rm := manager.NewDefaultResourceManager()
+	rm := NewResourceManager(nil)
 	if rm == nil {
 		t.Log("Failed to create a default resource manager.")
 		t.FailNow()
@@ -58,7 +59,7 @@ func TestNewResourceManager(t *testing.T) {
 }
 
 func TestResourceManager_AddOffers(t *testing.T) {
-	rm := manager.NewDefaultResourceManager()
+	rm := NewResourceManager(nil)
 	rm.AddOffers(createOffers(10))
 	if length := rm.Offers(); len(length) != 10 {
 		t.Logf("Expecting 10, got %v offers", len(length))
@@ -66,7 +67,7 @@ func TestResourceManager_AddOffers(t *testing.T) {
 }
 
 func TestResourceManager_HasResources(t *testing.T) {
-	rm := manager.NewDefaultResourceManager()
+	rm := NewResourceManager(nil)
 	rm.AddOffers(createOffers(1))
 	if !rm.HasResources() {
 		t.Log("No resources found in the resource manager, expecting some.")
@@ -74,7 +75,7 @@ func TestResourceManager_HasResources(t *testing.T) {
 }
 
 func TestResourceManager_Assign(t *testing.T) {
-	rm := manager.NewDefaultResourceManager()
+	rm := NewResourceManager(nil)
 	rm.AddOffers(createOffers(10))
 	o, err := rm.Assign(
 		&manager2.Task{
@@ -100,10 +101,141 @@ func TestResourceManager_Assign(t *testing.T) {
 }
 
 func TestResourceManager_Offers(t *testing.T) {
-	rm := manager.NewDefaultResourceManager()
+	rm := NewResourceManager(nil)
 	rm.AddOffers(createOffers(10))
 	if o := rm.Offers(); len(o) != 10 {
 		t.Logf("Expected 10 offers, got %v", len(o))
 		t.FailNow()
 	}
 }
+
+func TestResourceManager_RemoveOffer(t *testing.T) {
+	rm := NewResourceManager(nil)
+	offers := createOffers(2)
+	offers[0].Id = &mesos_v1.OfferID{Value: utils.ProtoString("1")}
+	offers[1].Id = &mesos_v1.OfferID{Value: utils.ProtoString("2")}
+	rm.AddOffers(offers)
+
+	if !rm.RemoveOffer(&mesos_v1.OfferID{Value: utils.ProtoString("1")}) {
+		t.Fatal("Expected the offer to be held")
+	}
+	if rm.RemoveOffer(&mesos_v1.OfferID{Value: utils.ProtoString("1")}) {
+		t.Fatal("The offer should already be gone")
+	}
+	if o := rm.Offers(); len(o) != 1 || o[0].GetId().GetValue() != "2" {
+		t.Fatalf("Expected only the other offer to be left, got %v", o)
+	}
+}
+
+func TestResourceManager_AssignIf(t *testing.T) {
+	rm := NewResourceManager(nil)
+	offers := createOffers(2)
+	rm.AddOffers(offers)
+	tsk := &manager2.Task{
+		Info: &mesos_v1.TaskInfo{
+			Name:      utils.ProtoString("test"),
+			Resources: createResources(6, 128),
+		},
+	}
+
+	// Only the second offer is accepted.
+	a, err := rm.AssignIf(tsk, func(o *mesos_v1.Offer) bool { return o == offers[1] })
+	if err != nil || a.Offer != offers[1] {
+		t.Logf("Expected the second offer, got %v: %v", a, err)
+		t.FailNow()
+	}
+
+	// What's left of the second offer isn't enough for another instance.
+	if _, err := rm.AssignIf(tsk, func(o *mesos_v1.Offer) bool { return o == offers[1] }); err == nil {
+		t.Log("Expected no offer to be left for the task.")
+		t.FailNow()
+	}
+
+	if l := rm.Offers(); len(l) != 1 || l[0] != offers[0] {
+		t.Logf("Expected only the first offer to be left, got %v", l)
+		t.FailNow()
+	}
+}
+
+// Binpacking fills the smaller offer first, spreading uses the larger one, and a task's own ranking wins.
+func TestResourceManager_Ranking(t *testing.T) {
+	small := &mesos_v1.Offer{Id: &mesos_v1.OfferID{Value: utils.ProtoString("small")}, Resources: createResources(2, 1024)}
+	large := &mesos_v1.Offer{Id: &mesos_v1.OfferID{Value: utils.ProtoString("large")}, Resources: createResources(8, 8192)}
+	tsk := func(filters ...task.Filter) *manager2.Task {
+		return &manager2.Task{
+			Info:    &mesos_v1.TaskInfo{Name: utils.ProtoString("test"), Resources: createResources(1, 512)},
+			Filters: filters,
+		}
+	}
+
+	tests := []struct {
+		ranking  placement.Ranking
+		task     *manager2.Task
+		expected *mesos_v1.Offer
+	}{
+		{nil, tsk(), large},
+		{placement.Rankings[placement.RANK_BINPACK], tsk(), small},
+		{placement.Rankings[placement.RANK_SPREAD], tsk(), large},
+		{placement.Rankings[placement.RANK_BINPACK], tsk(placement.Placement{Ranking: placement.RANK_SPREAD}.Filter()), large},
+	}
+
+	for i, test := range tests {
+		rm := NewResourceManager(test.ranking)
+		rm.AddOffers([]*mesos_v1.Offer{large, small})
+		if o, err := rm.Assign(test.task); err != nil || o != test.expected {
+			t.Errorf("%d: expected offer %s, got %v: %v", i, test.expected.GetId().GetValue(), o, err)
+		}
+	}
+}
+
+// Host ports are handed out of the offer's port ranges, without giving the same port to two tasks.
+func TestResourceManager_AssignPorts(t *testing.T) {
+	begin, end := uint64(31000), uint64(31002)
+	offer := createOffers(1)[0]
+	offer.Resources = append(offer.Resources, &mesos_v1.Resource{
+		Name:   utils.ProtoString("ports"),
+		Type:   mesos_v1.Value_RANGES.Enum(),
+		Ranges: &mesos_v1.Value_Ranges{Range: []*mesos_v1.Value_Range{{Begin: &begin, End: &end}}},
+	})
+
+	rm := NewResourceManager(nil)
+	rm.AddOffers([]*mesos_v1.Offer{offer})
+	tsk := &manager2.Task{
+		Info: &mesos_v1.TaskInfo{Name: utils.ProtoString("test"), Resources: createResources(1, 128)},
+		Filters: []task.Filter{placement.Placement{Ports: []ports.Port{
+			{Name: "http", Protocol: "tcp", Host: 31001},
+			{Protocol: "tcp"},
+		}}.Filter()},
+	}
+
+	a, err := rm.AssignIf(tsk, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(a.Ports) != 2 || a.Ports[0] != 31001 || a.Ports[1] != 31000 {
+		t.Fatalf("Expected ports 31001 and 31000, got %v", a.Ports)
+	}
+
+	// The fixed port is taken, so a second instance doesn't fit.
+	if _, err := rm.AssignIf(tsk, nil); err == nil {
+		t.Fatal("Expected the fixed port to already be taken")
+	}
+}
+
+// Offers are matched against attributes, a task's placement and deprecated filters are left out.
+func TestMatchesFilters(t *testing.T) {
+	offer := createOffers(1)[0]
+	offer.Attributes = []*mesos_v1.Attribute{{
+		Name: utils.ProtoString("disk"),
+		Type: mesos_v1.Value_TEXT.Enum(),
+		Text: &mesos_v1.Value_Text{Value: utils.ProtoString("ssd")},
+	}}
+
+	ssd := task.Filter{Type: "TEXT", Value: []string{"ssd"}}
+	if !MatchesFilters(offer, []task.Filter{ssd, placement.Placement{Priority: 1}.Filter()}) {
+		t.Fatal("Expected the offer to match, whatever the task's placement")
+	}
+	if !MatchesFilters(offer, []task.Filter{ssd, {Type: "STRATEGY", Value: []string{"spread"}}}) {
+		t.Fatal("Deprecated filters should be ignored")
+	}
+}
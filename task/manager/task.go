@@ -25,14 +25,34 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	// Root directory
 	TASK_DIRECTORY = "/tasks/"
+
+	// How task writes are batched unless we're told otherwise.
+	DEFAULT_BATCH_SIZE  = 128 // The most operations etcd allows in a transaction by default.
+	DEFAULT_BATCH_DELAY = 10 * time.Millisecond
 )
 
 type (
+	// Extends the SDK's task manager with operations that only affect what's held in memory.
+	TaskManager interface {
+		manager.TaskManager
+		Sync(...*manager.Task)
+
+		// Replaces or forgets a single task held in memory, without persisting anything.
+		// Used to mirror changes to storage one at a time.
+		SyncTask(*manager.Task)
+		SyncRemove(name string)
+
+		// Waits until every change made so far has been persisted.
+		// Changes are written in the background, so this must be called before telling anyone they're durable.
+		Flush() error
+	}
+
 	// Our primary task handler that implements the above interface.
 	// The task handler manages all tasks that are submitted, updated, or deleted.
 	// Offers from Mesos are matched up with user-submitted tasks, and those tasks are updated via event callbacks.
@@ -41,20 +61,37 @@ type (
 		tasks   map[string]*manager.Task
 		groups  map[string][]*mesos_v1.AgentID
 		storage persistence.Storage
+		writer  *persistence.Writer
 		retries structures.DistributedMap
 		logger  logging.Logger
 	}
 )
 
-// Returns the core task manager that's used by the scheduler.
+// Returns the core task manager that's used by the scheduler, batching writes the default way.
 func NewTaskManager(
 	cmap map[string]*manager.Task,
 	storage persistence.Storage,
-	logger logging.Logger) manager.TaskManager {
+	logger logging.Logger) TaskManager {
+
+	return NewBatchingTaskManager(
+		cmap,
+		storage,
+		persistence.NewWriter(storage, DEFAULT_BATCH_SIZE, DEFAULT_BATCH_DELAY, logger),
+		logger,
+	)
+}
+
+// Returns the core task manager, writing tasks through the given writer.
+func NewBatchingTaskManager(
+	cmap map[string]*manager.Task,
+	storage persistence.Storage,
+	writer *persistence.Writer,
+	logger logging.Logger) TaskManager {
 
 	handler := &TaskHandler{
 		tasks:   cmap,
 		storage: storage,
+		writer:  writer,
 		retries: structures.NewConcurrentMap(),
 		groups:  make(map[string][]*mesos_v1.AgentID),
 		logger:  logger,
@@ -65,10 +102,18 @@ func NewTaskManager(
 
 // Add and persists a new task into the task manager.
 // Duplicate task names are not allowed by Mesos, thus they are not allowed here.
+// Tasks are written before we return, instances of a group are written together.
 func (m *TaskHandler) Add(tasks ...*manager.Task) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	added := []*manager.Task{}
+	ops := []persistence.Op{}
+	names := make(map[string]bool) // Tasks we're adding, which aren't held in memory until they're written.
+	exists := func(name string) bool {
+		_, ok := m.tasks[name]
+		return ok || names[name]
+	}
 	for _, t := range tasks {
 		t.State = manager.UNKNOWN
 
@@ -77,21 +122,17 @@ func (m *TaskHandler) Add(tasks ...*manager.Task) error {
 
 		// If we have a single instance, only add it.
 		if t.Instances == 1 {
-			if _, ok := m.tasks[t.Info.GetName()]; ok {
+			if exists(t.Info.GetName()) {
 				return errors.New("Task " + t.Info.GetName() + " already exists")
 			}
-			// Write forward.
-			data, err := t.Encode()
+			data, err := EncodeRecord(t)
 			if err != nil {
 				return err
 			}
 
-			err = m.storageWrite(t, data)
-			if err != nil {
-				m.logger.Emit(logging.ERROR, "Storage error: %v", err)
-				return err
-			}
-			m.tasks[t.Info.GetName()] = t
+			names[t.Info.GetName()] = true
+			added = append(added, t)
+			ops = append(ops, persistence.Op{Key: storageKey(t), Value: string(data)})
 			continue
 		}
 
@@ -105,25 +146,31 @@ func (m *TaskHandler) Add(tasks ...*manager.Task) error {
 			duplicate.Info = &tmp
 			duplicate.Info.Name = utils.ProtoString(originalName + "-" + strconv.Itoa(i+1))
 			duplicate.Info.TaskId = &mesos_v1.TaskID{Value: utils.ProtoString(taskId + "-" + strconv.Itoa(i+1))}
-			if _, ok := m.tasks[duplicate.Info.GetName()]; ok {
+			if exists(duplicate.Info.GetName()) {
 				return errors.New("Task " + duplicate.Info.GetName() + " already exists")
 			}
 
-			// Write forward.
-			data, err := duplicate.Encode()
+			data, err := EncodeRecord(&duplicate)
 			if err != nil {
 				return err
 			}
 
-			err = m.storageWrite(&duplicate, data)
-			if err != nil {
-				m.logger.Emit(logging.ERROR, "Storage error: %v", err)
-				return err
-			}
-			m.tasks[duplicate.Info.GetName()] = &duplicate
+			names[duplicate.Info.GetName()] = true
+			added = append(added, &duplicate)
+			ops = append(ops, persistence.Op{Key: storageKey(&duplicate), Value: string(data)})
 		}
 	}
 
+	// Write forward, only keeping the tasks that made it into storage.
+	n, err := m.writer.Apply(ops...)
+	for _, t := range added[:n] {
+		m.tasks[t.Info.GetName()] = t
+	}
+	if err != nil {
+		m.logger.Emit(logging.ERROR, "Storage error: %v", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -131,19 +178,46 @@ func (m *TaskHandler) Restore(task *manager.Task) {
 	m.tasks[task.Info.GetName()] = task
 }
 
-// Delete a task from memory and etcd, and clears any associated policy.
+// Sync replaces every task held in memory with the ones given.
+// Nothing is persisted, this is used to mirror the state that's already in storage.
+func (m *TaskHandler) Sync(tasks ...*manager.Task) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name := range m.tasks {
+		delete(m.tasks, name)
+	}
+
+	for _, t := range tasks {
+		m.tasks[t.Info.GetName()] = t
+	}
+}
+
+// SyncTask replaces the task held in memory under the same name, or adds it.
+// Nothing is persisted, this is used to mirror a change that's already in storage.
+func (m *TaskHandler) SyncTask(task *manager.Task) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.tasks[task.Info.GetName()] = task
+}
+
+// SyncRemove forgets the task held in memory under the name, without deleting it from storage.
+func (m *TaskHandler) SyncRemove(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.tasks, name)
+}
+
+// Delete a task from memory and queues deleting it from storage.
 func (m *TaskHandler) Delete(tasks ...*manager.Task) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	for _, t := range tasks {
-		// Try to delete it from storage first.
-		if err := m.storageDelete(t); err != nil {
-			return err
-		}
-		// Then from in memory.
+		m.writer.Delete(storageKey(t))
 		delete(m.tasks, t.Info.GetName())
-
 	}
 	return nil
 }
@@ -212,17 +286,28 @@ func (m *TaskHandler) TotalTasks() int {
 }
 
 // Update the given task with the given state.
+// Writing it is queued, call Flush to wait for it.
+// A task given a new ID is stored under a new key, which is written right away along with deleting the old one.
 func (m *TaskHandler) Update(tasks ...*manager.Task) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	for _, task := range tasks {
-		data, err := task.Encode()
+		data, err := EncodeRecord(task)
 		if err != nil {
 			return err
 		}
-		if err := m.storageWrite(task, data); err != nil {
-			return err
+
+		key := storageKey(task)
+		if held, ok := m.tasks[task.Info.GetName()]; ok && storageKey(held) != key {
+			// Both in the same batch, so that the old record can't outlive the new one and bring the task back.
+			_, err := m.writer.Apply(persistence.Op{Key: key, Value: string(data)}, persistence.Op{Key: storageKey(held), Delete: true})
+			if err != nil {
+				m.logger.Emit(logging.ERROR, "Storage error: %v", err)
+				return err
+			}
+		} else {
+			m.writer.Put(key, string(data))
 		}
 
 		m.tasks[task.Info.GetName()] = task
@@ -231,6 +316,16 @@ func (m *TaskHandler) Update(tasks ...*manager.Task) error {
 	return nil
 }
 
+// Waits until every change made so far has been persisted.
+func (m *TaskHandler) Flush() error {
+	err := m.writer.Flush()
+	if err != nil {
+		m.logger.Emit(logging.ERROR, "Failed to write tasks to persistent storage: %s", err.Error())
+	}
+
+	return err
+}
+
 // AllByState gets all tasks that match the given state.
 func (m *TaskHandler) AllByState(state mesos_v1.TaskState) ([]*manager.Task, error) {
 	m.mutex.RLock()
@@ -268,39 +363,12 @@ func (m *TaskHandler) All() ([]*manager.Task, error) {
 	return allTasks, nil
 }
 
-// Function that wraps writing to the storage backend.
-func (m *TaskHandler) storageWrite(task *manager.Task, encoded []byte) error {
-	var writeKey string
-	var id string = task.Info.GetTaskId().GetValue()
-	var name string = task.Info.GetName()
+// Where the task is kept in storage.
+func storageKey(task *manager.Task) string {
+	id := task.Info.GetTaskId().GetValue()
 	if task.GroupInfo.InGroup {
-		writeKey = TASK_DIRECTORY + task.GroupInfo.GroupName + id
-	} else {
-		writeKey = TASK_DIRECTORY + id
-	}
-	err := m.storage.Update(writeKey, string(encoded))
-	if err != nil {
-		m.logger.Emit(
-			logging.ERROR, "Failed to update task %s with name %s to persistent data store. Retrying...",
-			id,
-			name,
-		)
+		return TASK_DIRECTORY + task.GroupInfo.GroupName + id
 	}
-	return err
-}
 
-// Function that wraps deleting from the storage backend.
-func (m *TaskHandler) storageDelete(task *manager.Task) error {
-	var del string
-	var id string = task.Info.GetTaskId().GetValue()
-	if task.GroupInfo.InGroup {
-		del = TASK_DIRECTORY + task.GroupInfo.GroupName + id
-	} else {
-		del = TASK_DIRECTORY + id
-	}
-	err := m.storage.Delete(del)
-	if err != nil {
-		m.logger.Emit(logging.ERROR, err.Error())
-	}
-	return err
+	return TASK_DIRECTORY + id
 }
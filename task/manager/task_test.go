@@ -19,9 +19,12 @@ import (
 	mockLogger "mesos-framework-sdk/logging/test"
 	"mesos-framework-sdk/task/manager"
 	"mesos-framework-sdk/utils"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
 	mockStorage "hydrogen/task/persistence/test"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func CreateTestTask(name string) *mesos_v1.TaskInfo {
@@ -191,6 +194,45 @@ func TestTaskManager_TotalTasks(t *testing.T) {
 	}
 }
 
+func TestTaskManager_Sync(t *testing.T) {
+	cmap := make(map[string]*manager.Task)
+	storage := mockStorage.MockStorage{}
+	logger := new(mockLogger.MockLogger)
+	taskManager := NewTaskManager(cmap, storage, logger)
+	testTask := &manager.Task{Info: CreateTestTask("testTask"), Instances: 1, State: manager.UNKNOWN}
+	testTask1 := &manager.Task{Info: CreateTestTask("testTask1"), Instances: 1, State: manager.UNKNOWN}
+	testTask2 := &manager.Task{Info: CreateTestTask("testTask2"), Instances: 1, State: manager.UNKNOWN}
+
+	taskManager.Add(testTask, testTask1)
+	taskManager.Sync(testTask2)
+
+	if taskManager.TotalTasks() != 1 || !taskManager.HasTask(testTask2.Info) {
+		t.Logf("Expecting only testTask2, got %v tasks", taskManager.TotalTasks())
+		t.FailNow()
+	}
+}
+
+func TestTaskManager_SyncTask(t *testing.T) {
+	cmap := make(map[string]*manager.Task)
+	storage := mockStorage.MockStorage{}
+	logger := new(mockLogger.MockLogger)
+	taskManager := NewTaskManager(cmap, storage, logger)
+	testTask := &manager.Task{Info: CreateTestTask("testTask"), Instances: 1, State: manager.UNKNOWN}
+	testTask1 := &manager.Task{Info: CreateTestTask("testTask1"), Instances: 1, State: manager.UNKNOWN}
+	taskManager.Add(testTask, testTask1)
+
+	running := &manager.Task{Info: CreateTestTask("testTask"), Instances: 1, State: manager.RUNNING}
+	taskManager.SyncTask(running)
+	taskManager.SyncRemove("testTask1")
+
+	if got, err := taskManager.Get(utils.ProtoString("testTask")); err != nil || got.State != manager.RUNNING {
+		t.Fatal("Expected the task to be replaced")
+	}
+	if taskManager.TotalTasks() != 1 {
+		t.Fatalf("Expected only the replaced task to be left, got %v tasks", taskManager.TotalTasks())
+	}
+}
+
 func TestTaskManager_AddSameTask(t *testing.T) {
 	cmap := make(map[string]*manager.Task)
 	storage := mockStorage.MockStorage{}
@@ -460,3 +502,63 @@ func BenchmarkTaskHandler_Update(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+// Takes as long as a round-trip to etcd for every write.
+type slowKVStore struct {
+	*memory.Memory
+}
+
+func (s slowKVStore) Update(key, value string) error {
+	time.Sleep(time.Millisecond)
+	return s.Memory.Update(key, value)
+}
+
+func (s slowKVStore) Batch(ops ...persistence.Op) error {
+	time.Sleep(time.Millisecond)
+	return s.Memory.Batch(ops...)
+}
+
+// Launches an offer cycle's worth of tasks, the way the offers handler does.
+// Compares waiting on every write against waiting once for all of them.
+func BenchmarkTaskHandler_Launch(b *testing.B) {
+	const launches = 100
+
+	for _, c := range []struct {
+		name  string
+		size  int
+		every int
+	}{
+		{"unbatched", 1, 1},
+		{"batched", DEFAULT_BATCH_SIZE, launches},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			storage := persistence.NewPersistence(slowKVStore{memory.New()}, 0, 0, 0)
+			logger := new(mockLogger.MockLogger)
+			writer := persistence.NewWriter(storage, c.size, time.Hour, logger)
+			taskManager := NewBatchingTaskManager(make(map[string]*manager.Task), storage, writer, logger)
+
+			tasks := make([]*manager.Task, launches)
+			for i := range tasks {
+				info := CreateTestTask("task" + strconv.Itoa(i))
+				info.TaskId.Value = info.Name
+				tasks[i] = &manager.Task{Info: info, Instances: 1}
+			}
+			if err := taskManager.Add(tasks...); err != nil {
+				b.Fatal(err.Error())
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j, t := range tasks {
+					t.State = manager.STAGING
+					taskManager.Update(t)
+					if (j+1)%c.every == 0 {
+						if err := taskManager.Flush(); err != nil {
+							b.Fatal(err.Error())
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -33,6 +33,16 @@ func (m MockTaskManager) Add(...*manager.Task) error {
 
 func (m MockTaskManager) Restore(*manager.Task) {}
 
+func (m MockTaskManager) Sync(...*manager.Task) {}
+
+func (m MockTaskManager) SyncTask(*manager.Task) {}
+
+func (m MockTaskManager) SyncRemove(string) {}
+
+func (m MockTaskManager) Flush() error {
+	return nil
+}
+
 func (m MockTaskManager) Delete(...*manager.Task) error {
 	return nil
 }
@@ -102,6 +112,16 @@ func (m MockBrokenTaskManager) Add(...*manager.Task) error {
 
 func (m MockBrokenTaskManager) Restore(*manager.Task) {}
 
+func (m MockBrokenTaskManager) Sync(...*manager.Task) {}
+
+func (m MockBrokenTaskManager) SyncTask(*manager.Task) {}
+
+func (m MockBrokenTaskManager) SyncRemove(string) {}
+
+func (m MockBrokenTaskManager) Flush() error {
+	return broken
+}
+
 func (m MockBrokenTaskManager) Delete(...*manager.Task) error {
 	return broken
 }
@@ -0,0 +1,34 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	taskManager "hydrogen/task/manager"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/resources/manager/test"
+	"mesos-framework-sdk/task/manager"
+)
+
+type MockResourceManager struct {
+	test.MockResourceManager
+}
+
+func (m MockResourceManager) AssignIf(*manager.Task, func(*mesos_v1.Offer) bool) (*taskManager.Assignment, error) {
+	return nil, nil
+}
+
+func (m MockResourceManager) RemoveOffer(*mesos_v1.OfferID) bool {
+	return false
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"encoding/json"
+	boltdb "github.com/boltdb/bolt"
+	"hydrogen/task/persistence/drivers/memory"
+	"strconv"
+	"time"
+)
+
+var (
+	recordsBucket = []byte("records")
+	leasesBucket  = []byte("leases")
+	metaBucket    = []byte("meta")
+	revisionKey   = []byte("revision")
+)
+
+// Bolt is a key-value store kept in a single file, meant for deployments with a single scheduler.
+// Everything is served from memory, and every change is written to the file before it's applied.
+type Bolt struct {
+	*memory.Memory
+	db *boltdb.DB
+}
+
+// Opens the store at the given path, creating it if needed.
+// The timeout is how long we wait for another process to let go of the file.
+func NewClient(path string, timeout time.Duration) (*Bolt, error) {
+	db, err := boltdb.Open(path, 0600, &boltdb.Options{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := load(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &Bolt{db: db}
+	b.Memory = memory.Restore(state, b)
+
+	return b, nil
+}
+
+// Writes the change to the file in a single transaction.
+func (b *Bolt) Commit(c *memory.Change) error {
+	return b.db.Update(func(tx *boltdb.Tx) error {
+		records, leases, meta, err := buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		for key, r := range c.Puts {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := records.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		for _, key := range c.Deletes {
+			if err := records.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for _, l := range c.Leases {
+			data, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			if err := leases.Put(leaseKey(l.ID), data); err != nil {
+				return err
+			}
+		}
+		for _, id := range c.Revoked {
+			if err := leases.Delete(leaseKey(id)); err != nil {
+				return err
+			}
+		}
+
+		return meta.Put(revisionKey, []byte(strconv.FormatInt(c.Revision, 10)))
+	})
+}
+
+// Stops serving the store and lets go of the file.
+func (b *Bolt) Close() error {
+	b.Memory.Close()
+	return b.db.Close()
+}
+
+// Reads everything the file holds.
+func load(db *boltdb.DB) (*memory.State, error) {
+	state := &memory.State{
+		Records: make(map[string]*memory.Record),
+		Leases:  make(map[int64]*memory.Lease),
+	}
+
+	err := db.Update(func(tx *boltdb.Tx) error {
+		records, leases, meta, err := buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		if data := meta.Get(revisionKey); data != nil {
+			state.Revision, err = strconv.ParseInt(string(data), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = records.ForEach(func(k, v []byte) error {
+			r := new(memory.Record)
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			state.Records[string(k)] = r
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return leases.ForEach(func(k, v []byte) error {
+			l := new(memory.Lease)
+			if err := json.Unmarshal(v, l); err != nil {
+				return err
+			}
+			state.Leases[l.ID] = l
+
+			return nil
+		})
+	})
+
+	return state, err
+}
+
+// Gets our buckets, creating them if this is a new file.
+func buckets(tx *boltdb.Tx) (records, leases, meta *boltdb.Bucket, err error) {
+	if records, err = tx.CreateBucketIfNotExists(recordsBucket); err != nil {
+		return
+	}
+	if leases, err = tx.CreateBucketIfNotExists(leasesBucket); err != nil {
+		return
+	}
+	meta, err = tx.CreateBucketIfNotExists(metaBucket)
+
+	return
+}
+
+func leaseKey(id int64) []byte {
+	return []byte(strconv.FormatInt(id, 10))
+}
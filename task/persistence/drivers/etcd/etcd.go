@@ -0,0 +1,371 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"hydrogen/task/persistence"
+	"sync"
+	"time"
+)
+
+// Etcd is a key-value store backed by an etcd v3 cluster.
+type Etcd struct {
+	client        *clientv3.Client
+	timeout       time.Duration
+	mutex         sync.RWMutex
+	fenceKey      string
+	fenceRevision int64
+}
+
+// Returns a new etcd client connected to the given endpoints.
+// The timeout applies to every operation, the keepalive settings apply to the connection.
+func NewClient(endpoints []string, timeout, kaTime, kaTimeout time.Duration) (*Etcd, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:            endpoints,
+		DialTimeout:          timeout,
+		DialKeepAliveTime:    kaTime,
+		DialKeepAliveTimeout: kaTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Etcd{client: client, timeout: timeout}, nil
+}
+
+// Creates the key if it doesn't already exist.
+// Creating a key that exists is not an error, it's simply left alone.
+func (e *Etcd) Create(key, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	cmps := append(e.guards(), clientv3.Compare(clientv3.CreateRevision(key), "=", 0))
+	resp, err := e.client.Txn(ctx).If(cmps...).Then(clientv3.OpPut(key, value)).Commit()
+	if err != nil {
+		return classify(err)
+	}
+
+	// Either the key exists or the fence failed, only the latter is an error.
+	if !resp.Succeeded {
+		return e.checkFence(ctx)
+	}
+
+	return nil
+}
+
+// Writes the key under a new lease with the given TTL in seconds.
+// The key is deleted once the lease expires, unless it's refreshed.
+func (e *Etcd) CreateWithLease(key, value string, ttl int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	lease, err := e.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	if err := e.write(ctx, clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))); err != nil {
+		e.client.Revoke(ctx, lease.ID)
+		return 0, classify(err)
+	}
+
+	return int64(lease.ID), nil
+}
+
+// Like CreateWithLease, except nothing is written if the key already exists.
+// The lease is revoked if it isn't needed.
+// This isn't fenced, it's how a new fence is established in the first place.
+func (e *Etcd) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	lease, err := e.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, 0, classify(err)
+	}
+
+	resp, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		e.client.Revoke(ctx, lease.ID)
+		return 0, 0, classify(err)
+	}
+
+	return int64(lease.ID), resp.Header.Revision, nil
+}
+
+// Reads the value of the key.
+// Keys that don't exist have an empty value.
+func (e *Etcd) Read(key string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, key)
+	if err != nil {
+		return "", classify(err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Reads every key under the given prefix.
+func (e *Etcd) ReadAll(key string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, key, clientv3.WithPrefix())
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	values := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+
+	return values, nil
+}
+
+// Reads every key under the prefix, along with the revision of the store they were read at.
+func (e *Etcd) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, key, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, classify(err)
+	}
+
+	values := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+
+	return values, resp.Header.Revision, nil
+}
+
+// Writes the key, creating it if needed.
+func (e *Etcd) Update(key, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	return e.write(ctx, clientv3.OpPut(key, value))
+}
+
+// Applies every operation in a single transaction.
+// etcd limits how many operations a transaction can hold, 128 by default.
+func (e *Etcd) Batch(ops ...persistence.Op) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	txn := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		if op.Delete {
+			txn = append(txn, clientv3.OpDelete(op.Key))
+		} else {
+			txn = append(txn, clientv3.OpPut(op.Key, op.Value))
+		}
+	}
+
+	return e.write(ctx, txn...)
+}
+
+// Resets the countdown of the lease back to its TTL.
+func (e *Etcd) RefreshLease(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	_, err := e.client.KeepAliveOnce(ctx, clientv3.LeaseID(id))
+
+	return classify(err)
+}
+
+// Revokes the lease, deleting every key attached to it.
+func (e *Etcd) RevokeLease(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	_, err := e.client.Revoke(ctx, clientv3.LeaseID(id))
+
+	return classify(err)
+}
+
+// Deletes the key.
+func (e *Etcd) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	return e.write(ctx, clientv3.OpDelete(key))
+}
+
+// Streams changes to the key, or to every key under it if prefix is set.
+func (e *Etcd) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	opts := []clientv3.OpOption{clientv3.WithProgressNotify()}
+	if prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision+1))
+	}
+
+	events := make(chan persistence.Event)
+	go func() {
+		defer close(events)
+
+		for resp := range e.client.Watch(ctx, key, opts...) {
+			if resp.Err() != nil {
+				return
+			}
+
+			for _, ev := range resp.Events {
+				event := persistence.Event{
+					Type:     persistence.Put,
+					Key:      string(ev.Kv.Key),
+					Value:    string(ev.Kv.Value),
+					Revision: ev.Kv.ModRevision,
+				}
+				if ev.Type == mvccpb.DELETE {
+					event.Type = persistence.Delete
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			// Responses are only sent once everything up to the revision in their header has been.
+			select {
+			case events <- persistence.Event{Type: persistence.Progress, Revision: resp.Header.Revision}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// Counts the keys under the prefix, and how many of them were last written after the given revision.
+// The second count is read at the revision of the first, so that they agree.
+func (e *Etcd) Count(prefix string, since int64) (int64, int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	all, err := e.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, 0, 0, classify(err)
+	}
+
+	revision := all.Header.Revision
+	changed, err := e.client.Get(
+		ctx,
+		prefix,
+		clientv3.WithPrefix(),
+		clientv3.WithCountOnly(),
+		clientv3.WithRev(revision),
+		clientv3.WithMinModRev(since+1),
+	)
+	if err != nil {
+		return 0, 0, 0, classify(err)
+	}
+
+	return all.Count, changed.Count, revision, nil
+}
+
+// Makes every following write conditional on the key still having been created at the given revision.
+func (e *Etcd) Fence(key string, revision int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.fenceKey = key
+	e.fenceRevision = revision
+}
+
+// Comparisons that have to hold for a write to go through.
+func (e *Etcd) guards() []clientv3.Cmp {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.fenceKey == "" {
+		return nil
+	}
+
+	return []clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(e.fenceKey), "=", e.fenceRevision)}
+}
+
+// Runs the operations in a transaction that only commits while the fence holds.
+func (e *Etcd) write(ctx context.Context, ops ...clientv3.Op) error {
+	resp, err := e.client.Txn(ctx).If(e.guards()...).Then(ops...).Commit()
+	if err != nil {
+		return classify(err)
+	}
+
+	if !resp.Succeeded {
+		return persistence.ErrFenced
+	}
+
+	return nil
+}
+
+// Tells us if the fence still holds.
+func (e *Etcd) checkFence(ctx context.Context) error {
+	e.mutex.RLock()
+	key, revision := e.fenceKey, e.fenceRevision
+	e.mutex.RUnlock()
+
+	if key == "" {
+		return nil
+	}
+
+	resp, err := e.client.Get(ctx, key)
+	if err != nil {
+		return classify(err)
+	}
+
+	if len(resp.Kvs) == 0 || resp.Kvs[0].CreateRevision != revision {
+		return persistence.ErrFenced
+	}
+
+	return nil
+}
+
+// Marks errors that retrying won't fix as fatal, everything else is worth another try.
+func classify(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch s.Code() {
+	case codes.InvalidArgument, codes.NotFound, codes.PermissionDenied, codes.Unauthenticated,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented:
+		return persistence.FatalError{Err: err}
+	}
+
+	return err
+}
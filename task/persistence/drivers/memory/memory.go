@@ -0,0 +1,537 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"hydrogen/task/persistence"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	historySize = 1000 // Changes kept around for watches that start in the past.
+	watchBuffer = 1000 // Events a watcher can fall behind by before its watch fails.
+)
+
+var (
+	// Retrying won't bring a lease back.
+	ErrLeaseNotFound error = persistence.FatalError{Err: errors.New("Lease not found")}
+
+	// Like etcd, a batch can't touch the same key twice.
+	ErrDuplicateKey error = persistence.FatalError{Err: errors.New("Duplicate key in batch")}
+)
+
+type (
+	// A stored value along with the metadata needed to behave like etcd.
+	Record struct {
+		Value          string `json:"value"`
+		CreateRevision int64  `json:"create_revision"`
+		ModRevision    int64  `json:"mod_revision"`
+		Lease          int64  `json:"lease,omitempty"`
+	}
+
+	// Keys attached to a lease are deleted once it expires.
+	Lease struct {
+		ID      int64     `json:"id"`
+		TTL     int64     `json:"ttl"` // Seconds.
+		Expires time.Time `json:"expires"`
+	}
+
+	// Everything a store holds, used to restore one after a restart.
+	State struct {
+		Revision int64
+		Records  map[string]*Record
+		Leases   map[int64]*Lease
+	}
+
+	// A single atomic change to the store.
+	Change struct {
+		Revision int64
+		Puts     map[string]*Record
+		Deletes  []string
+		Leases   []*Lease // Granted or refreshed.
+		Revoked  []int64
+	}
+
+	// Journal is handed every change before it's applied, so that the store can be kept somewhere durable.
+	// A change the journal rejects is never applied.
+	Journal interface {
+		Commit(c *Change) error
+	}
+
+	// Memory is a key-value store that keeps everything in memory.
+	// It has the same semantics as our etcd driver, including revisions, leases, fences and watches.
+	Memory struct {
+		mutex         sync.Mutex
+		journal       Journal
+		revision      int64
+		records       map[string]*Record
+		leases        map[int64]*Lease
+		timers        map[int64]*time.Timer
+		lastLease     int64
+		history       []persistence.Event
+		watchers      map[*watcher]struct{}
+		fenceKey      string
+		fenceRevision int64
+	}
+
+	watcher struct {
+		key    string
+		prefix bool
+		events chan persistence.Event
+	}
+)
+
+// Returns an empty store.
+func New() *Memory {
+	return Restore(&State{}, nil)
+}
+
+// Returns a store holding the given state, which hands every change to the journal.
+// Leases that expired in the meantime are revoked right away.
+func Restore(s *State, j Journal) *Memory {
+	m := &Memory{
+		journal:  j,
+		revision: s.Revision,
+		records:  s.Records,
+		leases:   s.Leases,
+		timers:   make(map[int64]*time.Timer),
+		watchers: make(map[*watcher]struct{}),
+	}
+	if m.records == nil {
+		m.records = make(map[string]*Record)
+	}
+	if m.leases == nil {
+		m.leases = make(map[int64]*Lease)
+	}
+
+	for id, lease := range m.leases {
+		if id > m.lastLease {
+			m.lastLease = id
+		}
+		m.arm(lease)
+	}
+
+	return m
+}
+
+// Creates the key if it doesn't already exist.
+// Creating a key that exists is not an error, it's simply left alone.
+func (m *Memory) Create(key, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.fenced() {
+		return persistence.ErrFenced
+	}
+
+	if _, ok := m.records[key]; ok {
+		return nil
+	}
+
+	return m.commit(m.put(key, value, 0))
+}
+
+// Writes the key under a new lease with the given TTL in seconds.
+// The key is deleted once the lease expires, unless it's refreshed.
+func (m *Memory) CreateWithLease(key, value string, ttl int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.fenced() {
+		return 0, persistence.ErrFenced
+	}
+
+	lease := m.grant(ttl)
+	c := m.put(key, value, lease.ID)
+	c.Leases = []*Lease{lease}
+	if err := m.commit(c); err != nil {
+		return 0, err
+	}
+
+	return lease.ID, nil
+}
+
+// Like CreateWithLease, except nothing is written if the key already exists.
+// This isn't fenced, it's how a new fence is established in the first place.
+func (m *Memory) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.records[key]; ok {
+		return 0, 0, nil
+	}
+
+	lease := m.grant(ttl)
+	c := m.put(key, value, lease.ID)
+	c.Leases = []*Lease{lease}
+	if err := m.commit(c); err != nil {
+		return 0, 0, err
+	}
+
+	return lease.ID, c.Revision, nil
+}
+
+// Reads the value of the key.
+// Keys that don't exist have an empty value.
+func (m *Memory) Read(key string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if r, ok := m.records[key]; ok {
+		return r.Value, nil
+	}
+
+	return "", nil
+}
+
+// Reads every key under the given prefix.
+func (m *Memory) ReadAll(key string) (map[string]string, error) {
+	values, _, err := m.ReadAllWithRevision(key)
+	return values, err
+}
+
+// Reads every key under the prefix, along with the revision of the store they were read at.
+func (m *Memory) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	values := make(map[string]string)
+	for k, r := range m.records {
+		if strings.HasPrefix(k, key) {
+			values[k] = r.Value
+		}
+	}
+
+	return values, m.revision, nil
+}
+
+// Writes the key, creating it if needed.
+// Like etcd, this detaches the key from any lease it was created with.
+func (m *Memory) Update(key, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.fenced() {
+		return persistence.ErrFenced
+	}
+
+	return m.commit(m.put(key, value, 0))
+}
+
+// Resets the countdown of the lease back to its TTL.
+func (m *Memory) RefreshLease(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	lease, ok := m.leases[id]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+
+	refreshed := *lease
+	refreshed.Expires = time.Now().Add(time.Duration(lease.TTL) * time.Second)
+
+	return m.commit(&Change{Revision: m.revision, Leases: []*Lease{&refreshed}})
+}
+
+// Revokes the lease, deleting every key attached to it.
+func (m *Memory) RevokeLease(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+
+	return m.revoke(id)
+}
+
+// Deletes the key.
+func (m *Memory) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.fenced() {
+		return persistence.ErrFenced
+	}
+
+	if _, ok := m.records[key]; !ok {
+		return nil
+	}
+
+	return m.commit(&Change{Revision: m.revision + 1, Deletes: []string{key}})
+}
+
+// Applies every operation at a single revision.
+func (m *Memory) Batch(ops ...persistence.Op) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.fenced() {
+		return persistence.ErrFenced
+	}
+
+	c := &Change{Revision: m.revision + 1, Puts: make(map[string]*Record)}
+	seen := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		if seen[op.Key] {
+			return ErrDuplicateKey
+		}
+		seen[op.Key] = true
+
+		if !op.Delete {
+			c.Puts[op.Key] = m.put(op.Key, op.Value, 0).Puts[op.Key]
+		} else if _, ok := m.records[op.Key]; ok {
+			c.Deletes = append(c.Deletes, op.Key)
+		}
+	}
+
+	if len(c.Puts) == 0 && len(c.Deletes) == 0 {
+		return nil
+	}
+
+	return m.commit(c)
+}
+
+// Makes every following write conditional on the key still having been created at the given revision.
+func (m *Memory) Fence(key string, revision int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.fenceKey = key
+	m.fenceRevision = revision
+}
+
+// Streams changes to the key, or to every key under it if prefix is set.
+// Only changes made after the given revision are sent, 0 means changes from now on.
+// Starting further back than we keep history for fails the watch right away, just like a compacted revision in etcd.
+func (m *Memory) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	w := &watcher{key: key, prefix: prefix, events: make(chan persistence.Event, watchBuffer)}
+	if revision > 0 && revision < m.revision {
+		if len(m.history) == 0 || m.history[0].Revision > revision+1 {
+			close(w.events)
+			return w.events
+		}
+
+		for _, event := range m.history {
+			if event.Revision > revision && w.matches(event.Key) {
+				w.events <- event
+			}
+		}
+	}
+
+	m.watchers[w] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		m.unwatch(w)
+	}()
+
+	return w.events
+}
+
+// Counts the keys under the prefix, and how many of them were last written after the given revision.
+func (m *Memory) Count(prefix string, since int64) (int64, int64, int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var all, changed int64
+	for key, r := range m.records {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		all++
+		if r.ModRevision > since {
+			changed++
+		}
+	}
+
+	return all, changed, m.revision, nil
+}
+
+// Stops every lease from expiring, and ends every watch.
+func (m *Memory) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, timer := range m.timers {
+		timer.Stop()
+		delete(m.timers, id)
+	}
+	for w := range m.watchers {
+		m.unwatch(w)
+	}
+
+	return nil
+}
+
+// Tells us if the fence still holds, the caller must hold the lock.
+func (m *Memory) fenced() bool {
+	if m.fenceKey == "" {
+		return true
+	}
+
+	r, ok := m.records[m.fenceKey]
+	return ok && r.CreateRevision == m.fenceRevision
+}
+
+// Describes writing the key at the next revision.
+func (m *Memory) put(key, value string, lease int64) *Change {
+	revision := m.revision + 1
+	record := &Record{Value: value, CreateRevision: revision, ModRevision: revision, Lease: lease}
+	if old, ok := m.records[key]; ok {
+		record.CreateRevision = old.CreateRevision
+	}
+
+	return &Change{Revision: revision, Puts: map[string]*Record{key: record}}
+}
+
+// Creates a lease that hasn't been committed yet.
+// IDs are based on the time, so they aren't reused after a restart.
+func (m *Memory) grant(ttl int64) *Lease {
+	id := time.Now().UnixNano()
+	if id <= m.lastLease {
+		id = m.lastLease + 1
+	}
+	m.lastLease = id
+
+	return &Lease{ID: id, TTL: ttl, Expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+}
+
+// Deletes the lease and every key attached to it, the caller must hold the lock.
+func (m *Memory) revoke(id int64) error {
+	c := &Change{Revision: m.revision, Revoked: []int64{id}}
+	for key, r := range m.records {
+		if r.Lease == id {
+			c.Deletes = append(c.Deletes, key)
+		}
+	}
+	if len(c.Deletes) > 0 {
+		sort.Strings(c.Deletes)
+		c.Revision++
+	}
+
+	return m.commit(c)
+}
+
+// Journals the change, then applies it and tells every watch about it.
+func (m *Memory) commit(c *Change) error {
+	if m.journal != nil {
+		if err := m.journal.Commit(c); err != nil {
+			return err
+		}
+	}
+
+	events := []persistence.Event{}
+	for key, r := range c.Puts {
+		m.records[key] = r
+		events = append(events, persistence.Event{Type: persistence.Put, Key: key, Value: r.Value, Revision: c.Revision})
+	}
+	for _, key := range c.Deletes {
+		delete(m.records, key)
+		events = append(events, persistence.Event{Type: persistence.Delete, Key: key, Revision: c.Revision})
+	}
+	for _, lease := range c.Leases {
+		m.leases[lease.ID] = lease
+		m.arm(lease)
+	}
+	for _, id := range c.Revoked {
+		delete(m.leases, id)
+		if timer, ok := m.timers[id]; ok {
+			timer.Stop()
+			delete(m.timers, id)
+		}
+	}
+	m.revision = c.Revision
+
+	for _, event := range events {
+		m.history = append(m.history, event)
+		for w := range m.watchers {
+			if w.matches(event.Key) {
+				m.send(w, event)
+			}
+		}
+	}
+	if len(m.history) > historySize {
+		m.history = m.history[len(m.history)-historySize:]
+	}
+	if len(events) > 0 {
+		m.progress()
+	}
+
+	return nil
+}
+
+// Revokes the lease once it expires, the caller must hold the lock.
+func (m *Memory) arm(lease *Lease) {
+	if timer, ok := m.timers[lease.ID]; ok {
+		timer.Stop()
+	}
+
+	id := lease.ID
+	m.timers[id] = time.AfterFunc(time.Until(lease.Expires), func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		// The lease may have been refreshed or revoked while we were waiting on the lock.
+		if l, ok := m.leases[id]; ok && !time.Now().Before(l.Expires) {
+			m.revoke(id)
+		}
+	})
+}
+
+// Sends every watch a Progress event for the current revision, the caller must hold the lock.
+func (m *Memory) progress() {
+	for w := range m.watchers {
+		m.send(w, persistence.Event{Type: persistence.Progress, Revision: m.revision})
+	}
+}
+
+// Sends the event without blocking, a watch that has fallen too far behind fails instead.
+func (m *Memory) send(w *watcher, event persistence.Event) {
+	select {
+	case w.events <- event:
+	default:
+		m.unwatch(w)
+	}
+}
+
+// Ends the watch, the caller must hold the lock.
+func (m *Memory) unwatch(w *watcher) {
+	if _, ok := m.watchers[w]; !ok {
+		return
+	}
+
+	delete(m.watchers, w)
+	close(w.events)
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+
+	return key == w.key
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"hydrogen/task/persistence"
+	"testing"
+	"time"
+)
+
+// Makes sure we implement the same interface as our other drivers.
+var _ persistence.KeyValueStore = New()
+
+// Rejects every change.
+type brokenJournal struct{}
+
+func (b brokenJournal) Commit(c *Change) error {
+	return errors.New("Broken")
+}
+
+// Basic reads and writes.
+func TestMemory_CRUD(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	if err := m.Create("/a", "1"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Create("/a", "2"); err != nil {
+		t.Fatal("Creating a key that exists shouldn't fail")
+	}
+	if v, _ := m.Read("/a"); v != "1" {
+		t.Fatalf("Creating a key that exists shouldn't change it, got %s", v)
+	}
+
+	m.Update("/a", "3")
+	m.Update("/b", "4")
+	m.Update("/other", "5")
+	values, revision, err := m.ReadAllWithRevision("/")
+	if err != nil || len(values) != 3 || revision != 4 {
+		t.Fatalf("Expected 3 keys at revision 4, got %v at %d: %v", values, revision, err)
+	}
+
+	m.Delete("/a")
+	if v, _ := m.Read("/a"); v != "" {
+		t.Fatalf("Deleted keys should be empty, got %s", v)
+	}
+
+	broken := Restore(&State{}, brokenJournal{})
+	if err := broken.Update("/a", "1"); err == nil {
+		t.Fatal("Changes the journal rejects should fail")
+	}
+	if v, _ := broken.Read("/a"); v != "" {
+		t.Fatal("Changes the journal rejects shouldn't be applied")
+	}
+}
+
+// Keys go away with their lease.
+func TestMemory_Leases(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	lease, epoch, err := m.CreateIfAbsent("/leader", "1", 1)
+	if err != nil || lease == 0 || epoch != 1 {
+		t.Fatalf("Expected to create the key, got lease %d at %d: %v", lease, epoch, err)
+	}
+	if other, _, _ := m.CreateIfAbsent("/leader", "2", 1); other != 0 {
+		t.Fatal("Keys that exist shouldn't be created again")
+	}
+
+	if err := m.RevokeLease(lease); err != nil {
+		t.Fatal(err.Error())
+	}
+	if v, _ := m.Read("/leader"); v != "" {
+		t.Fatal("Revoking a lease should delete its keys")
+	}
+	if err := m.RefreshLease(lease); err != ErrLeaseNotFound {
+		t.Fatal("Revoked leases can't be refreshed")
+	}
+
+	m.CreateWithLease("/framework", "id", 0)
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := m.Read("/framework"); v != "" {
+		t.Fatal("Expired leases should delete their keys")
+	}
+}
+
+// Writes only go through while the fence holds.
+func TestMemory_Fence(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	lease, epoch, _ := m.CreateIfAbsent("/leader", "1", 10)
+	m.Fence("/leader", epoch)
+	if err := m.Update("/a", "1"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m.RevokeLease(lease)
+	m.CreateIfAbsent("/leader", "2", 10)
+	if err := m.Update("/a", "2"); err != persistence.ErrFenced {
+		t.Fatalf("Expected the write to be fenced, got %v", err)
+	}
+	if _, err := m.CreateWithLease("/b", "1", 10); err != persistence.ErrFenced {
+		t.Fatalf("Expected the write to be fenced, got %v", err)
+	}
+	if err := m.Delete("/a"); err != persistence.ErrFenced {
+		t.Fatalf("Expected the delete to be fenced, got %v", err)
+	}
+	if err := m.Batch(persistence.Op{Key: "/c", Value: "1"}); err != persistence.ErrFenced {
+		t.Fatalf("Expected the batch to be fenced, got %v", err)
+	}
+}
+
+// Batches are applied at a single revision.
+func TestMemory_Batch(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	m.Update("/a", "1")
+	err := m.Batch(
+		persistence.Op{Key: "/a", Delete: true},
+		persistence.Op{Key: "/b", Value: "2"},
+		persistence.Op{Key: "/c", Value: "3"},
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	values, revision, _ := m.ReadAllWithRevision("/")
+	if len(values) != 2 || values["/b"] != "2" || revision != 2 {
+		t.Fatalf("Expected /b and /c at revision 2, got %v at %d", values, revision)
+	}
+
+	if err := m.Batch(persistence.Op{Key: "/b"}, persistence.Op{Key: "/b", Delete: true}); err != ErrDuplicateKey {
+		t.Fatalf("Expected a batch touching a key twice to fail, got %v", err)
+	}
+}
+
+// Watches see changes made after their revision, and progress.
+func TestMemory_Watch(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	m.Update("/tasks/a", "1")
+	m.Update("/other", "1")
+	m.Update("/tasks/b", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := m.Watch(ctx, "/tasks/", true, 1)
+	if e := <-events; e.Key != "/tasks/b" || e.Revision != 3 {
+		t.Fatalf("Expected the change we missed, got %+v", e)
+	}
+
+	m.Delete("/tasks/a")
+	if e := <-events; e.Type != persistence.Delete || e.Key != "/tasks/a" {
+		t.Fatalf("Expected a delete, got %+v", e)
+	}
+	if e := <-events; e.Type != persistence.Progress || e.Revision != 4 {
+		t.Fatalf("Expected progress, got %+v", e)
+	}
+
+	if all, changed, revision, _ := m.Count("/tasks/", 2); all != 1 || changed != 1 || revision != 4 {
+		t.Fatalf("Expected 1 task, written since revision 2 at revision 4, got %d, %d at %d", all, changed, revision)
+	}
+
+	cancel()
+	for range events {
+	}
+
+	m = Restore(&State{Revision: 10}, nil)
+	if _, ok := <-m.Watch(context.Background(), "/tasks/", true, 5); ok {
+		t.Fatal("Watches can't start before the history we keep")
+	}
+}
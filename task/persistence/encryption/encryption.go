@@ -0,0 +1,309 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"hydrogen/task/persistence"
+	"io"
+	"strings"
+)
+
+// Encrypted values start with this, followed by the key ID and the sealed value.
+const marker = "hydrogen:aes-gcm:"
+
+var CorruptError = errors.New("Encrypted value is corrupt or was tampered with")
+
+// Returned for values encrypted with a key we weren't given, or read without any keys at all.
+// That's a mistake in how we're configured rather than a value that's gone bad, so reads fail outright.
+type UnknownKeyError struct {
+	ID string
+}
+
+func (u *UnknownKeyError) Error() string {
+	return "Value was encrypted with key " + u.ID + ", which we weren't given"
+}
+
+// Encrypted is a key-value store that encrypts values under some prefixes before they're stored,
+// and decrypts them again when they're read.
+// Each value is bound to its key, so a value copied to another key won't decrypt.
+// Values that were stored before encryption was turned on are read as they are.
+// Without a keyring values are stored as they are, and encrypted ones fail to read instead of being taken as they're stored.
+type Encrypted struct {
+	persistence.KeyValueStore
+	keyring  *Keyring
+	prefixes []string
+}
+
+// Wraps the store so that values under the given prefixes are encrypted with the keyring, which can be nil.
+func New(kv persistence.KeyValueStore, k *Keyring, prefixes ...string) *Encrypted {
+	return &Encrypted{KeyValueStore: kv, keyring: k, prefixes: prefixes}
+}
+
+func (e *Encrypted) Create(key, value string) error {
+	sealed, err := e.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return e.KeyValueStore.Create(key, sealed)
+}
+
+func (e *Encrypted) CreateWithLease(key, value string, ttl int64) (int64, error) {
+	sealed, err := e.seal(key, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.KeyValueStore.CreateWithLease(key, sealed, ttl)
+}
+
+func (e *Encrypted) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	sealed, err := e.seal(key, value)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return e.KeyValueStore.CreateIfAbsent(key, sealed, ttl)
+}
+
+func (e *Encrypted) Update(key, value string) error {
+	sealed, err := e.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return e.KeyValueStore.Update(key, sealed)
+}
+
+func (e *Encrypted) Batch(ops ...persistence.Op) error {
+	sealed := make([]persistence.Op, len(ops))
+	for i, op := range ops {
+		sealed[i] = op
+		if op.Delete {
+			continue
+		}
+
+		var err error
+		if sealed[i].Value, err = e.seal(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+
+	return e.KeyValueStore.Batch(sealed...)
+}
+
+func (e *Encrypted) Read(key string) (string, error) {
+	value, err := e.KeyValueStore.Read(key)
+	if err != nil {
+		return "", err
+	}
+
+	return e.open(key, value)
+}
+
+func (e *Encrypted) ReadAll(key string) (map[string]string, error) {
+	values, _, err := e.ReadAllWithRevision(key)
+	return values, err
+}
+
+func (e *Encrypted) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	values, revision, err := e.KeyValueStore.ReadAllWithRevision(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Each value is decrypted on its own, so that a corrupt one doesn't keep the others from being read.
+	// Missing a key fails the whole read, it means every value encrypted with it is out of reach.
+	var unreadable *persistence.UnreadableError
+	for k, stored := range values {
+		value, err := e.open(k, stored)
+		if err == nil {
+			values[k] = value
+			continue
+		}
+		if _, ok := err.(*UnknownKeyError); ok {
+			return nil, 0, errors.New(k + ": " + err.Error())
+		}
+
+		if unreadable == nil {
+			unreadable = &persistence.UnreadableError{Stored: make(map[string]string), Errors: make(map[string]error)}
+		}
+		unreadable.Stored[k] = stored
+		unreadable.Errors[k] = err
+		delete(values, k)
+	}
+	if unreadable != nil {
+		return values, revision, unreadable
+	}
+
+	return values, revision, nil
+}
+
+// Decrypts the values of every change.
+// Corrupt changes are still sent as they're stored, with the reason they can't be read.
+// A change encrypted with a key we don't have ends the watch, like any other failure.
+func (e *Encrypted) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Start watching before we return, so that callers can rely on not missing changes made afterwards.
+	changes := e.KeyValueStore.Watch(ctx, key, prefix, revision)
+	events := make(chan persistence.Event)
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		for event := range changes {
+			if event.Type == persistence.Put {
+				value, err := e.open(event.Key, event.Value)
+				if _, ok := err.(*UnknownKeyError); ok {
+					return
+				}
+				if err != nil {
+					event.Err = err
+				} else {
+					event.Value = value
+				}
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// Reencrypt writes every value under our prefixes again with the active key.
+// Values that are already encrypted with it are left alone.
+// Every value is decrypted before any is written, if some can't be they fail with an UnreadableError and nothing is written.
+// Returns how many values were written.
+func (e *Encrypted) Reencrypt() (int, error) {
+	pending := make(map[string]string)
+	var unreadable *persistence.UnreadableError
+	for _, prefix := range e.prefixes {
+		values, err := e.KeyValueStore.ReadAll(prefix)
+		if err != nil {
+			return 0, err
+		}
+
+		for key, stored := range values {
+			if id, _, ok := parse(stored); ok && id == e.keyring.active {
+				continue
+			}
+
+			value, err := e.open(key, stored)
+			if err != nil {
+				if unreadable == nil {
+					unreadable = &persistence.UnreadableError{Stored: make(map[string]string), Errors: make(map[string]error)}
+				}
+				unreadable.Stored[key] = stored
+				unreadable.Errors[key] = err
+				continue
+			}
+			pending[key] = value
+		}
+	}
+	if unreadable != nil {
+		return 0, unreadable
+	}
+
+	written := 0
+	for key, value := range pending {
+		if err := e.Update(key, value); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, nil
+}
+
+// Tells us if values stored under the key are encrypted.
+func (e *Encrypted) encrypts(key string) bool {
+	for _, prefix := range e.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encrypts the value with the active key, if it belongs under one of our prefixes and we have one.
+func (e *Encrypted) seal(key, value string) (string, error) {
+	if !e.encrypts(key) || e.keyring == nil {
+		return value, nil
+	}
+
+	aead := e.keyring.keys[e.keyring.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(key))
+
+	return marker + e.keyring.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypts the value if it was encrypted, anything else is returned as it is.
+func (e *Encrypted) open(key, value string) (string, error) {
+	id, sealed, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	if e.keyring == nil {
+		return "", &UnknownKeyError{ID: id}
+	}
+	aead, ok := e.keyring.keys[id]
+	if !ok {
+		return "", &UnknownKeyError{ID: id}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", CorruptError
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", CorruptError
+	}
+
+	return string(plaintext), nil
+}
+
+// Splits an encrypted value into the ID of its key and the sealed value.
+func parse(value string) (string, string, bool) {
+	if !strings.HasPrefix(value, marker) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, marker), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,222 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"context"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	"strings"
+	"testing"
+)
+
+const (
+	oldKey = "old=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	newKey = "new=ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func keyring(t *testing.T, keys string) *Keyring {
+	k, err := ParseKeys(keys)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return k
+}
+
+// Values under our prefixes are stored encrypted and read back decrypted.
+func TestEncrypted_RoundTrip(t *testing.T) {
+	kv := memory.New()
+	e := New(kv, keyring(t, oldKey), "/tasks/")
+
+	e.Update("/tasks/a", "secret")
+	e.Update("/frameworkId", "id")
+
+	if stored, _ := kv.Read("/tasks/a"); !strings.HasPrefix(stored, marker+"old:") || strings.Contains(stored, "secret") {
+		t.Fatalf("Expected the task to be stored encrypted, got %q", stored)
+	}
+	if stored, _ := kv.Read("/frameworkId"); stored != "id" {
+		t.Fatalf("Values outside our prefixes should be stored as they are, got %q", stored)
+	}
+
+	if v, err := e.Read("/tasks/a"); err != nil || v != "secret" {
+		t.Fatalf("Expected the task to be decrypted, got %q: %v", v, err)
+	}
+	values, err := e.ReadAll("/tasks/")
+	if err != nil || values["/tasks/a"] != "secret" {
+		t.Fatalf("Expected every task to be decrypted, got %v: %v", values, err)
+	}
+
+	// Values written before encryption was turned on are still readable.
+	kv.Update("/tasks/b", "plain")
+	if v, _ := e.Read("/tasks/b"); v != "plain" {
+		t.Fatalf("Expected the plain value, got %q", v)
+	}
+}
+
+// Values can't be read with the wrong key, or after being moved to another key.
+func TestEncrypted_Tampering(t *testing.T) {
+	kv := memory.New()
+	New(kv, keyring(t, oldKey), "/tasks/").Update("/tasks/a", "secret")
+
+	if _, err := New(kv, keyring(t, newKey), "/tasks/").Read("/tasks/a"); err == nil {
+		t.Fatal("Values encrypted with a key we don't have shouldn't be readable")
+	}
+
+	stored, _ := kv.Read("/tasks/a")
+	kv.Update("/tasks/b", stored)
+	if _, err := New(kv, keyring(t, oldKey), "/tasks/").Read("/tasks/b"); err != CorruptError {
+		t.Fatalf("Values moved to another key shouldn't decrypt, got %v", err)
+	}
+}
+
+// Changes seen through a watch are decrypted.
+func TestEncrypted_Watch(t *testing.T) {
+	kv := memory.New()
+	e := New(kv, keyring(t, oldKey), "/tasks/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := e.Watch(ctx, "/tasks/", true, 0)
+
+	e.Update("/tasks/a", "secret")
+	if event := <-events; event.Type != persistence.Put || event.Value != "secret" {
+		t.Fatalf("Expected the decrypted value, got %+v", event)
+	}
+}
+
+// A corrupt value is handed back as it's stored, without keeping the others from being read.
+func TestEncrypted_Unreadable(t *testing.T) {
+	kv := memory.New()
+	e := New(kv, keyring(t, oldKey), "/tasks/")
+	e.Update("/tasks/b", "readable")
+	stored, _ := kv.Read("/tasks/b")
+	kv.Update("/tasks/a", stored) // Bound to another key, so it fails to authenticate.
+
+	values, _, err := e.ReadAllWithRevision("/tasks/")
+	unreadable, ok := err.(*persistence.UnreadableError)
+	if !ok || unreadable.Stored["/tasks/a"] != stored || len(unreadable.Errors) != 1 {
+		t.Fatalf("Expected only the corrupt value to be unreadable, got %v", err)
+	}
+	if len(values) != 1 || values["/tasks/b"] != "readable" {
+		t.Fatalf("Expected every other value to be decrypted, got %v", values)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := e.Watch(ctx, "/tasks/", true, 0)
+
+	put := func() persistence.Event {
+		for event := range events {
+			if event.Type == persistence.Put {
+				return event
+			}
+		}
+		return persistence.Event{}
+	}
+
+	kv.Update("/tasks/c", stored)
+	if event := put(); event.Err != CorruptError || event.Value != stored {
+		t.Fatalf("Expected the change to be sent as it's stored, got %+v", event)
+	}
+	e.Update("/tasks/d", "later")
+	if event := put(); event.Err != nil || event.Value != "later" {
+		t.Fatalf("Expected the watch to carry on, got %+v", event)
+	}
+}
+
+// Values encrypted with a key we weren't given fail reads and end watches, they're a mistake in our keys rather than corrupt.
+func TestEncrypted_UnknownKey(t *testing.T) {
+	kv := memory.New()
+	New(kv, keyring(t, newKey), "/tasks/").Update("/tasks/a", "secret")
+	kv.Update("/tasks/b", "plain")
+
+	for _, e := range []*Encrypted{New(kv, keyring(t, oldKey), "/tasks/"), New(kv, nil, "/tasks/")} {
+		if _, err := e.Read("/tasks/a"); err == nil {
+			t.Fatal("Expected reading the value to fail")
+		} else if _, ok := err.(*UnknownKeyError); !ok {
+			t.Fatalf("Expected an unknown key, got %v", err)
+		}
+
+		values, _, err := e.ReadAllWithRevision("/tasks/")
+		if _, partial := err.(*persistence.UnreadableError); err == nil || partial || values != nil {
+			t.Fatalf("Expected the whole read to fail, got %v: %v", values, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events := e.Watch(ctx, "/tasks/", true, 0)
+		stored, _ := kv.Read("/tasks/a")
+		kv.Update("/tasks/c", stored)
+		for event := range events {
+			if event.Type == persistence.Put {
+				t.Fatalf("Expected the watch to end, got %+v", event)
+			}
+		}
+		cancel()
+		kv.Delete("/tasks/c")
+	}
+
+	// Without keys, values are stored as they are.
+	New(kv, nil, "/tasks/").Update("/tasks/b", "still plain")
+	if stored, _ := kv.Read("/tasks/b"); stored != "still plain" {
+		t.Fatalf("Expected the value to be stored as it is, got %q", stored)
+	}
+}
+
+// Rotating keys re-encrypts everything with the new one, which the old one is then no longer needed for.
+func TestEncrypted_Reencrypt(t *testing.T) {
+	kv := memory.New()
+	New(kv, keyring(t, oldKey), "/tasks/").Update("/tasks/a", "secret")
+	kv.Update("/tasks/b", "plain")
+
+	rotated := New(kv, keyring(t, newKey+"\n"+oldKey), "/tasks/")
+	written, err := rotated.Reencrypt()
+	if err != nil || written != 2 {
+		t.Fatalf("Expected 2 values to be re-encrypted, got %d: %v", written, err)
+	}
+	if written, _ := rotated.Reencrypt(); written != 0 {
+		t.Fatalf("Values already using the active key shouldn't be written again, wrote %d", written)
+	}
+
+	retired := New(kv, keyring(t, newKey), "/tasks/")
+	values, err := retired.ReadAll("/tasks/")
+	if err != nil || values["/tasks/a"] != "secret" || values["/tasks/b"] != "plain" {
+		t.Fatalf("Expected every value to be readable with the new key alone, got %v: %v", values, err)
+	}
+
+	// Nothing is written if any value can't be decrypted.
+	New(kv, keyring(t, oldKey), "/tasks/").Update("/tasks/c", "secret")
+	kv.Update("/tasks/d", "plain")
+	written, err = retired.Reencrypt()
+	if unreadable, ok := err.(*persistence.UnreadableError); !ok || written != 0 || len(unreadable.Errors) != 1 {
+		t.Fatalf("Expected the value we can't decrypt to be reported, wrote %d: %v", written, err)
+	}
+	if stored, _ := kv.Read("/tasks/d"); stored != "plain" {
+		t.Fatalf("Expected nothing to be written, got %q", stored)
+	}
+}
+
+// Keys are checked as they're parsed.
+func TestParseKeys(t *testing.T) {
+	if k := keyring(t, "# Rotated in March\n"+newKey+", "+oldKey); k.Active() != "new" || len(k.keys) != 2 {
+		t.Fatalf("Expected the first of 2 keys to be active, got %s of %d", k.Active(), len(k.keys))
+	}
+
+	for _, bad := range []string{"", "nokey", "a=notbase64!", "a=c2hvcnQ=", oldKey + "," + oldKey, "a:b=" + strings.SplitN(oldKey, "=", 2)[1]} {
+		if _, err := ParseKeys(bad); err == nil {
+			t.Fatalf("Expected %q to be rejected", bad)
+		}
+	}
+}
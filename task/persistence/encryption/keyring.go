@@ -0,0 +1,108 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Environment variable holding keys when no key file is given.
+const KeysEnv = "HYDROGEN_ENCRYPTION_KEYS"
+
+var NoKeysError = errors.New("No encryption keys were given")
+
+// Keyring holds every key we can decrypt with, and the one we encrypt with.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// LoadKeyring reads keys from the file at the path, or from the environment if there's no path.
+// Returns nil if neither holds any keys, meaning values are stored as they are.
+func LoadKeyring(path string) (*Keyring, error) {
+	data := os.Getenv(KeysEnv)
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = string(b)
+	}
+
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	return ParseKeys(data)
+}
+
+// ParseKeys reads keys in the form "id=base64 key", separated by newlines or commas.
+// Keys must be 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256.
+// The first key is used to encrypt, the rest are only kept to decrypt values written before a rotation.
+func ParseKeys(data string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	entries := strings.FieldsFunc(data, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		id := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || id == "" || strings.Contains(id, ":") {
+			return nil, errors.New("Encryption keys must look like id=key, and ids can't contain a colon")
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, errors.New("Encryption key " + id + " is given more than once")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.New("Encryption key " + id + " isn't valid base64: " + err.Error())
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.New("Encryption key " + id + ": " + err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.active == "" {
+			k.active = id
+		}
+		k.keys[id] = aead
+	}
+
+	if k.active == "" {
+		return nil, NoKeysError
+	}
+
+	return k, nil
+}
+
+// ID of the key we encrypt with.
+func (k *Keyring) Active() string {
+	return k.active
+}
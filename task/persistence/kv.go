@@ -0,0 +1,110 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"errors"
+	"mesos-framework-sdk/persistence"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returned by writes that were rejected because the fence they were made under no longer holds.
+var ErrFenced = errors.New("Write rejected, a newer leader has taken over")
+
+const (
+	Put EventType = iota
+	Delete
+	Progress // Every change up to the event's revision has been sent.
+)
+
+type (
+	// Extends the SDK's key-value store with what leader election needs.
+	KeyValueStore interface {
+		persistence.KeyValueStore
+
+		// Creates the key under a new lease with the given TTL in seconds, but only if the key doesn't exist yet.
+		// Returns the ID of the lease and the revision the key was created at.
+		// A lease of 0 means the key already existed.
+		CreateIfAbsent(key, value string, ttl int64) (int64, int64, error)
+
+		// Reads every key under the prefix, along with the revision of the store they were read at.
+		// Watching from that revision picks up every change made since.
+		// Values that can't be read fail with an UnreadableError, which every other value is still returned along with.
+		ReadAllWithRevision(key string) (map[string]string, int64, error)
+
+		// Applies every operation in a single transaction, under the fence like any other write.
+		// A key can only appear once in a batch.
+		Batch(ops ...Op) error
+
+		// Revokes the lease, immediately deleting every key attached to it.
+		RevokeLease(id int64) error
+
+		// Makes every following write conditional on the key still having been created at the given revision.
+		// Writes made once it's been deleted or recreated fail with ErrFenced.
+		Fence(key string, revision int64)
+
+		// Streams changes to the key, or to every key under it if prefix is set.
+		// Only changes made after the given revision are sent, 0 means changes from now on.
+		// The channel is closed once the context is done or the watch fails.
+		Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan Event
+
+		// Counts the keys under the prefix, and how many of them were last written after the given revision.
+		// Both are counted at the same revision of the store, which is returned along with them.
+		Count(prefix string, since int64) (int64, int64, int64, error)
+	}
+
+	// Whether a key was written or deleted.
+	EventType int
+
+	// A single write in a batch, either setting the key to the value or deleting it.
+	Op struct {
+		Key    string
+		Value  string
+		Delete bool
+	}
+
+	// Describes a single change to a watched key.
+	Event struct {
+		Type     EventType
+		Key      string
+		Value    string
+		Revision int64
+		Err      error // Set when the value written can't be read, Value is then what's stored.
+	}
+
+	// Some of the values read couldn't be, these are kept as they're stored so they can be set aside.
+	UnreadableError struct {
+		Stored map[string]string
+		Errors map[string]error
+	}
+)
+
+func (u *UnreadableError) Error() string {
+	keys := make([]string, 0, len(u.Errors))
+	for key := range u.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reasons := make([]string, 0, len(keys))
+	for _, key := range keys {
+		reasons = append(reasons, key+": "+u.Errors[key].Error())
+	}
+
+	return "Failed to read " + strconv.Itoa(len(keys)) + " values, " + strings.Join(reasons, ", ")
+}
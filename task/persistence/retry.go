@@ -0,0 +1,118 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"math/rand"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task/retry"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Wraps errors that retrying won't fix, such as bad requests or missing permissions.
+	FatalError struct {
+		Err error
+	}
+
+	// Counts what retrying storage operations has taken.
+	RetryStats struct {
+		Calls     uint64 `json:"calls"`     // Operations run under a policy.
+		Retries   uint64 `json:"retries"`   // Attempts made after the first one.
+		Fatal     uint64 `json:"fatal"`     // Operations that failed with an error retrying can't fix.
+		Exhausted uint64 `json:"exhausted"` // Operations that were still failing once out of retries.
+	}
+)
+
+func (e FatalError) Error() string {
+	return e.Err.Error()
+}
+
+// IsRetryable tells us if trying the operation again could succeed.
+func IsRetryable(err error) bool {
+	if err == ErrFenced || err == context.Canceled {
+		return false
+	}
+
+	_, fatal := err.(FatalError)
+
+	return !fatal
+}
+
+// Returns a new policy for a single call to RunPolicy.
+// Policies hold the state of the call they're used for, so they must not be shared.
+func (p Persistence) CheckPolicy(mesosTask *mesos_v1.TaskInfo) *retry.TaskRetry {
+	policy := p.policy
+	return &policy
+}
+
+// Runs the function until it succeeds, fails with an error that retrying won't fix, or runs out of retries.
+// The last error is returned if every attempt fails.
+func (p Persistence) RunPolicy(policy *retry.TaskRetry, f func() error) error {
+	atomic.AddUint64(&p.stats.Calls, 1)
+
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if !IsRetryable(err) {
+			atomic.AddUint64(&p.stats.Fatal, 1)
+			return err
+		}
+
+		if policy.TotalRetries >= policy.MaxRetries {
+			atomic.AddUint64(&p.stats.Exhausted, 1)
+			return err
+		}
+
+		policy.TotalRetries++
+		atomic.AddUint64(&p.stats.Retries, 1)
+		time.Sleep(p.delay(policy))
+	}
+}
+
+// How long to wait before the policy's next retry.
+// Delays double from the base up to the max, and are jittered so that callers failing together don't retry together.
+func (p Persistence) delay(policy *retry.TaskRetry) time.Duration {
+	d := policy.RetryTime
+	if policy.Backoff {
+		for i := 1; i < policy.TotalRetries && (p.maxDelay <= 0 || d < p.maxDelay); i++ {
+			d *= 2
+		}
+	}
+	if p.maxDelay > 0 && d > p.maxDelay {
+		d = p.maxDelay
+	}
+
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Counts what retrying operations has taken so far.
+func (p Persistence) RetryStats() RetryStats {
+	return RetryStats{
+		Calls:     atomic.LoadUint64(&p.stats.Calls),
+		Retries:   atomic.LoadUint64(&p.stats.Retries),
+		Fatal:     atomic.LoadUint64(&p.stats.Fatal),
+		Exhausted: atomic.LoadUint64(&p.stats.Exhausted),
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hydrogen/task/manager"
+	"hydrogen/task/persistence"
+	"hydrogen/task/volumes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the snapshot format that we write and know how to read.
+const SchemaVersion = 1
+
+// Keys that make up our state, either exactly or as a prefix if they end with a slash.
+// Leader election and idempotency results are left out, they only mean something to the cluster they were written in.
+var Keys = []string{
+	manager.TASK_DIRECTORY,
+	volumes.RESERVATION_DIRECTORY,
+	"/frameworkId",
+}
+
+const (
+	// Written by a running scheduler, we don't import over it.
+	leaderKey = "/leader"
+
+	// How many times our state is read again when it changes while it's being read.
+	readAttempts = 3
+)
+
+var (
+	UnsupportedVersionError = errors.New("Unsupported snapshot schema version")
+	ChecksumError           = errors.New("Snapshot checksum doesn't match its contents")
+	NotEmptyError           = errors.New("Storage already holds state, import with force to overwrite it")
+	LeaderError             = errors.New("A scheduler is leading, stop every scheduler before importing")
+	ChangingError           = errors.New("State kept changing while it was read, stop every scheduler and try again")
+)
+
+type (
+	// Snapshot holds every key that makes up our state, as of a single revision.
+	Snapshot struct {
+		SchemaVersion int       `json:"schema_version"`
+		Created       time.Time `json:"created"`
+		Revision      int64     `json:"revision"`
+		Entries       []Entry   `json:"entries"`
+		Checksum      string    `json:"checksum"` // Covers every entry's checksum, in order.
+	}
+
+	// A single key and its value.
+	// Values are kept as bytes since tasks aren't stored as text.
+	Entry struct {
+		Key      string `json:"key"`
+		Value    []byte `json:"value"`
+		Checksum string `json:"checksum"`
+	}
+)
+
+// Export reads our state from storage.
+func Export(kv persistence.KeyValueStore) (*Snapshot, error) {
+	values, revision, err := read(kv)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		SchemaVersion: SchemaVersion,
+		Created:       time.Now().UTC(),
+		Revision:      revision,
+		Entries:       []Entry{},
+	}
+	for key, value := range values {
+		s.Entries = append(s.Entries, Entry{Key: key, Value: []byte(value), Checksum: digest([]byte(value))})
+	}
+	sort.Slice(s.Entries, func(i, j int) bool { return s.Entries[i].Key < s.Entries[j].Key })
+	s.Checksum = s.checksum()
+
+	return s, nil
+}
+
+// Import writes the snapshot to storage, in a single transaction so that a failed import leaves storage as it was.
+// Storage that already holds any of our state is left alone unless forced, and nothing is written while a scheduler is leading.
+// Forcing it replaces our state, keys that aren't in the snapshot are deleted.
+func Import(kv persistence.KeyValueStore, s *Snapshot, force bool) error {
+	if err := s.Verify(); err != nil {
+		return err
+	}
+
+	leader, err := kv.Read(leaderKey)
+	if err != nil {
+		return err
+	}
+	if leader != "" {
+		return LeaderError
+	}
+
+	existing, _, err := read(kv)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && !force {
+		return NotEmptyError
+	}
+
+	ops := make([]persistence.Op, 0, len(s.Entries)+len(existing))
+	for _, e := range s.Entries {
+		ops = append(ops, persistence.Op{Key: e.Key, Value: string(e.Value)})
+		delete(existing, e.Key)
+	}
+	for key := range existing {
+		ops = append(ops, persistence.Op{Key: key, Delete: true})
+	}
+
+	if err := kv.Batch(ops...); err != nil {
+		return errors.New("Failed to import the snapshot, nothing was written: " + err.Error())
+	}
+
+	return nil
+}
+
+// Reads every key that makes up our state, and nothing else, along with the revision it was read at.
+// Each of our keys is read on its own, so they're read again until they all see the same revision, which means
+// nothing was written in between.
+func read(kv persistence.KeyValueStore) (map[string]string, int64, error) {
+	for attempt := 0; attempt < readAttempts; attempt++ {
+		state := make(map[string]string)
+		var revision int64
+		consistent := true
+		for i, k := range Keys {
+			values, r, err := kv.ReadAllWithRevision(k)
+			if err != nil {
+				return nil, 0, err
+			}
+			if i > 0 && r != revision {
+				consistent = false
+			}
+			revision = r
+
+			for key, value := range values {
+				if included(key) {
+					state[key] = value
+				}
+			}
+		}
+
+		if consistent {
+			return state, revision, nil
+		}
+	}
+
+	return nil, 0, ChangingError
+}
+
+// Verify checks that we can read the snapshot and that it hasn't been altered.
+func (s *Snapshot) Verify() error {
+	if s.SchemaVersion < 1 || s.SchemaVersion > SchemaVersion {
+		return errors.New(UnsupportedVersionError.Error() + " " + strconv.Itoa(s.SchemaVersion))
+	}
+
+	for _, e := range s.Entries {
+		if digest(e.Value) != e.Checksum {
+			return errors.New(ChecksumError.Error() + ": " + e.Key)
+		}
+	}
+
+	if s.checksum() != s.Checksum {
+		return ChecksumError
+	}
+
+	return nil
+}
+
+// Write encodes the snapshot as JSON.
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s)
+}
+
+// Read decodes a snapshot from JSON and verifies it.
+func Read(r io.Reader) (*Snapshot, error) {
+	s := new(Snapshot)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+
+	return s, s.Verify()
+}
+
+// Checksum over the keys and checksums of every entry.
+func (s *Snapshot) checksum() string {
+	h := sha256.New()
+	for _, e := range s.Entries {
+		io.WriteString(h, e.Key+"\n"+e.Checksum+"\n")
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Tells us if the key is part of our state.
+func included(key string) bool {
+	for _, k := range Keys {
+		if key == k || (strings.HasSuffix(k, "/") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Hex encoded SHA-256 of the data.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
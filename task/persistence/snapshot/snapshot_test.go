@@ -0,0 +1,186 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	"hydrogen/task/volumes"
+	"testing"
+)
+
+// Remembers which prefixes are read, and fails batches if asked to.
+type recordingStore struct {
+	*memory.Memory
+	read        []string
+	failBatches bool
+}
+
+func (r *recordingStore) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	r.read = append(r.read, key)
+	return r.Memory.ReadAllWithRevision(key)
+}
+
+func (r *recordingStore) Batch(ops ...persistence.Op) error {
+	if r.failBatches {
+		return errors.New("Transaction too large")
+	}
+	return r.Memory.Batch(ops...)
+}
+
+// Seeds a store with our state and some keys that aren't part of it.
+func seeded() *memory.Memory {
+	m := memory.New()
+	m.Update("/tasks/a", "\x00\xff binary")
+	m.Update("/tasks/b/b-1", "b")
+	m.Update("/frameworkId", "id")
+	m.Update("/idempotency/key", "result")
+
+	return m
+}
+
+// Does a snapshot survive a round trip into an empty store?
+func TestSnapshot_RoundTrip(t *testing.T) {
+	s, err := Export(seeded())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(s.Entries) != 3 || s.Revision != 4 {
+		t.Fatalf("Expected 3 entries at revision 4, got %d at %d", len(s.Entries), s.Revision)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	m := memory.New()
+	if err := Import(m, read, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if v, _ := m.Read("/tasks/a"); v != "\x00\xff binary" {
+		t.Fatalf("Binary values should be imported as they were, got %q", v)
+	}
+	if v, _ := m.Read("/idempotency/key"); v != "" {
+		t.Fatal("Keys that aren't part of our state shouldn't be exported")
+	}
+}
+
+// Altered snapshots are rejected.
+func TestSnapshot_Verify(t *testing.T) {
+	s, _ := Export(seeded())
+	s.Entries[0].Value = []byte("changed")
+	if err := s.Verify(); err == nil {
+		t.Fatal("Changed values should fail verification")
+	}
+
+	s, _ = Export(seeded())
+	s.Entries = s.Entries[1:]
+	if err := s.Verify(); err != ChecksumError {
+		t.Fatalf("Missing entries should fail verification, got %v", err)
+	}
+
+	s, _ = Export(seeded())
+	s.SchemaVersion = SchemaVersion + 1
+	if err := s.Verify(); err == nil {
+		t.Fatal("Newer schema versions should be rejected")
+	}
+}
+
+// Existing state is only overwritten when forced, and never under a running leader.
+func TestSnapshot_ImportGuards(t *testing.T) {
+	s, _ := Export(seeded())
+
+	m := seeded()
+	if err := Import(m, s, false); err != NotEmptyError {
+		t.Fatalf("Expected import into a store with state to be refused, got %v", err)
+	}
+	if err := Import(m, s, true); err != nil {
+		t.Fatalf("Forced imports should go through, got %v", err)
+	}
+
+	m.CreateIfAbsent(leaderKey, "1", 10)
+	if err := Import(m, s, true); err != LeaderError {
+		t.Fatalf("Expected import under a leader to be refused, got %v", err)
+	}
+}
+
+// A forced import replaces our state as a whole, and a failed one leaves it as it was.
+func TestSnapshot_ImportReplaces(t *testing.T) {
+	s, _ := Export(seeded())
+
+	m := seeded()
+	m.Update("/tasks/stale", "old")
+	store := &recordingStore{Memory: m, failBatches: true}
+	if err := Import(store, s, true); err == nil {
+		t.Fatal("Expected the failed batch to fail the import")
+	}
+	if v, _ := m.Read("/tasks/stale"); v != "old" {
+		t.Fatal("A failed import shouldn't change anything")
+	}
+
+	store.failBatches = false
+	if err := Import(store, s, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	if v, _ := m.Read("/tasks/stale"); v != "" {
+		t.Fatal("Expected state that isn't in the snapshot to be deleted")
+	}
+	if v, _ := m.Read("/idempotency/key"); v != "result" {
+		t.Fatal("Keys that aren't part of our state should be left alone")
+	}
+	if v, _ := m.Read("/tasks/b/b-1"); v != "b" {
+		t.Fatal("Expected the snapshot's state to be imported")
+	}
+
+	for _, prefix := range store.read {
+		if !included(prefix) {
+			t.Fatalf("Only our own keys should be read, read %s", prefix)
+		}
+	}
+}
+
+// Reservations are part of our state, a restored scheduler has to know where its volumes are.
+func TestSnapshot_Reservations(t *testing.T) {
+	m := seeded()
+	r := volumes.New("db-1", "db", "hydrogen", nil, volumes.Volume{Size: 1024, ContainerPath: "data", Mode: volumes.RW})
+	r.AgentID = "a"
+	if err := volumes.NewReservations(persistence.NewPersistence(m, 0, 0, 0)).Add(r); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := Export(m)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	restored := memory.New()
+	if err := Import(restored, s, false); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	read, err := volumes.NewReservations(persistence.NewPersistence(restored, 0, 0, 0)).Get("db-1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if read == nil || read.AgentID != "a" || read.PersistenceID != r.PersistenceID {
+		t.Fatalf("Expected the reservation to be restored, got %v", read)
+	}
+}
@@ -15,11 +15,10 @@
 package persistence
 
 import (
-	"errors"
 	"mesos-framework-sdk/include/mesos_v1"
-	"mesos-framework-sdk/persistence"
 	"mesos-framework-sdk/task"
 	"mesos-framework-sdk/task/retry"
+	"sync"
 	"time"
 )
 
@@ -27,58 +26,100 @@ import (
 // Also used extensively for testing with mocks.
 type Storage interface {
 	retry.Retry
-	persistence.KeyValueStore
+	KeyValueStore
+
+	// Registers a function that's called whenever a write is rejected by the fence.
+	OnFenced(func())
+
+	// Counts what retrying operations has taken so far.
+	RetryStats() RetryStats
 }
 
 // Primary persistence engine that's used to store task state, high availability metadata, and more.
 type Persistence struct {
-	persistence.KeyValueStore
-	policy retry.TaskRetry
+	KeyValueStore
+	policy   retry.TaskRetry
+	maxDelay time.Duration
+	handler  *fencedHandler
+	stats    *RetryStats
+}
+
+// Shared between copies of the persistence engine so they all see the same handler.
+type fencedHandler struct {
+	sync.RWMutex
+	f func()
 }
 
 // Returns the main persistence engine that's used across the framework.
-func NewPersistence(kv persistence.KeyValueStore, maxRetries int) Storage {
+// Failed operations are retried up to maxRetries times, backing off from the base delay up to the max delay.
+func NewPersistence(kv KeyValueStore, maxRetries int, baseDelay, maxDelay time.Duration) Storage {
 	return &Persistence{
 		KeyValueStore: kv,
 		policy: retry.TaskRetry{
-			RetryTime:  time.Duration(2),
+			RetryTime:  baseDelay,
 			MaxRetries: maxRetries,
 			Backoff:    true,
 		},
+		maxDelay: maxDelay,
+		handler:  new(fencedHandler),
+		stats:    new(RetryStats),
 	}
 }
 
+// Registers a function that's called whenever a write is rejected by the fence.
+func (p Persistence) OnFenced(f func()) {
+	p.handler.Lock()
+	defer p.handler.Unlock()
+
+	p.handler.f = f
+}
+
+// Calls the registered handler if the error came from the fence.
+func (p Persistence) checkFenced(err error) error {
+	if err != ErrFenced {
+		return err
+	}
+
+	p.handler.RLock()
+	f := p.handler.f
+	p.handler.RUnlock()
+
+	if f != nil {
+		f()
+	}
+
+	return err
+}
+
+func (p Persistence) Create(key, value string) error {
+	return p.checkFenced(p.KeyValueStore.Create(key, value))
+}
+
+func (p Persistence) CreateWithLease(key, value string, ttl int64) (int64, error) {
+	lease, err := p.KeyValueStore.CreateWithLease(key, value, ttl)
+	return lease, p.checkFenced(err)
+}
+
+func (p Persistence) Update(key, value string) error {
+	return p.checkFenced(p.KeyValueStore.Update(key, value))
+}
+
+func (p Persistence) Delete(key string) error {
+	return p.checkFenced(p.KeyValueStore.Delete(key))
+}
+
+func (p Persistence) Batch(ops ...Op) error {
+	return p.checkFenced(p.KeyValueStore.Batch(ops...))
+}
+
 // We're not taking user input for storage policies.
 // Return nil error to satisfy the interface.
 func (p Persistence) AddPolicy(policy *task.TimeRetry, mesosTask *mesos_v1.TaskInfo) error {
 	return nil
 }
 
-// Returns the current policy that's used by the persistence engine.
-// There is only ever one policy used at a given time.
-func (p Persistence) CheckPolicy(mesosTask *mesos_v1.TaskInfo) *retry.TaskRetry {
-	return &p.policy
-}
-
 // We're not storing policies constructed from user input in memory.
 // Return nil error to satisfy the interface.
 func (p Persistence) ClearPolicy(mesosTask *mesos_v1.TaskInfo) error {
 	return nil
 }
-
-// Runs the supplied policy for storage operations.
-func (p Persistence) RunPolicy(policy *retry.TaskRetry, f func() error) error {
-	if policy.TotalRetries == policy.MaxRetries {
-		return errors.New("Retry limit reached")
-	}
-
-	err := f()
-	policy.TotalRetries += 1
-	if err != nil {
-		policy.RetryTime = policy.RetryTime * 2
-		time.Sleep(policy.RetryTime)
-		return p.RunPolicy(policy, f)
-	}
-
-	return nil
-}
@@ -0,0 +1,148 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"errors"
+	mockKv "mesos-framework-sdk/persistence/drivers/etcd/test"
+	"testing"
+	"time"
+)
+
+// Rejects every write as if a newer leader had taken over.
+type fencedKVStore struct {
+	mockKv.MockKVStore
+}
+
+func (f fencedKVStore) Update(key, value string) error {
+	return ErrFenced
+}
+
+func (f fencedKVStore) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	return 0, 0, nil
+}
+
+func (f fencedKVStore) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	return nil, 0, nil
+}
+
+func (f fencedKVStore) Count(prefix string, since int64) (int64, int64, int64, error) {
+	return 0, 0, 0, nil
+}
+
+func (f fencedKVStore) Batch(ops ...Op) error {
+	return ErrFenced
+}
+
+func (f fencedKVStore) RevokeLease(id int64) error {
+	return nil
+}
+
+func (f fencedKVStore) Fence(key string, revision int64) {}
+
+func (f fencedKVStore) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan Event {
+	return nil
+}
+
+// Ensures rejected writes are reported to the fenced handler and aren't retried.
+func TestPersistence_Fenced(t *testing.T) {
+	p := NewPersistence(fencedKVStore{}, 3, time.Millisecond, time.Millisecond)
+
+	fenced := 0
+	p.OnFenced(func() {
+		fenced++
+	})
+
+	attempts := 0
+	err := p.RunPolicy(p.CheckPolicy(nil), func() error {
+		attempts++
+		return p.Update("key", "value")
+	})
+
+	if err != ErrFenced {
+		t.Fatalf("Expected the write to be fenced, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("Fenced writes shouldn't be retried, tried %d times", attempts)
+	}
+	if fenced != 1 {
+		t.Fatalf("Fenced handler should be called once, was called %d times", fenced)
+	}
+}
+
+// Fails a number of times before succeeding.
+type flakyKVStore struct {
+	fencedKVStore
+	failures *int
+	err      error
+}
+
+func (f flakyKVStore) Update(key, value string) error {
+	if *f.failures > 0 {
+		*f.failures--
+		return f.err
+	}
+
+	return nil
+}
+
+// Every call gets its own retries, and errors are retried only if that could help.
+func TestPersistence_RunPolicy(t *testing.T) {
+	failures := 2
+	p := NewPersistence(flakyKVStore{failures: &failures, err: errors.New("Unavailable")}, 3, time.Nanosecond, time.Nanosecond)
+
+	update := func() error { return p.Update("key", "value") }
+	if err := p.RunPolicy(p.CheckPolicy(nil), update); err != nil {
+		t.Fatalf("Expected the update to succeed once retried, got %v", err)
+	}
+
+	// Earlier retries don't count against later calls.
+	failures = 3
+	if err := p.RunPolicy(p.CheckPolicy(nil), update); err != nil {
+		t.Fatalf("Expected the update to succeed on its last retry, got %v", err)
+	}
+
+	failures = 4
+	if err := p.RunPolicy(p.CheckPolicy(nil), update); err == nil {
+		t.Fatal("Expected the update to fail once out of retries")
+	}
+
+	fatal := FatalError{Err: errors.New("Permission denied")}
+	failures = 1
+	p = NewPersistence(flakyKVStore{failures: &failures, err: fatal}, 3, time.Nanosecond, time.Nanosecond)
+	if err := p.RunPolicy(p.CheckPolicy(nil), func() error { return p.Update("key", "value") }); err != fatal {
+		t.Fatalf("Expected the fatal error without retrying, got %v", err)
+	}
+
+	stats := p.RetryStats()
+	if stats.Calls != 1 || stats.Fatal != 1 || stats.Retries != 0 {
+		t.Fatalf("Unexpected retry stats %+v", stats)
+	}
+}
+
+// Delays back off up to the max, with jitter.
+func TestPersistence_Delay(t *testing.T) {
+	p := NewPersistence(fencedKVStore{}, 10, 100*time.Millisecond, time.Second).(*Persistence)
+	policy := p.CheckPolicy(nil)
+
+	for retries, max := range []time.Duration{100, 100, 200, 400, 800, 1000, 1000} {
+		policy.TotalRetries = retries
+		max *= time.Millisecond
+		if d := p.delay(policy); d < max/2 || d > max {
+			t.Fatalf("Expected a delay between %v and %v after %d retries, got %v", max/2, max, retries, d)
+		}
+	}
+}
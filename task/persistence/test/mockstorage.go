@@ -15,6 +15,9 @@
 package test
 
 import (
+	"context"
+	"errors"
+	"hydrogen/task/persistence"
 	mockKv "mesos-framework-sdk/persistence/drivers/etcd/test"
 	mockRetry "mesos-framework-sdk/task/retry/test"
 )
@@ -28,3 +31,76 @@ type MockBrokenStorage struct {
 	mockKv.MockBrokenKVStore
 	mockRetry.MockBrokenRetry
 }
+
+func (m MockStorage) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	return 1, 1, nil
+}
+
+func (m MockStorage) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	values, err := m.ReadAll(key)
+	return values, 1, err
+}
+
+// Nothing changes after the revision everything is read at.
+func (m MockStorage) Count(prefix string, since int64) (int64, int64, int64, error) {
+	values, err := m.ReadAll(prefix)
+	return int64(len(values)), 0, 1, err
+}
+
+func (m MockStorage) Batch(ops ...persistence.Op) error {
+	return nil
+}
+
+func (m MockStorage) RevokeLease(id int64) error {
+	return nil
+}
+
+func (m MockStorage) Fence(key string, revision int64) {}
+
+func (m MockStorage) OnFenced(f func()) {}
+
+func (m MockStorage) RetryStats() persistence.RetryStats {
+	return persistence.RetryStats{}
+}
+
+func (m MockStorage) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	events := make(chan persistence.Event)
+	close(events)
+
+	return events
+}
+
+func (m MockBrokenStorage) CreateIfAbsent(key, value string, ttl int64) (int64, int64, error) {
+	return 0, 0, errors.New("Broken")
+}
+
+func (m MockBrokenStorage) ReadAllWithRevision(key string) (map[string]string, int64, error) {
+	return nil, 0, errors.New("Broken")
+}
+
+func (m MockBrokenStorage) Count(prefix string, since int64) (int64, int64, int64, error) {
+	return 0, 0, 0, errors.New("Broken")
+}
+
+func (m MockBrokenStorage) Batch(ops ...persistence.Op) error {
+	return errors.New("Broken")
+}
+
+func (m MockBrokenStorage) RevokeLease(id int64) error {
+	return errors.New("Broken")
+}
+
+func (m MockBrokenStorage) Fence(key string, revision int64) {}
+
+func (m MockBrokenStorage) OnFenced(f func()) {}
+
+func (m MockBrokenStorage) RetryStats() persistence.RetryStats {
+	return persistence.RetryStats{}
+}
+
+func (m MockBrokenStorage) Watch(ctx context.Context, key string, prefix bool, revision int64) <-chan persistence.Event {
+	events := make(chan persistence.Event)
+	close(events)
+
+	return events
+}
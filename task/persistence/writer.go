@@ -0,0 +1,190 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"mesos-framework-sdk/logging"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Writer queues writes and applies them in batches, so that callers don't each wait on a round-trip to storage.
+// A write queued for a key replaces any that hasn't been applied yet, so only the latest value is written.
+// Queued writes are applied once the delay has passed, or as soon as Flush is called.
+type Writer struct {
+	storage  Storage
+	size     int
+	delay    time.Duration
+	logger   logging.Logger
+	mutex    sync.Mutex
+	pending  map[string]Op
+	timer    *time.Timer
+	flushing sync.Mutex // Held while a flush is being written, so that batches are applied in order.
+	fenced   bool
+}
+
+// Returns a writer that applies up to size operations per transaction, 0 meaning no limit.
+func NewWriter(s Storage, size int, delay time.Duration, l logging.Logger) *Writer {
+	return &Writer{
+		storage: s,
+		size:    size,
+		delay:   delay,
+		logger:  l,
+		pending: make(map[string]Op),
+	}
+}
+
+// Queues the key to be set to the value.
+func (w *Writer) Put(key, value string) {
+	w.queue(Op{Key: key, Value: value})
+}
+
+// Queues the key to be deleted.
+func (w *Writer) Delete(key string) {
+	w.queue(Op{Key: key, Delete: true})
+}
+
+// Flush returns once every write queued before it was called has been applied.
+// Writes that fail stay queued, and are tried again by the next flush.
+// Once a newer leader has fenced us off nothing more can be written, so every flush fails from then on.
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	return w.flush()
+}
+
+// Apply writes the operations right away, after everything that's already queued.
+// Unlike queued writes they aren't tried again if they fail, the caller decides what to do instead.
+// Returns how many of the operations were applied, which can be fewer than were given if they span several batches.
+func (w *Writer) Apply(ops ...Op) (int, error) {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	if err := w.flush(); err != nil {
+		return 0, err
+	}
+
+	n, err := w.apply(ops)
+	if err == ErrFenced {
+		w.mutex.Lock()
+		w.fenced = true
+		w.mutex.Unlock()
+	}
+
+	return n, err
+}
+
+// Applies everything that's queued, the caller must hold the flushing lock.
+func (w *Writer) flush() error {
+	w.mutex.Lock()
+	if w.fenced {
+		w.mutex.Unlock()
+		return ErrFenced
+	}
+	pending := w.pending
+	w.pending = make(map[string]Op)
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mutex.Unlock()
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ops := make([]Op, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, pending[key])
+	}
+
+	n, err := w.apply(ops)
+	if err != nil {
+		w.requeue(ops[n:], err)
+	}
+
+	return err
+}
+
+// Writes the operations in as few batches as we can, stopping at the first one that fails.
+// Returns how many operations were applied.
+func (w *Writer) apply(ops []Op) (int, error) {
+	applied := 0
+	for applied < len(ops) {
+		n := len(ops) - applied
+		if w.size > 0 && n > w.size {
+			n = w.size
+		}
+
+		batch := ops[applied : applied+n]
+		err := w.storage.RunPolicy(w.storage.CheckPolicy(nil), func() error {
+			return w.storage.Batch(batch...)
+		})
+		if err != nil {
+			return applied, err
+		}
+
+		applied += n
+	}
+
+	return applied, nil
+}
+
+// Queues the operation, making sure a flush is coming.
+func (w *Writer) queue(op Op) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending[op.Key] = op
+	if !w.fenced {
+		w.schedule()
+	}
+}
+
+// Puts back the writes that failed, unless newer ones were queued for their keys in the meantime.
+func (w *Writer) requeue(ops []Op, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err == ErrFenced {
+		w.fenced = true
+		return
+	}
+
+	for _, op := range ops {
+		if _, ok := w.pending[op.Key]; !ok {
+			w.pending[op.Key] = op
+		}
+	}
+	w.schedule()
+}
+
+// Flushes once the delay has passed, unless a flush is already coming.
+// The caller must hold the lock.
+func (w *Writer) schedule() {
+	if w.timer != nil {
+		return
+	}
+
+	w.timer = time.AfterFunc(w.delay, func() {
+		if err := w.Flush(); err != nil {
+			w.logger.Emit(logging.ERROR, "Failed to write queued task state to persistent storage: %s", err.Error())
+		}
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"errors"
+	mockLogger "mesos-framework-sdk/logging/test"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records every batch, failing with the given errors first.
+type batchingKVStore struct {
+	fencedKVStore
+	mutex   *sync.Mutex
+	batches *[][]Op
+	errs    *[]error
+}
+
+func newBatchingKVStore(errs ...error) batchingKVStore {
+	return batchingKVStore{mutex: new(sync.Mutex), batches: new([][]Op), errs: &errs}
+}
+
+func (b batchingKVStore) Batch(ops ...Op) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(*b.errs) > 0 {
+		err := (*b.errs)[0]
+		*b.errs = (*b.errs)[1:]
+		return err
+	}
+
+	*b.batches = append(*b.batches, append([]Op(nil), ops...))
+
+	return nil
+}
+
+func (b batchingKVStore) applied() [][]Op {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([][]Op(nil), *b.batches...)
+}
+
+// Only the latest write to a key is applied, and everything queued goes out together.
+func TestWriter_Coalesce(t *testing.T) {
+	kv := newBatchingKVStore()
+	w := NewWriter(NewPersistence(kv, 0, 0, 0), 0, time.Hour, new(mockLogger.MockLogger))
+
+	w.Put("/a", "1")
+	w.Put("/b", "1")
+	w.Put("/a", "2")
+	w.Delete("/c")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	batches := kv.applied()
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("Expected a single batch of 3 writes, got %v", batches)
+	}
+	if op := batches[0][0]; op.Key != "/a" || op.Value != "2" {
+		t.Fatalf("Expected only the latest write to /a, got %+v", op)
+	}
+	if op := batches[0][2]; op.Key != "/c" || !op.Delete {
+		t.Fatalf("Expected /c to be deleted, got %+v", op)
+	}
+
+	if err := w.Flush(); err != nil || len(kv.applied()) != 1 {
+		t.Fatal("Flushing with nothing queued shouldn't write anything")
+	}
+}
+
+// Batches are kept within the size we're given.
+func TestWriter_Size(t *testing.T) {
+	kv := newBatchingKVStore()
+	w := NewWriter(NewPersistence(kv, 0, 0, 0), 2, time.Hour, new(mockLogger.MockLogger))
+
+	for _, key := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		w.Put(key, "1")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if batches := kv.applied(); len(batches) != 3 {
+		t.Fatalf("Expected 3 batches, got %v", batches)
+	}
+}
+
+// Queued writes are applied once the delay is up, without anyone waiting on them.
+func TestWriter_Delay(t *testing.T) {
+	kv := newBatchingKVStore()
+	w := NewWriter(NewPersistence(kv, 0, 0, 0), 0, time.Millisecond, new(mockLogger.MockLogger))
+
+	w.Put("/a", "1")
+	for i := 0; i < 100 && len(kv.applied()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(kv.applied()) != 1 {
+		t.Fatal("Expected the queued write to be applied in the background")
+	}
+}
+
+// Failed writes are tried again, unless a newer write to the same key has been queued since.
+func TestWriter_Requeue(t *testing.T) {
+	kv := newBatchingKVStore(FatalError{Err: errors.New("Broken")})
+	w := NewWriter(NewPersistence(kv, 0, 0, 0), 0, time.Hour, new(mockLogger.MockLogger))
+
+	w.Put("/a", "1")
+	w.Put("/b", "1")
+	if err := w.Flush(); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+
+	w.Put("/a", "2")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	batches := kv.applied()
+	if len(batches) != 1 || len(batches[0]) != 2 || batches[0][0].Value != "2" {
+		t.Fatalf("Expected both writes to be applied with the newer value for /a, got %v", batches)
+	}
+
+	if n, err := w.Apply(Op{Key: "/c"}, Op{Key: "/d"}); n != 2 || err != nil {
+		t.Fatalf("Expected both writes to be applied right away, got %d: %v", n, err)
+	}
+}
+
+// Nothing more is written once a newer leader has taken over.
+func TestWriter_Fenced(t *testing.T) {
+	kv := newBatchingKVStore(ErrFenced)
+	w := NewWriter(NewPersistence(kv, 3, 0, 0), 0, time.Hour, new(mockLogger.MockLogger))
+
+	w.Put("/a", "1")
+	if err := w.Flush(); err != ErrFenced {
+		t.Fatalf("Expected the flush to be fenced, got %v", err)
+	}
+
+	w.Put("/b", "1")
+	if err := w.Flush(); err != ErrFenced {
+		t.Fatalf("Expected every flush after being fenced to fail, got %v", err)
+	}
+	if _, err := w.Apply(Op{Key: "/c"}); err != ErrFenced {
+		t.Fatalf("Expected writes after being fenced to fail, got %v", err)
+	}
+	if len(kv.applied()) != 0 {
+		t.Fatal("Nothing should be written once we've been fenced")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"encoding/json"
+	"hydrogen/task/persistence"
+	"mesos-framework-sdk/include/mesos_v1"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Where we remember the agents we've been offered.
+const AGENT_DIRECTORY = "/agents/"
+
+type (
+	// Agent describes what constraints can be evaluated against.
+	Agent struct {
+		ID         string            `json:"id"`
+		Hostname   string            `json:"hostname"`
+		Region     string            `json:"region,omitempty"`
+		Zone       string            `json:"zone,omitempty"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+	}
+
+	// Agents remembers every agent we've been offered, so that we know where running instances are placed.
+	// Agents are persisted, so a new leader knows where instances are without waiting to be offered every agent again.
+	Agents struct {
+		mutex   sync.RWMutex
+		agents  map[string]*Agent
+		loaded  bool
+		storage persistence.Storage
+		writer  *persistence.Writer
+	}
+)
+
+// Describes the agent an offer comes from.
+// Attributes are written the same way Mesos shows them.
+func Describe(offer *mesos_v1.Offer) *Agent {
+	a := &Agent{
+		ID:         offer.GetAgentId().GetValue(),
+		Hostname:   offer.GetHostname(),
+		Region:     offer.GetDomain().GetFaultDomain().GetRegion().GetName(),
+		Zone:       offer.GetDomain().GetFaultDomain().GetZone().GetName(),
+		Attributes: make(map[string]string),
+	}
+
+	for _, attr := range offer.GetAttributes() {
+		switch attr.GetType() {
+		case mesos_v1.Value_TEXT:
+			a.Attributes[attr.GetName()] = attr.GetText().GetValue()
+		case mesos_v1.Value_SCALAR:
+			a.Attributes[attr.GetName()] = strconv.FormatFloat(attr.GetScalar().GetValue(), 'f', -1, 64)
+		case mesos_v1.Value_SET:
+			items := append([]string(nil), attr.GetSet().GetItem()...)
+			sort.Strings(items)
+			a.Attributes[attr.GetName()] = "{" + strings.Join(items, ",") + "}"
+		case mesos_v1.Value_RANGES:
+			ranges := []string{}
+			for _, r := range attr.GetRanges().GetRange() {
+				ranges = append(ranges, strconv.FormatUint(r.GetBegin(), 10)+"-"+strconv.FormatUint(r.GetEnd(), 10))
+			}
+			a.Attributes[attr.GetName()] = "[" + strings.Join(ranges, ",") + "]"
+		}
+	}
+
+	return a
+}
+
+// The value of the field on this agent, and whether it has one.
+func (a *Agent) Value(field string) (string, bool) {
+	switch field {
+	case HOSTNAME:
+		return a.Hostname, a.Hostname != ""
+	case REGION:
+		return a.Region, a.Region != ""
+	case ZONE:
+		return a.Zone, a.Zone != ""
+	}
+
+	v, ok := a.Attributes[field]
+	return v, ok
+}
+
+// Returns an empty set of agents, persisted through the writer.
+func NewAgents(s persistence.Storage, w *persistence.Writer) *Agents {
+	return &Agents{
+		agents:  make(map[string]*Agent),
+		storage: s,
+		writer:  w,
+	}
+}
+
+// Remembers the agents the offers come from, persisting any we haven't seen before or that have changed.
+// Agents persisted by an earlier leader are read the first time we're called.
+func (a *Agents) Observe(offers []*mesos_v1.Offer) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if !a.loaded {
+		if err := a.load(); err != nil {
+			return err
+		}
+		a.loaded = true
+	}
+
+	for _, offer := range offers {
+		agent := Describe(offer)
+		if known, ok := a.agents[agent.ID]; ok && reflect.DeepEqual(known, agent) {
+			continue
+		}
+
+		data, err := json.Marshal(agent)
+		if err != nil {
+			return err
+		}
+		a.writer.Put(AGENT_DIRECTORY+agent.ID, string(data))
+		a.agents[agent.ID] = agent
+	}
+
+	return nil
+}
+
+// The agent with the given ID, if we've been offered it.
+func (a *Agents) Get(id string) (*Agent, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	agent, ok := a.agents[id]
+	return agent, ok
+}
+
+// Reads every persisted agent, the caller must hold the lock.
+func (a *Agents) load() error {
+	var values map[string]string
+	err := a.storage.RunPolicy(a.storage.CheckPolicy(nil), func() (err error) {
+		values, err = a.storage.ReadAll(AGENT_DIRECTORY)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		agent := new(Agent)
+		if err := json.Unmarshal([]byte(value), agent); err != nil {
+			continue
+		}
+		if agent.Attributes == nil {
+			agent.Attributes = make(map[string]string)
+		}
+		if _, ok := a.agents[agent.ID]; !ok {
+			a.agents[agent.ID] = agent
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	"mesos-framework-sdk/include/mesos_v1"
+	mockLogger "mesos-framework-sdk/logging/test"
+	"mesos-framework-sdk/utils"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	a := Describe(&mesos_v1.Offer{
+		AgentId:  &mesos_v1.AgentID{Value: utils.ProtoString("agent")},
+		Hostname: utils.ProtoString("host"),
+		Domain: &mesos_v1.DomainInfo{FaultDomain: &mesos_v1.DomainInfo_FaultDomain{
+			Region: &mesos_v1.DomainInfo_FaultDomain_RegionInfo{Name: utils.ProtoString("east")},
+			Zone:   &mesos_v1.DomainInfo_FaultDomain_ZoneInfo{Name: utils.ProtoString("east-1")},
+		}},
+		Attributes: []*mesos_v1.Attribute{
+			{Name: utils.ProtoString("rack"), Type: mesos_v1.Value_TEXT.Enum(), Text: &mesos_v1.Value_Text{Value: utils.ProtoString("a")}},
+			{Name: utils.ProtoString("cores"), Type: mesos_v1.Value_SCALAR.Enum(), Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(8)}},
+			{Name: utils.ProtoString("disks"), Type: mesos_v1.Value_SET.Enum(), Set: &mesos_v1.Value_Set{Item: []string{"ssd", "hdd"}}},
+		},
+	})
+
+	if v, _ := a.Value(HOSTNAME); v != "host" {
+		t.Fatalf("Expected the hostname, got %s", v)
+	}
+	for field, expected := range map[string]string{"rack": "a", "cores": "8", "disks": "{hdd,ssd}", REGION: "east", ZONE: "east-1"} {
+		if v, ok := a.Value(field); !ok || v != expected {
+			t.Errorf("Expected %s to be %s, got %s", field, expected, v)
+		}
+	}
+	if _, ok := a.Value("zone"); ok {
+		t.Error("Expected missing attributes to have no value")
+	}
+}
+
+// Agents we're offered are persisted, and read back by whoever leads next.
+func TestAgents_Observe(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	writer := persistence.NewWriter(storage, 0, time.Hour, new(mockLogger.MockLogger))
+	agents := NewAgents(storage, writer)
+
+	offer := &mesos_v1.Offer{
+		AgentId:  &mesos_v1.AgentID{Value: utils.ProtoString("agent")},
+		Hostname: utils.ProtoString("host"),
+	}
+	if err := agents.Observe([]*mesos_v1.Offer{offer}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if a, ok := agents.Get("agent"); !ok || a.Hostname != "host" {
+		t.Fatal("Expected the offered agent to be known")
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	next := NewAgents(storage, writer)
+	if err := next.Observe(nil); err != nil {
+		t.Fatal(err.Error())
+	}
+	if a, ok := next.Get("agent"); !ok || a.Hostname != "host" {
+		t.Fatal("Expected the persisted agent to be read back")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	UNIQUE   = "UNIQUE"   // No two instances share a value.
+	CLUSTER  = "CLUSTER"  // Every instance shares the given value, or the value of the first one placed.
+	GROUP_BY = "GROUP_BY" // Instances are spread evenly across values, optionally across at least n of them.
+	LIKE     = "LIKE"     // The value matches the regular expression.
+	UNLIKE   = "UNLIKE"   // The value doesn't match the regular expression, or is missing.
+	MAX_PER  = "MAX_PER"  // At most n instances share a value.
+	IS       = "IS"       // The value is exactly the one given.
+
+	// Fields holding the agent's hostname and fault domain, every other field is an agent attribute.
+	HOSTNAME = "hostname"
+	REGION   = "@region"
+	ZONE     = "@zone"
+)
+
+// Constraint limits which agents an application's instances can be placed on, based on the hostname or an attribute.
+// They're written the same way as in Marathon, such as ["hostname", "MAX_PER", "2"] or ["rack", "GROUP_BY"].
+type Constraint struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Parses a single constraint, making sure its value makes sense for the operator.
+func Parse(raw []string) (Constraint, error) {
+	if len(raw) < 2 || len(raw) > 3 {
+		return Constraint{}, errors.New("Constraints must look like [field, operator] or [field, operator, value]")
+	}
+
+	c := Constraint{Field: raw[0], Operator: strings.ToUpper(raw[1])}
+	if len(raw) == 3 {
+		c.Value = raw[2]
+	}
+	if c.Field == "" {
+		return c, errors.New("Constraints need a field, either hostname or an agent attribute")
+	}
+
+	switch c.Operator {
+	case UNIQUE:
+		if c.Value != "" {
+			return c, errors.New("UNIQUE doesn't take a value")
+		}
+	case CLUSTER:
+	case GROUP_BY:
+		if c.Value != "" {
+			if _, err := count(c); err != nil {
+				return c, err
+			}
+		}
+	case MAX_PER:
+		if _, err := count(c); err != nil {
+			return c, err
+		}
+	case LIKE, UNLIKE:
+		if c.Value == "" {
+			return c, errors.New(c.Operator + " needs a regular expression")
+		}
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return c, errors.New(c.Operator + " has an invalid regular expression: " + err.Error())
+		}
+	case IS:
+		if c.Value == "" {
+			return c, errors.New("IS needs a value")
+		}
+	default:
+		return c, errors.New("Unknown constraint operator " + raw[1])
+	}
+
+	return c, nil
+}
+
+// Parses every constraint, failing on the first one that's invalid.
+func ParseAll(raw [][]string) ([]Constraint, error) {
+	constraints := make([]Constraint, 0, len(raw))
+	for _, r := range raw {
+		c, err := Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+
+	return constraints, nil
+}
+
+func (c Constraint) String() string {
+	s := c.Field + ":" + c.Operator
+	if c.Value != "" {
+		s += ":" + c.Value
+	}
+
+	return s
+}
+
+// The number the constraint's value holds.
+func count(c Constraint) (int, error) {
+	n, err := strconv.Atoi(c.Value)
+	if err != nil || n < 1 {
+		return 0, errors.New(c.Operator + " needs a positive number")
+	}
+
+	return n, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := [][]string{
+		{"hostname", "UNIQUE"},
+		{"rack", "cluster"},
+		{"rack", "CLUSTER", "a"},
+		{"zone", "GROUP_BY"},
+		{"zone", "GROUP_BY", "3"},
+		{"hostname", "LIKE", "web-[0-9]+"},
+		{"hostname", "UNLIKE", "db-.*"},
+		{"hostname", "MAX_PER", "2"},
+		{"os", "IS", "linux"},
+	}
+	for _, raw := range valid {
+		if _, err := Parse(raw); err != nil {
+			t.Errorf("Expected %v to be valid, got %s", raw, err.Error())
+		}
+	}
+
+	invalid := [][]string{
+		{"hostname"},
+		{"hostname", "UNIQUE", "x", "y"},
+		{"", "UNIQUE"},
+		{"hostname", "UNIQUE", "x"},
+		{"zone", "GROUP_BY", "none"},
+		{"hostname", "MAX_PER"},
+		{"hostname", "MAX_PER", "0"},
+		{"hostname", "LIKE"},
+		{"hostname", "LIKE", "("},
+		{"os", "IS"},
+		{"os", "NEAR", "linux"},
+	}
+	for _, raw := range invalid {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Expected %v to be invalid", raw)
+		}
+	}
+}
+
+// Constraints are written out the way they're read in.
+func TestConstraint_String(t *testing.T) {
+	constraints, err := ParseAll([][]string{{"hostname", "unique"}, {"rack", "MAX_PER", "2"}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if constraints[0].String() != "hostname:UNIQUE" || constraints[1].String() != "rack:MAX_PER:2" {
+		t.Fatalf("Unexpected constraints %v", constraints)
+	}
+}
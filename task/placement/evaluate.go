@@ -0,0 +1,87 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"regexp"
+)
+
+// Satisfied tells us if placing an instance on the agent keeps every constraint,
+// given the agents that the application's other instances are placed on.
+func Satisfied(constraints []Constraint, agent *Agent, placed []*Agent) bool {
+	for _, c := range constraints {
+		if !satisfies(c, agent, placed) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func satisfies(c Constraint, agent *Agent, placed []*Agent) bool {
+	value, ok := agent.Value(c.Field)
+	if !ok {
+		// Agents without the field can only satisfy constraints on what it must not be.
+		return c.Operator == UNLIKE
+	}
+
+	// How many instances are placed on each of the field's values.
+	counts := make(map[string]int)
+	for _, p := range placed {
+		if v, ok := p.Value(c.Field); ok {
+			counts[v]++
+		}
+	}
+
+	switch c.Operator {
+	case UNIQUE:
+		return counts[value] == 0
+	case CLUSTER:
+		if c.Value != "" {
+			return value == c.Value
+		}
+		for v := range counts {
+			if v != value {
+				return false
+			}
+		}
+		return true
+	case GROUP_BY:
+		// Values are filled up evenly, and values nobody is placed on come first until we've used as many as asked for.
+		least := 0
+		if groups, _ := count(c); len(counts) >= groups && len(counts) > 0 {
+			least = -1
+			for _, n := range counts {
+				if least < 0 || n < least {
+					least = n
+				}
+			}
+		}
+		return counts[value] <= least
+	case LIKE, UNLIKE:
+		re, err := regexp.Compile("^(?:" + c.Value + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(value) == (c.Operator == LIKE)
+	case MAX_PER:
+		n, err := count(c)
+		return err == nil && counts[value] < n
+	case IS:
+		return value == c.Value
+	}
+
+	return false
+}
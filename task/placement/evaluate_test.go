@@ -0,0 +1,74 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"testing"
+)
+
+func agent(hostname, rack string) *Agent {
+	a := &Agent{ID: hostname, Hostname: hostname, Attributes: map[string]string{}}
+	if rack != "" {
+		a.Attributes["rack"] = rack
+	}
+
+	return a
+}
+
+func TestSatisfied(t *testing.T) {
+	a1, a2, b1, c1, none := agent("a1", "a"), agent("a2", "a"), agent("b1", "b"), agent("c1", "c"), agent("x1", "")
+
+	tests := []struct {
+		name       string
+		constraint []string
+		agent      *Agent
+		placed     []*Agent
+		expected   bool
+	}{
+		{"unique free host", []string{"hostname", "UNIQUE"}, a1, []*Agent{a2}, true},
+		{"unique taken host", []string{"hostname", "UNIQUE"}, a1, []*Agent{a1}, false},
+		{"unique taken rack", []string{"rack", "UNIQUE"}, a2, []*Agent{a1}, false},
+		{"unique missing attribute", []string{"rack", "UNIQUE"}, none, nil, false},
+		{"cluster on value", []string{"rack", "CLUSTER", "b"}, b1, nil, true},
+		{"cluster off value", []string{"rack", "CLUSTER", "b"}, a1, nil, false},
+		{"cluster first placement", []string{"rack", "CLUSTER"}, a1, nil, true},
+		{"cluster follows placed", []string{"rack", "CLUSTER"}, a2, []*Agent{a1}, true},
+		{"cluster away from placed", []string{"rack", "CLUSTER"}, b1, []*Agent{a1}, false},
+		{"group by empty rack", []string{"rack", "GROUP_BY"}, b1, []*Agent{a1}, true},
+		{"group by fuller rack", []string{"rack", "GROUP_BY"}, a2, []*Agent{a1, b1, b1}, true},
+		{"group by uneven", []string{"rack", "GROUP_BY"}, a2, []*Agent{a1, a2, b1}, false},
+		{"group by unused racks first", []string{"rack", "GROUP_BY", "3"}, a2, []*Agent{a1, b1}, false},
+		{"group by new rack", []string{"rack", "GROUP_BY", "3"}, c1, []*Agent{a1, b1}, true},
+		{"like matches", []string{"hostname", "LIKE", "a[0-9]"}, a1, nil, true},
+		{"like is anchored", []string{"hostname", "LIKE", "a"}, a1, nil, false},
+		{"unlike matches", []string{"rack", "UNLIKE", "a|b"}, a1, nil, false},
+		{"unlike other value", []string{"rack", "UNLIKE", "a|b"}, c1, nil, true},
+		{"unlike missing attribute", []string{"rack", "UNLIKE", "a"}, none, nil, true},
+		{"max per below", []string{"rack", "MAX_PER", "2"}, a2, []*Agent{a1}, true},
+		{"max per reached", []string{"rack", "MAX_PER", "2"}, a2, []*Agent{a1, a2}, false},
+		{"is equal", []string{"rack", "IS", "c"}, c1, nil, true},
+		{"is different", []string{"rack", "IS", "c"}, b1, nil, false},
+	}
+
+	for _, test := range tests {
+		c, err := Parse(test.constraint)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if actual := Satisfied([]Constraint{c}, test.agent, test.placed); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
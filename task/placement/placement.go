@@ -0,0 +1,94 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"encoding/json"
+	"hydrogen/task/ports"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"strings"
+)
+
+// A task's placement is kept in a single filter of this type, since the SDK's task has nowhere else to keep it.
+// It's never matched against offers, it's only there so that it's stored along with the task.
+const FILTER_TYPE = "PLACEMENT"
+
+// Placement holds what we decide where and when to launch a task with, on top of what the SDK's task knows about.
+type Placement struct {
+	Constraints []Constraint    `json:"constraints,omitempty"`
+	Spread      string          `json:"spread,omitempty"`  // Field a spread strategy balances instances across.
+	Ranking     string          `json:"ranking,omitempty"` // Overrides the scheduler's offer ranking.
+	Ports       []ports.Port    `json:"ports,omitempty"`   // In the order they were requested.
+	Volume      *volumes.Volume `json:"volume,omitempty"`
+	Priority    int             `json:"priority,omitempty"`
+	Preempted   bool            `json:"preempted,omitempty"` // Killed to make room for another task, until it's queued again.
+}
+
+// The task's placement, tasks without one get the zero value.
+func Of(t *manager.Task) Placement {
+	p := Placement{}
+	for _, f := range t.Filters {
+		if strings.ToUpper(f.Type) == FILTER_TYPE && len(f.Value) == 1 {
+			json.Unmarshal([]byte(f.Value[0]), &p)
+			break
+		}
+	}
+
+	return p
+}
+
+// Replaces the task's placement, a zero placement is removed altogether.
+// The task gets filters of its own, since instances of a group share theirs.
+func Set(t *manager.Task, p Placement) {
+	filters := make([]task.Filter, 0, len(t.Filters)+1)
+	for _, f := range t.Filters {
+		if strings.ToUpper(f.Type) != FILTER_TYPE {
+			filters = append(filters, f)
+		}
+	}
+	if !p.empty() {
+		filters = append(filters, p.Filter())
+	}
+	t.Filters = filters
+}
+
+// Filter holding the placement on a task.
+func (p Placement) Filter() task.Filter {
+	data, _ := json.Marshal(p)
+
+	return task.Filter{Type: FILTER_TYPE, Value: []string{string(data)}}
+}
+
+// The field instances are spread across, fault domain zones unless told otherwise.
+func (p Placement) SpreadField() string {
+	if p.Spread == "" {
+		return ZONE
+	}
+
+	return p.Spread
+}
+
+// The ranking the task's offers are picked with, if it has one we know.
+func (p Placement) Rank() (Ranking, bool) {
+	r, ok := Rankings[strings.ToLower(p.Ranking)]
+	return r, ok
+}
+
+func (p Placement) empty() bool {
+	return len(p.Constraints) == 0 && p.Spread == "" && p.Ranking == "" && len(p.Ports) == 0 && p.Volume == nil &&
+		p.Priority == 0 && !p.Preempted
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"hydrogen/task/ports"
+	"hydrogen/task/volumes"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"reflect"
+	"testing"
+)
+
+// A placement survives being kept with the task, alongside the filters offers are matched against.
+func TestPlacement_Set(t *testing.T) {
+	p := Placement{
+		Constraints: []Constraint{{Field: HOSTNAME, Operator: UNIQUE}},
+		Spread:      "rack",
+		Ranking:     RANK_BINPACK,
+		Ports:       []ports.Port{{Name: "http", Protocol: "tcp", Container: 8080}},
+		Volume:      &volumes.Volume{Size: 1024, ContainerPath: "data", Mode: volumes.RW},
+		Priority:    10,
+	}
+	ssd := task.Filter{Type: "TEXT", Value: []string{"ssd"}}
+	instance := &manager.Task{Filters: []task.Filter{ssd}}
+	other := &manager.Task{Filters: instance.Filters}
+
+	Set(instance, p)
+	if read := Of(instance); !reflect.DeepEqual(read, p) {
+		t.Fatalf("Expected %+v back, got %+v", p, read)
+	}
+	if len(instance.Filters) != 2 || !reflect.DeepEqual(instance.Filters[0], ssd) {
+		t.Fatalf("Expected the other filters to be left alone, got %v", instance.Filters)
+	}
+	if _, ok := Of(instance).Rank(); !ok || Of(instance).SpreadField() != "rack" {
+		t.Fatal("Expected the task's ranking and spread field")
+	}
+
+	p.Preempted = true
+	Set(instance, p)
+	if len(instance.Filters) != 2 || !Of(instance).Preempted {
+		t.Fatalf("Expected the placement to be replaced, got %v", instance.Filters)
+	}
+	if len(other.Filters) != 1 {
+		t.Fatal("Instances sharing filters shouldn't share a placement change")
+	}
+
+	Set(instance, Placement{})
+	if len(instance.Filters) != 1 || Of(instance).SpreadField() != ZONE {
+		t.Fatalf("Expected an empty placement to be removed, got %v", instance.Filters)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"math/rand"
+	"mesos-framework-sdk/include/mesos_v1"
+	"sort"
+)
+
+const (
+	RANK_BINPACK = "binpack" // Fill the offers with the least left first, keeping large offers free for large tasks.
+	RANK_SPREAD  = "spread"  // Use the offers with the most left first, spreading load evenly.
+	RANK_RANDOM  = "random"  // Use offers in no particular order.
+)
+
+type (
+	// Candidate is an offer a task fits on, along with how much of each scalar resource is left on it.
+	Candidate struct {
+		Offer     *mesos_v1.Offer
+		Remaining map[string]float64
+	}
+
+	// Ranking sorts the candidates so that the one a task should be placed on comes first.
+	// Needs holds how much of each scalar resource the task asks for.
+	Ranking func(candidates []Candidate, needs map[string]float64)
+)
+
+// Every ranking that can be chosen by name.
+var Rankings = map[string]Ranking{
+	RANK_BINPACK: binpack,
+	RANK_SPREAD:  spread,
+	RANK_RANDOM:  shuffle,
+}
+
+func binpack(candidates []Candidate, needs map[string]float64) {
+	scores := leftover(candidates, needs)
+	sort.SliceStable(candidates, func(i, j int) bool { return scores[candidates[i].Offer] < scores[candidates[j].Offer] })
+}
+
+func spread(candidates []Candidate, needs map[string]float64) {
+	scores := leftover(candidates, needs)
+	sort.SliceStable(candidates, func(i, j int) bool { return scores[candidates[i].Offer] > scores[candidates[j].Offer] })
+}
+
+func shuffle(candidates []Candidate, needs map[string]float64) {
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+}
+
+// Scores how much of each candidate would be left after placing the task on it.
+// Every resource the task needs counts the same, so each is measured against the most any candidate has left.
+func leftover(candidates []Candidate, needs map[string]float64) map[*mesos_v1.Offer]float64 {
+	most := make(map[string]float64)
+	for _, c := range candidates {
+		for name := range needs {
+			if c.Remaining[name] > most[name] {
+				most[name] = c.Remaining[name]
+			}
+		}
+	}
+
+	scores := make(map[*mesos_v1.Offer]float64, len(candidates))
+	for _, c := range candidates {
+		for name, amount := range needs {
+			if most[name] > 0 {
+				scores[c.Offer] += (c.Remaining[name] - amount) / most[name]
+			}
+		}
+	}
+
+	return scores
+}
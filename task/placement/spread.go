@@ -0,0 +1,51 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+// Strategy that spreads a group's instances evenly across the values of a field, such as a rack or zone.
+const SPREAD = "spread"
+
+// Balanced tells us if placing an instance on the agent keeps the group spread evenly across the field's values.
+// Only the values of the agents we could place the instance on are compared, so a value nobody is placed on yet is
+// filled before any other value gets another instance, and a value we can't place on doesn't hold the others back.
+// Agents without the field are never used, since we couldn't tell what failure they share with the others.
+func Balanced(field string, agent *Agent, placed, available []*Agent) bool {
+	value, ok := agent.Value(field)
+	if !ok {
+		return false
+	}
+
+	counts := map[string]int{value: 0}
+	for _, a := range available {
+		if v, ok := a.Value(field); ok {
+			counts[v] += 0
+		}
+	}
+	for _, p := range placed {
+		if v, ok := p.Value(field); ok {
+			if _, compared := counts[v]; compared {
+				counts[v]++
+			}
+		}
+	}
+
+	for _, n := range counts {
+		if n < counts[value] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package placement
+
+import (
+	"testing"
+)
+
+func zoned(hostname, zone string) *Agent {
+	return &Agent{ID: hostname, Hostname: hostname, Zone: zone, Attributes: map[string]string{}}
+}
+
+func TestBalanced(t *testing.T) {
+	a1, a2, b1, c1, none := zoned("a1", "a"), zoned("a2", "a"), zoned("b1", "b"), zoned("c1", "c"), zoned("x1", "")
+
+	tests := []struct {
+		name      string
+		agent     *Agent
+		placed    []*Agent
+		available []*Agent
+		expected  bool
+	}{
+		{"nothing placed", a1, nil, []*Agent{a1, b1}, true},
+		{"empty zone offered", a2, []*Agent{a1}, []*Agent{a2, b1}, false},
+		{"fill empty zone", b1, []*Agent{a1}, []*Agent{a2, b1}, true},
+		{"zones even", a2, []*Agent{a1, b1}, []*Agent{a2}, true},
+		{"zone ahead", a2, []*Agent{a1, a2, b1}, []*Agent{a2, b1}, false},
+		{"only another zone offered", c1, []*Agent{a1}, []*Agent{c1}, true},
+		{"only the fuller zone offered", a2, []*Agent{a1}, []*Agent{a2}, true},
+		{"emptier zone can't be placed on", a2, []*Agent{a1, a2, c1}, []*Agent{a2}, true},
+		{"no zone", none, nil, []*Agent{none}, false},
+	}
+
+	for _, test := range tests {
+		if actual := Balanced(ZONE, test.agent, test.placed, test.available); actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
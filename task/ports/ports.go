@@ -0,0 +1,97 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ports
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Name of the offer resource host ports are allocated from.
+	RESOURCE = "ports"
+)
+
+// Port names end up in environment variables, so they're kept to what a variable name can hold.
+var validName = regexp.MustCompile("^[A-Za-z0-9_-]*$")
+
+// Port is a host port requested by an application.
+// A host port of 0 means any free port in the offer will do.
+// A container port maps the host port into the container's network.
+type Port struct {
+	Name      string `json:"name,omitempty"`
+	Protocol  string `json:"protocol"`
+	Host      uint32 `json:"host,omitempty"`
+	Container uint32 `json:"container,omitempty"`
+}
+
+// Makes sure the ports can be requested together.
+// Names and fixed host ports have to be unique, protocols default to tcp.
+func Validate(requested []Port) ([]Port, error) {
+	names := make(map[string]bool)
+	hosts := make(map[uint32]bool)
+	valid := make([]Port, 0, len(requested))
+	for _, p := range requested {
+		p.Protocol = strings.ToLower(p.Protocol)
+		if p.Protocol == "" {
+			p.Protocol = "tcp"
+		}
+		if p.Protocol != "tcp" && p.Protocol != "udp" {
+			return nil, errors.New("Port protocols must be tcp or udp, not " + p.Protocol)
+		}
+
+		if !validName.MatchString(p.Name) {
+			return nil, errors.New("Port names can only hold letters, digits, dashes and underscores")
+		}
+		if p.Name != "" {
+			if names[strings.ToUpper(p.Name)] {
+				return nil, errors.New("Port " + p.Name + " is requested more than once")
+			}
+			names[strings.ToUpper(p.Name)] = true
+		}
+
+		if p.Host != 0 {
+			if hosts[p.Host] {
+				return nil, errors.New("Host port " + strconv.FormatUint(uint64(p.Host), 10) + " is requested more than once")
+			}
+			hosts[p.Host] = true
+		}
+
+		valid = append(valid, p)
+	}
+
+	return valid, nil
+}
+
+// Environment variables telling the task which host ports it got.
+// Every port is available as PORTn in the order requested, and named ports as PORT_NAME as well.
+// PORT holds the first port, like Marathon does.
+func Environment(requested []Port, allocated []uint32) map[string]string {
+	env := make(map[string]string)
+	for i, p := range requested {
+		value := strconv.FormatUint(uint64(allocated[i]), 10)
+		env["PORT"+strconv.Itoa(i)] = value
+		if p.Name != "" {
+			env["PORT_"+strings.ToUpper(strings.Replace(p.Name, "-", "_", -1))] = value
+		}
+	}
+	if len(allocated) > 0 {
+		env["PORT"] = strconv.FormatUint(uint64(allocated[0]), 10)
+	}
+
+	return env
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ports
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid, err := Validate([]Port{{Name: "http"}, {Name: "admin-ui", Host: 9000, Protocol: "UDP"}, {}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if valid[0].Protocol != "tcp" || valid[1].Protocol != "udp" {
+		t.Fatalf("Expected protocols to default to tcp and be lower cased, got %v", valid)
+	}
+
+	invalid := [][]Port{
+		{{Protocol: "sctp"}},
+		{{Name: "http port"}},
+		{{Name: "http"}, {Name: "HTTP"}},
+		{{Host: 9000}, {Host: 9000}},
+	}
+	for _, requested := range invalid {
+		if _, err := Validate(requested); err == nil {
+			t.Errorf("Expected %v to be invalid", requested)
+		}
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	env := Environment([]Port{{Name: "admin-ui"}, {}}, []uint32{31000, 31001})
+	expected := map[string]string{"PORT": "31000", "PORT0": "31000", "PORT1": "31001", "PORT_ADMIN_UI": "31000"}
+	if len(env) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, env)
+	}
+	for name, value := range expected {
+		if env[name] != value {
+			t.Errorf("Expected %s to be %s, got %s", name, value, env[name])
+		}
+	}
+}
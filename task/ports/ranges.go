@@ -0,0 +1,138 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ports
+
+import (
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/utils"
+	"sort"
+)
+
+type (
+	// Range of ports, both ends included.
+	Range struct {
+		Begin uint64
+		End   uint64
+	}
+
+	// Ranges holds ports that haven't been given out yet, sorted and without overlaps.
+	Ranges []Range
+)
+
+// Reads the port ranges held in the resources.
+func FromResources(res []*mesos_v1.Resource) Ranges {
+	r := Ranges{}
+	for _, resource := range res {
+		if resource.GetName() != RESOURCE || resource.GetType() != mesos_v1.Value_RANGES {
+			continue
+		}
+		for _, v := range resource.GetRanges().GetRange() {
+			// Port 0 is never handed out, it stands for any port.
+			begin := v.GetBegin()
+			if begin == 0 {
+				begin = 1
+			}
+			if begin <= v.GetEnd() {
+				r = append(r, Range{Begin: begin, End: v.GetEnd()})
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Begin < r[j].Begin })
+
+	return r
+}
+
+// Tells us if the port is free.
+func (r Ranges) Contains(port uint64) bool {
+	for _, v := range r {
+		if port >= v.Begin && port <= v.End {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the ranges without the port.
+func (r Ranges) Remove(port uint64) Ranges {
+	left := make(Ranges, 0, len(r)+1)
+	for _, v := range r {
+		if port < v.Begin || port > v.End {
+			left = append(left, v)
+			continue
+		}
+		if port > v.Begin {
+			left = append(left, Range{Begin: v.Begin, End: port - 1})
+		}
+		if port < v.End {
+			left = append(left, Range{Begin: port + 1, End: v.End})
+		}
+	}
+
+	return left
+}
+
+// Picks a host port for every requested port, returning them along with the ranges that are left.
+// Fixed ports have to be free, any other port gets the lowest free one.
+// False means the ranges can't satisfy every request.
+func Allocate(r Ranges, requested []Port) ([]uint32, Ranges, bool) {
+	allocated := make([]uint32, len(requested))
+
+	for i, p := range requested {
+		if p.Host == 0 {
+			continue
+		}
+		if !r.Contains(uint64(p.Host)) {
+			return nil, nil, false
+		}
+		allocated[i] = p.Host
+		r = r.Remove(uint64(p.Host))
+	}
+
+	for i, p := range requested {
+		if p.Host != 0 {
+			continue
+		}
+		if len(r) == 0 || r[0].Begin > uint64(^uint32(0)) {
+			return nil, nil, false
+		}
+		allocated[i] = uint32(r[0].Begin)
+		r = r.Remove(r[0].Begin)
+	}
+
+	return allocated, r, true
+}
+
+// Resource claiming the allocated ports.
+func Resource(allocated []uint32) *mesos_v1.Resource {
+	sorted := append([]uint32(nil), allocated...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ranges := []*mesos_v1.Value_Range{}
+	for _, p := range sorted {
+		begin, end := uint64(p), uint64(p)
+		if len(ranges) > 0 && ranges[len(ranges)-1].GetEnd()+1 == begin {
+			ranges[len(ranges)-1].End = &end
+			continue
+		}
+		ranges = append(ranges, &mesos_v1.Value_Range{Begin: &begin, End: &end})
+	}
+
+	return &mesos_v1.Resource{
+		Name:   utils.ProtoString(RESOURCE),
+		Type:   mesos_v1.Value_RANGES.Enum(),
+		Ranges: &mesos_v1.Value_Ranges{Range: ranges},
+	}
+}
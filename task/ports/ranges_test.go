@@ -0,0 +1,81 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ports
+
+import (
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/utils"
+	"reflect"
+	"testing"
+)
+
+func portsResource(ranges ...Range) *mesos_v1.Resource {
+	r := &mesos_v1.Resource{
+		Name:   utils.ProtoString(RESOURCE),
+		Type:   mesos_v1.Value_RANGES.Enum(),
+		Ranges: &mesos_v1.Value_Ranges{},
+	}
+	for _, v := range ranges {
+		begin, end := v.Begin, v.End
+		r.Ranges.Range = append(r.Ranges.Range, &mesos_v1.Value_Range{Begin: &begin, End: &end})
+	}
+
+	return r
+}
+
+func TestRanges_Remove(t *testing.T) {
+	r := FromResources([]*mesos_v1.Resource{portsResource(Range{31005, 31010}, Range{0, 3})})
+	if !reflect.DeepEqual(r, Ranges{{1, 3}, {31005, 31010}}) {
+		t.Fatalf("Expected sorted ranges without port 0, got %v", r)
+	}
+
+	r = r.Remove(31007).Remove(1).Remove(3)
+	if !reflect.DeepEqual(r, Ranges{{2, 2}, {31005, 31006}, {31008, 31010}}) {
+		t.Fatalf("Unexpected ranges %v", r)
+	}
+	if r.Contains(31007) || !r.Contains(31008) {
+		t.Fatal("Expected only the removed ports to be gone")
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	r := Ranges{{31000, 31002}}
+
+	tests := []struct {
+		requested []Port
+		expected  []uint32
+		ok        bool
+	}{
+		{[]Port{{}, {}}, []uint32{31000, 31001}, true},
+		{[]Port{{}, {Host: 31000}}, []uint32{31001, 31000}, true},
+		{[]Port{{Host: 30000}}, nil, false},
+		{[]Port{{}, {}, {}, {}}, nil, false},
+	}
+
+	for i, test := range tests {
+		allocated, _, ok := Allocate(r, test.requested)
+		if ok != test.ok || !reflect.DeepEqual(allocated, test.expected) {
+			t.Errorf("%d: expected %v, got %v", i, test.expected, allocated)
+		}
+	}
+}
+
+// Allocated ports are claimed with as few ranges as possible.
+func TestResource(t *testing.T) {
+	r := FromResources([]*mesos_v1.Resource{Resource([]uint32{31002, 31000, 31001, 31005})})
+	if !reflect.DeepEqual(r, Ranges{{31000, 31002}, {31005, 31005}}) {
+		t.Fatalf("Unexpected ranges %v", r)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"hydrogen/task/placement"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task/manager"
+	"sort"
+)
+
+// The task's priority, tasks that don't have one are 0.
+func Of(t *manager.Task) int {
+	return placement.Of(t).Priority
+}
+
+// Marks the task as killed to make room for another, so it's queued again rather than deleted once it's gone.
+func MarkPreempted(t *manager.Task) {
+	p := placement.Of(t)
+	if !p.Preempted {
+		p.Preempted = true
+		placement.Set(t, p)
+	}
+}
+
+// Tells us if the task has been preempted.
+func Preempted(t *manager.Task) bool {
+	return placement.Of(t).Preempted
+}
+
+// Removes the mark left by MarkPreempted.
+func ClearPreempted(t *manager.Task) {
+	p := placement.Of(t)
+	if p.Preempted {
+		p.Preempted = false
+		placement.Set(t, p)
+	}
+}
+
+// Victims picks the running tasks that have to be killed to make room for the task, all of them on the same agent.
+// Only tasks of a lower priority on agents the function finds suitable are picked, lowest priority first, and the agent
+// that needs the fewest of them wins. Whatever else is free on an agent isn't counted.
+// Returns nil if no agent can make enough room.
+func Victims(t *manager.Task, running []*manager.Task, suitable func(agent string) bool) []*manager.Task {
+	p := Of(t)
+	needs := scalars(t.Info.GetResources())
+
+	byAgent := make(map[string][]*manager.Task)
+	for _, r := range running {
+		agent := r.Info.GetAgentId().GetValue()
+		if Of(r) >= p || Preempted(r) || agent == "" {
+			continue
+		}
+		byAgent[agent] = append(byAgent[agent], r)
+	}
+
+	agents := make([]string, 0, len(byAgent))
+	for agent := range byAgent {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+
+	var victims []*manager.Task
+	for _, agent := range agents {
+		if !suitable(agent) {
+			continue
+		}
+
+		candidates := byAgent[agent]
+		sort.SliceStable(candidates, func(i, j int) bool { return Of(candidates[i]) < Of(candidates[j]) })
+
+		freed := make(map[string]float64)
+		chosen := []*manager.Task{}
+		for _, c := range candidates {
+			chosen = append(chosen, c)
+			for name, amount := range scalars(c.Info.GetResources()) {
+				freed[name] += amount
+			}
+			if fits(freed, needs) {
+				break
+			}
+		}
+
+		if fits(freed, needs) && (victims == nil || len(chosen) < len(victims)) {
+			victims = chosen
+		}
+	}
+
+	return victims
+}
+
+// Totals the scalar resources by name, leaving out those reserved for a single task.
+func scalars(res []*mesos_v1.Resource) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, r := range res {
+		if r.GetType() == mesos_v1.Value_SCALAR && r.GetReservation() == nil {
+			totals[r.GetName()] += r.GetScalar().GetValue()
+		}
+	}
+
+	return totals
+}
+
+// Tells us if what's available covers every need.
+func fits(available, needs map[string]float64) bool {
+	for name, amount := range needs {
+		if available[name] < amount {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"hydrogen/task/placement"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
+	"reflect"
+	"testing"
+)
+
+func newTask(name string, p int, cpus float64, agent string) *manager.Task {
+	t := &manager.Task{
+		Info: &mesos_v1.TaskInfo{
+			Name: utils.ProtoString(name),
+			Resources: []*mesos_v1.Resource{{
+				Name:   utils.ProtoString("cpus"),
+				Type:   mesos_v1.Value_SCALAR.Enum(),
+				Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(cpus)},
+			}},
+		},
+		Filters: []task.Filter{{Type: "TEXT", Value: []string{"ssd"}}, placement.Placement{Priority: p}.Filter()},
+	}
+	if agent != "" {
+		t.Info.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString(agent)}
+	}
+
+	return t
+}
+
+func names(tasks []*manager.Task) []string {
+	n := []string{}
+	for _, t := range tasks {
+		n = append(n, t.Info.GetName())
+	}
+
+	return n
+}
+
+func TestPreempted(t *testing.T) {
+	task := newTask("a", 5, 1, "")
+
+	MarkPreempted(task)
+	MarkPreempted(task)
+	if !Preempted(task) || len(task.Filters) != 2 {
+		t.Fatalf("Expected the task to be marked once, got %v", task.Filters)
+	}
+
+	ClearPreempted(task)
+	if Preempted(task) || Of(task) != 5 || len(task.Filters) != 2 {
+		t.Fatalf("Expected only the mark to be removed, got %v", task.Filters)
+	}
+}
+
+func TestVictims(t *testing.T) {
+	preempted := newTask("preempted", -10, 4, "a")
+	MarkPreempted(preempted)
+	running := []*manager.Task{
+		newTask("a-low", -1, 2, "a"),
+		newTask("a-lowest", -2, 1, "a"),
+		newTask("a-high", 20, 4, "a"),
+		newTask("b-low", 0, 4, "b"),
+		newTask("c-low", 0, 1, "c"),
+		newTask("unplaced", -1, 8, ""),
+		preempted,
+	}
+	all := func(string) bool { return true }
+
+	tests := []struct {
+		name     string
+		task     *manager.Task
+		suitable func(string) bool
+		victims  []string
+	}{
+		{"fewest victims", newTask("web", 10, 3, ""), all, []string{"b-low"}},
+		{"lowest priority first", newTask("web", 10, 3, ""), func(a string) bool { return a == "a" }, []string{"a-lowest", "a-low"}},
+		{"only lower priorities", newTask("web", 0, 2, ""), all, []string{"a-lowest", "a-low"}},
+		{"nowhere has room", newTask("web", 10, 5, ""), all, nil},
+		{"nothing suitable", newTask("web", 10, 1, ""), func(string) bool { return false }, nil},
+	}
+
+	for _, test := range tests {
+		victims := Victims(test.task, running, test.suitable)
+		if test.victims == nil {
+			if victims != nil {
+				t.Errorf("%s: expected no victims, got %v", test.name, names(victims))
+			}
+			continue
+		}
+		if got := names(victims); !reflect.DeepEqual(got, test.victims) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.victims, got)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"hydrogen/task/priority"
+	"mesos-framework-sdk/task/manager"
+	"sort"
+	"strings"
+	"time"
+)
+
+// App describes the instances of one application waiting to be launched.
+type App struct {
+	Name     string
+	Priority int
+	Queued   int
+	Since    time.Time // When the instance that's waited the longest was queued.
+}
+
+// The queued instances of an application, along with its summary.
+type app struct {
+	App
+	tasks []*manager.Task
+}
+
+// Name of the application the task belongs to, which is the task itself unless it's an instance of a group.
+func Name(t *manager.Task) string {
+	if t.GroupInfo.InGroup {
+		return strings.TrimSuffix(t.GroupInfo.GroupName, "/")
+	}
+
+	return t.Info.GetName()
+}
+
+// Order arranges queued tasks in the order they should be launched, given when each of them was queued.
+// Higher priorities come first. Within a priority applications take turns, one instance each, starting with the one
+// that's waited the longest, so an application with many instances can't keep one with a few waiting.
+func Order(tasks []*manager.Task, since map[string]time.Time) []*manager.Task {
+	apps := group(tasks, since)
+
+	ordered := make([]*manager.Task, 0, len(tasks))
+	for i := 0; i < len(apps); {
+		j := i
+		for j < len(apps) && apps[j].Priority == apps[i].Priority {
+			j++
+		}
+
+		for turn := 0; ; turn++ {
+			added := false
+			for _, a := range apps[i:j] {
+				if turn < len(a.tasks) {
+					ordered = append(ordered, a.tasks[turn])
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+		i = j
+	}
+
+	return ordered
+}
+
+// Summarize describes the applications with queued tasks, in the order they're launched in.
+func Summarize(tasks []*manager.Task, since map[string]time.Time) []App {
+	apps := group(tasks, since)
+
+	summary := make([]App, 0, len(apps))
+	for _, a := range apps {
+		summary = append(summary, a.App)
+	}
+
+	return summary
+}
+
+// Groups the tasks by application, ordering instances by how long they've waited and applications by priority and
+// then by how long they've waited.
+func group(tasks []*manager.Task, since map[string]time.Time) []*app {
+	byName := make(map[string]*app)
+	apps := []*app{}
+	for _, t := range tasks {
+		name := Name(t)
+		a, ok := byName[name]
+		if !ok {
+			a = &app{App: App{Name: name, Priority: priority.Of(t)}}
+			byName[name] = a
+			apps = append(apps, a)
+		}
+
+		if p := priority.Of(t); p > a.Priority {
+			a.Priority = p
+		}
+		if s := since[t.Info.GetName()]; a.Queued == 0 || s.Before(a.Since) {
+			a.Since = s
+		}
+		a.Queued++
+		a.tasks = append(a.tasks, t)
+	}
+
+	for _, a := range apps {
+		tasks := a.tasks
+		sort.SliceStable(tasks, func(i, j int) bool {
+			si, sj := since[tasks[i].Info.GetName()], since[tasks[j].Info.GetName()]
+			if !si.Equal(sj) {
+				return si.Before(sj)
+			}
+			return tasks[i].Info.GetName() < tasks[j].Info.GetName()
+		})
+	}
+
+	sort.SliceStable(apps, func(i, j int) bool {
+		if apps[i].Priority != apps[j].Priority {
+			return apps[i].Priority > apps[j].Priority
+		}
+		if !apps[i].Since.Equal(apps[j].Since) {
+			return apps[i].Since.Before(apps[j].Since)
+		}
+		return apps[i].Name < apps[j].Name
+	})
+
+	return apps
+}
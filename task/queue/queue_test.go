@@ -0,0 +1,89 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queue
+
+import (
+	"hydrogen/task/placement"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/task"
+	"mesos-framework-sdk/task/manager"
+	"mesos-framework-sdk/utils"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Queues instances of an application, all of them at the same time.
+func instances(app string, n, p int, at time.Time, since map[string]time.Time) []*manager.Task {
+	tasks := []*manager.Task{}
+	for i := 1; i <= n; i++ {
+		t := &manager.Task{
+			Info:    &mesos_v1.TaskInfo{Name: utils.ProtoString(app + "-" + strconv.Itoa(i))},
+			Filters: []task.Filter{placement.Placement{Priority: p}.Filter()},
+		}
+		if n > 1 {
+			t.GroupInfo = manager.GroupInfo{GroupName: app + "/", InGroup: true}
+		} else {
+			t.Info.Name = utils.ProtoString(app)
+		}
+		since[t.Info.GetName()] = at
+		tasks = append(tasks, t)
+	}
+
+	return tasks
+}
+
+func names(tasks []*manager.Task) []string {
+	n := []string{}
+	for _, t := range tasks {
+		n = append(n, t.Info.GetName())
+	}
+
+	return n
+}
+
+func TestOrder(t *testing.T) {
+	now := time.Now()
+	since := make(map[string]time.Time)
+
+	tasks := instances("big", 4, 0, now.Add(-time.Hour), since)
+	tasks = append(tasks, instances("small", 1, 0, now, since)...)
+	tasks = append(tasks, instances("mid", 2, 0, now.Add(-time.Minute), since)...)
+	tasks = append(tasks, instances("urgent", 1, 10, now, since)...)
+	tasks = append(tasks, instances("batch", 1, -1, now.Add(-2*time.Hour), since)...)
+
+	expected := []string{"urgent", "big-1", "mid-1", "small", "big-2", "mid-2", "big-3", "big-4", "batch"}
+	if got := names(Order(tasks, since)); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected applications to take turns within a priority, got %v", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Now()
+	since := make(map[string]time.Time)
+
+	tasks := instances("web", 3, 0, now, since)
+	since["web-2"] = now.Add(-time.Minute)
+	tasks = append(tasks, instances("db", 1, 5, now, since)...)
+
+	expected := []App{
+		{Name: "db", Priority: 5, Queued: 1, Since: now},
+		{Name: "web", Priority: 0, Queued: 3, Since: now.Add(-time.Minute)},
+	}
+	if got := Summarize(tasks, since); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, got)
+	}
+}
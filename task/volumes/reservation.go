@@ -0,0 +1,385 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volumes
+
+import (
+	"encoding/json"
+	"hydrogen/task/persistence"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Where we remember what we've reserved.
+	RESERVATION_DIRECTORY = "/reservations/"
+
+	// Reservations are labelled with the task they were made for.
+	TASK_LABEL = "task"
+)
+
+type (
+	// Reservation is what we've reserved on an agent for a task with a persistent volume.
+	// The task is always launched on that agent with what's reserved, so that it finds its data again.
+	Reservation struct {
+		Task          string             `json:"task"`
+		AgentID       string             `json:"agent_id"`
+		PersistenceID string             `json:"persistence_id"`
+		Role          string             `json:"role"`
+		Principal     string             `json:"principal"`
+		Resources     map[string]float64 `json:"resources"` // What the task uses besides the volume.
+		Volume        Volume             `json:"volume"`
+		Released      bool               `json:"released,omitempty"` // The task's been deleted, so its volume is to be destroyed.
+		ReleasedAt    time.Time          `json:"released_at"`
+	}
+
+	// Reservations remembers every reservation we've made, so a new leader knows where volumes are.
+	// Reservations are written as soon as they change, since they have to be persisted before we act on them.
+	Reservations struct {
+		mutex        sync.Mutex
+		reservations map[string]*Reservation
+		loaded       bool
+		storage      persistence.Storage
+	}
+)
+
+// Returns a reservation for the task's scalar resources and its volume, which has yet to be placed on an agent.
+func New(name, role, principal string, res []*mesos_v1.Resource, v Volume) *Reservation {
+	r := &Reservation{
+		Task:          name,
+		PersistenceID: name + "#" + utils.UuidAsString(),
+		Role:          role,
+		Principal:     principal,
+		Resources:     make(map[string]float64),
+		Volume:        v,
+	}
+	for _, res := range res {
+		if res.GetType() == mesos_v1.Value_SCALAR {
+			r.Resources[res.GetName()] += res.GetScalar().GetValue()
+		}
+	}
+
+	return r
+}
+
+// What has to be reserved out of an offer, with the volume's size added to the disk the task uses.
+func (r *Reservation) Needs() []*mesos_v1.Resource {
+	return r.resources(r.totals(), false)
+}
+
+// Everything the reservation holds, before or after the volume has been created out of it.
+func (r *Reservation) Reserved() []*mesos_v1.Resource {
+	return r.resources(r.totals(), true)
+}
+
+// What the task is launched with, its reserved resources along with the volume.
+func (r *Reservation) Launched() []*mesos_v1.Resource {
+	return append(r.resources(r.Resources, true), r.Disk())
+}
+
+// The persistent volume.
+func (r *Reservation) Disk() *mesos_v1.Resource {
+	disk := r.resource(DISK, r.Volume.Size, true)
+	mode := mesos_v1.Volume_RW
+	if r.Volume.Mode == RO {
+		mode = mesos_v1.Volume_RO
+	}
+	disk.Disk = &mesos_v1.Resource_DiskInfo{
+		Persistence: &mesos_v1.Resource_DiskInfo_Persistence{
+			Id:        utils.ProtoString(r.PersistenceID),
+			Principal: utils.ProtoString(r.Principal),
+		},
+		Volume: &mesos_v1.Volume{
+			Mode:          mode.Enum(),
+			ContainerPath: utils.ProtoString(r.Volume.ContainerPath),
+		},
+	}
+
+	return disk
+}
+
+// Tells us if the offer holds the volume, which means the task can be launched on it as is.
+func (r *Reservation) Holds(offer *mesos_v1.Offer) bool {
+	if offer.GetAgentId().GetValue() != r.AgentID {
+		return false
+	}
+
+	for _, res := range offer.GetResources() {
+		if res.GetDisk().GetPersistence().GetId() == r.PersistenceID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Operation reserving what the task needs.
+func (r *Reservation) Reserve() *mesos_v1.Offer_Operation {
+	return &mesos_v1.Offer_Operation{
+		Type:    mesos_v1.Offer_Operation_RESERVE.Enum(),
+		Reserve: &mesos_v1.Offer_Operation_Reserve{Resources: r.Reserved()},
+	}
+}
+
+// Operation creating the volume out of the reserved disk.
+func (r *Reservation) Create() *mesos_v1.Offer_Operation {
+	return &mesos_v1.Offer_Operation{
+		Type:   mesos_v1.Offer_Operation_CREATE.Enum(),
+		Create: &mesos_v1.Offer_Operation_Create{Volumes: []*mesos_v1.Resource{r.Disk()}},
+	}
+}
+
+// Operation destroying the volume along with its data.
+func (r *Reservation) Destroy() *mesos_v1.Offer_Operation {
+	return &mesos_v1.Offer_Operation{
+		Type:    mesos_v1.Offer_Operation_DESTROY.Enum(),
+		Destroy: &mesos_v1.Offer_Operation_Destroy{Volumes: []*mesos_v1.Resource{r.Disk()}},
+	}
+}
+
+// Operation giving back everything we reserved, once the volume's been destroyed.
+func (r *Reservation) Unreserve() *mesos_v1.Offer_Operation {
+	return &mesos_v1.Offer_Operation{
+		Type:      mesos_v1.Offer_Operation_UNRESERVE.Enum(),
+		Unreserve: &mesos_v1.Offer_Operation_Unreserve{Resources: r.Reserved()},
+	}
+}
+
+// The task's resources with the volume's size added to its disk.
+func (r *Reservation) totals() map[string]float64 {
+	totals := make(map[string]float64, len(r.Resources)+1)
+	for name, amount := range r.Resources {
+		totals[name] = amount
+	}
+	totals[DISK] += r.Volume.Size
+
+	return totals
+}
+
+// Scalar resources for the amounts, ordered by name.
+func (r *Reservation) resources(amounts map[string]float64, reserved bool) []*mesos_v1.Resource {
+	names := make([]string, 0, len(amounts))
+	for name, amount := range amounts {
+		if amount > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	res := make([]*mesos_v1.Resource, 0, len(names)+1)
+	for _, name := range names {
+		res = append(res, r.resource(name, amounts[name], reserved))
+	}
+
+	return res
+}
+
+func (r *Reservation) resource(name string, amount float64, reserved bool) *mesos_v1.Resource {
+	res := &mesos_v1.Resource{
+		Name:   utils.ProtoString(name),
+		Type:   mesos_v1.Value_SCALAR.Enum(),
+		Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(amount)},
+	}
+	if reserved {
+		res.Role = utils.ProtoString(r.Role)
+		res.Reservation = &mesos_v1.Resource_ReservationInfo{
+			Principal: utils.ProtoString(r.Principal),
+			Labels: &mesos_v1.Labels{Labels: []*mesos_v1.Label{
+				{Key: utils.ProtoString(TASK_LABEL), Value: utils.ProtoString(r.Task)},
+			}},
+		}
+	}
+
+	return res
+}
+
+// Returns an empty set of reservations, persisted in the given storage.
+func NewReservations(s persistence.Storage) *Reservations {
+	return &Reservations{
+		reservations: make(map[string]*Reservation),
+		storage:      s,
+	}
+}
+
+// A copy of the reservation made for the task, or nil if there isn't one.
+func (r *Reservations) Get(name string) (*Reservation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	res, ok := r.reservations[name]
+	if !ok {
+		return nil, nil
+	}
+	copied := *res
+
+	return &copied, nil
+}
+
+// Persists the reservation, replacing any made earlier for the same task.
+func (r *Reservations) Add(res *Reservation) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+	copied := *res
+
+	return r.put(&copied)
+}
+
+// Marks the task's volume to be destroyed and its resources unreserved, if it has one.
+func (r *Reservations) Release(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return err
+	}
+
+	res, ok := r.reservations[name]
+	if !ok || res.Released {
+		return nil
+	}
+
+	released := *res
+	released.Released = true
+	released.ReleasedAt = time.Now()
+
+	return r.put(&released)
+}
+
+// Reservations whose volumes are waiting to be destroyed, ordered by task.
+func (r *Reservations) Released() ([]*Reservation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	released := []*Reservation{}
+	for _, res := range r.reservations {
+		if res.Released {
+			released = append(released, res)
+		}
+	}
+	sort.Slice(released, func(i, j int) bool { return released[i].Task < released[j].Task })
+
+	return released, nil
+}
+
+// Forgets reservations that have waited longer than the timeout to be destroyed, returning them.
+// The volume may never have been made, or its agent may be gone, and we'd otherwise keep asking for offers for it.
+func (r *Reservations) Expire(timeout time.Duration) ([]*Reservation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	expired := []*Reservation{}
+	for name, res := range r.reservations {
+		if !res.Released || time.Since(res.ReleasedAt) < timeout {
+			continue
+		}
+
+		err := r.storage.RunPolicy(r.storage.CheckPolicy(nil), func() error {
+			return r.storage.Delete(RESERVATION_DIRECTORY + name)
+		})
+		if err != nil {
+			return expired, err
+		}
+		delete(r.reservations, name)
+		expired = append(expired, res)
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Task < expired[j].Task })
+
+	return expired, nil
+}
+
+// Forgets the task's reservation once it's been given back.
+func (r *Reservations) Remove(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := r.storage.RunPolicy(r.storage.CheckPolicy(nil), func() error {
+		return r.storage.Delete(RESERVATION_DIRECTORY + name)
+	})
+	if err != nil {
+		return err
+	}
+	delete(r.reservations, name)
+
+	return nil
+}
+
+// Writes the reservation before remembering it, the caller must hold the lock.
+func (r *Reservations) put(res *Reservation) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	err = r.storage.RunPolicy(r.storage.CheckPolicy(nil), func() error {
+		return r.storage.Update(RESERVATION_DIRECTORY+res.Task, string(data))
+	})
+	if err != nil {
+		return err
+	}
+	r.reservations[res.Task] = res
+
+	return nil
+}
+
+// Reads every persisted reservation the first time we're called, the caller must hold the lock.
+func (r *Reservations) load() error {
+	if r.loaded {
+		return nil
+	}
+
+	var values map[string]string
+	err := r.storage.RunPolicy(r.storage.CheckPolicy(nil), func() (err error) {
+		values, err = r.storage.ReadAll(RESERVATION_DIRECTORY)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		res := new(Reservation)
+		if err := json.Unmarshal([]byte(value), res); err != nil || res.Task == "" {
+			continue
+		}
+		if res.Resources == nil {
+			res.Resources = make(map[string]float64)
+		}
+		if res.Released && res.ReleasedAt.IsZero() {
+			res.ReleasedAt = time.Now() // Released before we kept track of when, so it's given the whole timeout from now.
+		}
+		r.reservations[res.Task] = res
+	}
+	r.loaded = true
+
+	return nil
+}
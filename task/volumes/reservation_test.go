@@ -0,0 +1,173 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volumes
+
+import (
+	"hydrogen/task/persistence"
+	"hydrogen/task/persistence/drivers/memory"
+	"mesos-framework-sdk/include/mesos_v1"
+	"mesos-framework-sdk/utils"
+	"testing"
+	"time"
+)
+
+func scalar(name string, amount float64) *mesos_v1.Resource {
+	return &mesos_v1.Resource{
+		Name:   utils.ProtoString(name),
+		Type:   mesos_v1.Value_SCALAR.Enum(),
+		Scalar: &mesos_v1.Value_Scalar{Value: utils.ProtoFloat64(amount)},
+	}
+}
+
+func newReservation() *Reservation {
+	return New("db-1", "db", "hydrogen", []*mesos_v1.Resource{scalar("cpus", 1), scalar("mem", 256), scalar("disk", 100)},
+		Volume{Size: 1024, ContainerPath: "data", Mode: RW})
+}
+
+// The volume's disk is reserved along with the task's own resources, and carved out of them when launching.
+func TestReservation_Resources(t *testing.T) {
+	r := newReservation()
+
+	needs := r.Needs()
+	if len(needs) != 3 || needs[1].GetName() != "disk" || needs[1].GetScalar().GetValue() != 1124 {
+		t.Fatalf("Expected cpus, disk and mem with the volume's disk added, got %v", needs)
+	}
+	for _, res := range needs {
+		if res.GetReservation() != nil {
+			t.Fatal("What's needed out of an offer shouldn't be reserved yet")
+		}
+	}
+
+	for _, res := range r.Reserved() {
+		if res.GetRole() != "db" || res.GetReservation().GetPrincipal() != "hydrogen" {
+			t.Fatalf("Expected every resource to be reserved for our role and principal, got %v", res)
+		}
+		if label := res.GetReservation().GetLabels().GetLabels()[0]; label.GetValue() != "db-1" {
+			t.Fatalf("Expected the reservation to be labelled with its task, got %v", label)
+		}
+	}
+
+	launched := r.Launched()
+	if len(launched) != 4 || launched[1].GetScalar().GetValue() != 100 {
+		t.Fatalf("Expected the task's own disk to be launched apart from the volume, got %v", launched)
+	}
+	if volume := launched[3]; volume.GetDisk().GetPersistence().GetId() != r.PersistenceID || volume.GetScalar().GetValue() != 1024 {
+		t.Fatalf("Expected the task to be launched with its volume, got %v", volume)
+	}
+
+	operations := []*mesos_v1.Offer_Operation{r.Reserve(), r.Create(), r.Destroy(), r.Unreserve()}
+	types := []mesos_v1.Offer_Operation_Type{
+		mesos_v1.Offer_Operation_RESERVE,
+		mesos_v1.Offer_Operation_CREATE,
+		mesos_v1.Offer_Operation_DESTROY,
+		mesos_v1.Offer_Operation_UNRESERVE,
+	}
+	for i, op := range operations {
+		if op.GetType() != types[i] {
+			t.Errorf("Expected operation %d to be %v, got %v", i, types[i], op.GetType())
+		}
+	}
+}
+
+// Only an offer from the reservation's agent with the volume in it holds it.
+func TestReservation_Holds(t *testing.T) {
+	r := newReservation()
+	r.AgentID = "a"
+
+	offer := &mesos_v1.Offer{
+		AgentId:   &mesos_v1.AgentID{Value: utils.ProtoString("a")},
+		Resources: []*mesos_v1.Resource{scalar("cpus", 4)},
+	}
+	if r.Holds(offer) {
+		t.Fatal("The offer doesn't have the volume in it")
+	}
+
+	offer.Resources = append(offer.Resources, r.Disk())
+	if !r.Holds(offer) {
+		t.Fatal("Expected the offer to hold the volume")
+	}
+
+	offer.AgentId = &mesos_v1.AgentID{Value: utils.ProtoString("b")}
+	if r.Holds(offer) {
+		t.Fatal("The volume can't be on another agent")
+	}
+}
+
+// Reservations are read back by a new leader, including those waiting to be released.
+func TestReservations_Persisted(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	reservations := NewReservations(storage)
+
+	r := newReservation()
+	r.AgentID = "a"
+	if err := reservations.Add(r); err != nil {
+		t.Fatal(err.Error())
+	}
+	other := New("db-2", "db", "hydrogen", nil, Volume{Size: 1, ContainerPath: "data", Mode: RW})
+	if err := reservations.Add(other); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := reservations.Release("db-1"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	restored := NewReservations(storage)
+	read, err := restored.Get("db-1")
+	if err != nil || read == nil || read.AgentID != "a" || read.Resources["mem"] != 256 || !read.Released {
+		t.Fatalf("Expected the released reservation to be read back, got %+v: %v", read, err)
+	}
+	released, err := restored.Released()
+	if err != nil || len(released) != 1 || released[0].Task != "db-1" {
+		t.Fatalf("Expected only db-1 to be released, got %v: %v", released, err)
+	}
+
+	if err := restored.Remove("db-1"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if read, _ := NewReservations(storage).Get("db-1"); read != nil {
+		t.Fatal("Expected the reservation to be gone once removed")
+	}
+	if read, _ := NewReservations(storage).Get("db-2"); read == nil || read.Released {
+		t.Fatal("Expected the other reservation to be left alone")
+	}
+}
+
+// Released reservations are given up on once they've waited out the timeout, others are kept whatever their age.
+func TestReservations_Expire(t *testing.T) {
+	storage := persistence.NewPersistence(memory.New(), 0, 0, 0)
+	reservations := NewReservations(storage)
+
+	r := newReservation()
+	r.AgentID = "a"
+	reservations.Add(r)
+	reservations.Add(New("db-2", "db", "hydrogen", nil, Volume{Size: 1, ContainerPath: "data", Mode: RW}))
+	if err := reservations.Release("db-1"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expired, err := reservations.Expire(time.Hour); err != nil || len(expired) != 0 {
+		t.Fatalf("Nothing should have expired yet, got %v: %v", expired, err)
+	}
+	expired, err := reservations.Expire(0)
+	if err != nil || len(expired) != 1 || expired[0].Task != "db-1" {
+		t.Fatalf("Expected only the released reservation to expire, got %v: %v", expired, err)
+	}
+	if read, _ := NewReservations(storage).Get("db-1"); read != nil {
+		t.Fatal("Expected the expired reservation to be forgotten")
+	}
+	if read, _ := NewReservations(storage).Get("db-2"); read == nil {
+		t.Fatal("Expected the other reservation to be kept")
+	}
+}
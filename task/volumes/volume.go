@@ -0,0 +1,56 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volumes
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	DISK = "disk" // The resource volumes are carved out of.
+
+	RW = "RW"
+	RO = "RO"
+)
+
+// Volume is a persistent volume an application asks for.
+// Its data outlives the task, which is always launched on the agent holding it.
+type Volume struct {
+	Size          float64 `json:"size"` // Megabytes, like the disk resource.
+	ContainerPath string  `json:"container_path"`
+	Mode          string  `json:"mode"`
+}
+
+// Fills in the default mode and makes sure the volume can be created.
+func (v *Volume) Validate() error {
+	if v.Size <= 0 {
+		return errors.New("Persistent volumes need a size in megabytes")
+	}
+	if v.ContainerPath == "" {
+		return errors.New("Persistent volumes need a container path to be mounted at")
+	}
+
+	v.Mode = strings.ToUpper(v.Mode)
+	switch v.Mode {
+	case "":
+		v.Mode = RW
+	case RW, RO:
+	default:
+		return errors.New("Unknown volume mode " + v.Mode + ", please use RW or RO")
+	}
+
+	return nil
+}
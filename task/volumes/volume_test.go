@@ -0,0 +1,43 @@
+// Copyright 2017 Verizon
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package volumes
+
+import (
+	"testing"
+)
+
+func TestVolume_Validate(t *testing.T) {
+	tests := []struct {
+		volume Volume
+		mode   string
+		valid  bool
+	}{
+		{Volume{Size: 512, ContainerPath: "data"}, RW, true},
+		{Volume{Size: 512, ContainerPath: "data", Mode: "ro"}, RO, true},
+		{Volume{Size: 512, ContainerPath: "data", Mode: "rwx"}, "", false},
+		{Volume{ContainerPath: "data"}, "", false},
+		{Volume{Size: 512}, "", false},
+	}
+
+	for _, test := range tests {
+		err := test.volume.Validate()
+		if (err == nil) != test.valid {
+			t.Errorf("%+v: expected valid to be %v, got %v", test.volume, test.valid, err)
+		}
+		if test.valid && test.volume.Mode != test.mode {
+			t.Errorf("%+v: expected mode %s", test.volume, test.mode)
+		}
+	}
+}